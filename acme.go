@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// acmeLabel is the label under which ACME DNS-01 challenges are published.
+const acmeLabel = "_acme-challenge"
+
+var acme = &Command{
+	Run:         runACME,
+	CustomFlags: flagsACME,
+	UsageLine: `acme [-ttl <ttl>] [-wait <duration> [-nameserver <address>...]]
+    [-dry-run] present|cleanup [<fqdn> <token>]`,
+	Short: "publish and remove ACME DNS-01 challenges",
+	Long: `
+'acme' publishes the TXT record for an ACME DNS-01 challenge, so that it
+can be used as a hook by ACME clients such as certbot and lego.
+
+'present' creates the record and 'cleanup' removes it.  Only the record
+with the token is removed: other challenges for the same name, e.g. for
+a wildcard and the bare domain, are left alone.
+
+<fqdn> is the name being validated, with or without the _acme-challenge
+label and trailing dot, and <token> is the TXT value.  The domain holding
+the record is the longest of the account's domains which the name ends
+with.
+
+lego's exec provider passes these arguments:
+
+    EXEC_PATH=/path/to/hook lego --dns exec ...
+
+where the hook runs 'dnsme acme "$@"'.  If <fqdn> and <token> are not
+given they are taken from CERTBOT_DOMAIN and CERTBOT_VALIDATION, as set
+by certbot for its hooks:
+
+    certbot certonly --manual --preferred-challenges dns \
+        --manual-auth-hook 'dnsme acme present' \
+        --manual-cleanup-hook 'dnsme acme cleanup' -d example.com
+
+-ttl is the TTL of the record, 60 by default.
+
+-wait makes 'present' wait, up to the given time, e.g. "5m", until the
+record is served by the nameservers of the domain, or those given by
+-nameserver; see 'dnsme help wait'.
+
+-dry-run shows the change that would be made, without making it.
+
+`,
+}
+
+func flagsACME(f *flag.FlagSet) {
+	f.String("ttl", "60", "")
+	flagDryRun(f)
+	flagsWait(f)
+}
+
+func runACME(cmd *Command, args []string) (err error) {
+
+	if len(args) == 0 {
+		err = errors.New("present or cleanup not specified")
+		return
+	}
+
+	action := args[0]
+	if action != "present" && action != "cleanup" {
+		err = fmt.Errorf("unknown action %q; expected present or cleanup", action)
+		return
+	}
+
+	var fqdn, token string
+	switch len(args) {
+	case 1:
+		fqdn, token = os.Getenv("CERTBOT_DOMAIN"), os.Getenv("CERTBOT_VALIDATION")
+		if fqdn == "" || token == "" {
+			err = errors.New("<fqdn> and <token> not specified, and CERTBOT_DOMAIN and CERTBOT_VALIDATION are not set")
+			return
+		}
+	case 3:
+		fqdn, token = args[1], args[2]
+	default:
+		err = errors.New("expected <fqdn> and <token>")
+		return
+	}
+
+	fqdn = canonicalHost(strings.TrimPrefix(canonicalHost(fqdn), "*."))
+	if !strings.HasPrefix(fqdn, acmeLabel+".") {
+		fqdn = acmeLabel + "." + fqdn
+	}
+
+	ttl, err := strconv.Atoi(cmd.Flag.Lookup("ttl").Value.String())
+	if err != nil {
+		err = fmt.Errorf("invalid -ttl %q", cmd.Flag.Lookup("ttl").Value.String())
+		return
+	}
+
+	domains, err := client.Domains()
+	if err != nil {
+		return
+	}
+	domain := zoneFor(fqdn, domains)
+	if domain == "" {
+		err = fmt.Errorf("no domain in the account holds %s", fqdn)
+		return
+	}
+	name := strings.TrimSuffix(fqdn, "."+domain)
+
+	existing, err := matchRecords(domain, recordSelector{Name: &name, Type: "TXT"})
+	if err != nil {
+		return
+	}
+	var found []dnsme.Record
+	for _, r := range existing {
+		if strings.Trim(r.Data, `"`) == token {
+			found = append(found, r)
+		}
+	}
+
+	var changes []recordChange
+	if action == "present" {
+		if len(found) == 0 {
+			r := dnsme.Record{Name: name, Type: "TXT", Data: token, TTL: ttl, GtdLocation: "DEFAULT"}
+			changes = append(changes, recordChange{Op: opCreate, Domain: domain, Record: r})
+		}
+	} else {
+		for _, r := range found {
+			changes = append(changes, recordChange{Op: opDelete, Domain: domain, Record: r})
+		}
+	}
+
+	if dryRun(cmd) {
+		outputChanges(os.Stdout, changes)
+		return
+	}
+
+	err = applyChanges(changes, func(c recordChange) {
+		printChange(os.Stderr, c)
+	})
+	if err != nil {
+		return
+	}
+
+	if action == "present" {
+		// wait even if the record already existed
+		err = waitForChanges(cmd, []recordChange{{Domain: domain, Record: dnsme.Record{Name: name, Type: "TXT"}}})
+	}
+	return
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+func TestACME(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddDomain(dnsme.Domain{Name: "example.com"})
+		s.AddDomain(dnsme.Domain{Name: "dept.example.com"})
+
+		// the longest domain holding the name is used
+		mustRun(t, "acme", "present", "www.dept.example.com", "token1")
+		mustRun(t, "acme", "present", "*.dept.example.com.", "token2")
+		mustRun(t, "acme", "present", "_acme-challenge.Dept.Example.com", "token3")
+		mustRun(t, "acme", "-ttl", "120", "present", "example.com", "token4")
+
+		want := "_acme-challenge.www TXT token1\n_acme-challenge TXT token2\n_acme-challenge TXT token3"
+		if got := recordsOf(s, "dept.example.com"); got != want {
+			t.Errorf("records after present:\n%s\nwant:\n%s", got, want)
+		}
+		records := s.Records("example.com")
+		if len(records) != 1 || records[0].Name != "_acme-challenge" || records[0].Data != "token4" || records[0].TTL != 120 {
+			t.Errorf("records of example.com = %+v", records)
+		}
+		if r := s.Records("dept.example.com")[0]; r.TTL != 60 || r.GtdLocation != "DEFAULT" {
+			t.Errorf("record = %+v, want TTL 60 in DEFAULT", r)
+		}
+
+		// presenting again does not add the record twice
+		mustRun(t, "acme", "present", "dept.example.com", "token3")
+		if got := recordsOf(s, "dept.example.com"); got != want {
+			t.Errorf("records after presenting again:\n%s", got)
+		}
+
+		// only the record with the token is removed
+		_, stderr, err := run(t, "acme", "cleanup", "dept.example.com", "token2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(stderr, "- dept.example.com: ") || !strings.Contains(stderr, "token2") {
+			t.Errorf("cleanup stderr = %q", stderr)
+		}
+		want = "_acme-challenge.www TXT token1\n_acme-challenge TXT token3"
+		if got := recordsOf(s, "dept.example.com"); got != want {
+			t.Errorf("records after cleanup:\n%s\nwant:\n%s", got, want)
+		}
+
+		// cleaning up a record already removed is not an error
+		mustRun(t, "acme", "cleanup", "dept.example.com", "token2")
+	})
+}
+
+func TestACMECertbot(t *testing.T) {
+	s := testAPI(t, dnsme.V1)
+	s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+	t.Setenv("CERTBOT_DOMAIN", "www.example.com")
+	t.Setenv("CERTBOT_VALIDATION", "token")
+	mustRun(t, "acme", "present")
+	if got := recordsOf(s, "example.com"); got != "_acme-challenge.www TXT token" {
+		t.Errorf("records after present:\n%s", got)
+	}
+	mustRun(t, "acme", "cleanup")
+	if got := recordsOf(s, "example.com"); got != "" {
+		t.Errorf("records after cleanup:\n%s", got)
+	}
+
+	t.Setenv("CERTBOT_VALIDATION", "")
+	if _, _, err := run(t, "acme", "present"); err == nil {
+		t.Error("present without CERTBOT_VALIDATION succeeded")
+	}
+}
+
+func TestACMEDryRun(t *testing.T) {
+	s := testAPI(t, dnsme.V1)
+	s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+	out := mustRun(t, "acme", "-dry-run", "present", "example.com", "token")
+	if !strings.HasPrefix(out, "+ example.com: ") || !strings.Contains(out, "token") {
+		t.Errorf("present -dry-run = %q", out)
+	}
+	if got := recordsOf(s, "example.com"); got != "" {
+		t.Errorf("records after present -dry-run:\n%s", got)
+	}
+}
+
+func TestACMEErrors(t *testing.T) {
+	testAPI(t, dnsme.V1).AddDomain(dnsme.Domain{Name: "example.com"})
+
+	for _, args := range [][]string{
+		{"acme"},
+		{"acme", "remove", "example.com", "token"},
+		{"acme", "present", "example.com"},
+		{"acme", "present", "example.org", "token"},
+		{"acme", "-ttl", "x", "present", "example.com", "token"},
+	} {
+		if _, _, err := run(t, args...); err == nil {
+			t.Errorf("dnsme %s succeeded", strings.Join(args[1:], " "))
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// auditLog is the file the audit log is written to, set by -audit-log.
+var auditLog string
+
+// An auditEntry is a line of the audit log.
+type auditEntry struct {
+	Time     time.Time       `json:"time"`
+	User     string          `json:"user"`
+	Profile  string          `json:"profile,omitempty"`
+	Command  []string        `json:"command"`
+	Op       string          `json:"op"`
+	Domain   string          `json:"domain"`
+	RecordID int             `json:"recordId,omitempty"`
+	Before   json.RawMessage `json:"before,omitempty"`
+	After    json.RawMessage `json:"after,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// auditPath returns the name of the audit log file, or "" if auditing is
+// turned off.
+func auditPath() string {
+	switch auditLog {
+	case "off":
+		return ""
+	case "":
+		return filepath.Join(filepath.Dir(configPath()), "audit.log")
+	}
+	return expandHome(auditLog)
+}
+
+// auditLogger returns a hook for the client which appends each change
+// to the audit log, or nil if auditing is turned off.
+func auditLogger(p *profile) func(e dnsme.AuditEntry) {
+
+	file := auditPath()
+	if file == "" {
+		return nil
+	}
+
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+
+	var mu sync.Mutex
+	return func(e dnsme.AuditEntry) {
+		entry := auditEntry{
+			Time:     e.Time.UTC(),
+			User:     name,
+			Command:  os.Args,
+			Op:       e.Op,
+			Domain:   e.Domain,
+			RecordID: e.RecordID,
+		}
+		if p != nil {
+			entry.Profile = p.Name
+		}
+		if e.Before != nil {
+			entry.Before, _ = json.Marshal(e.Before)
+		}
+		if e.After != nil {
+			entry.After, _ = json.Marshal(e.After)
+		}
+		if e.Err != nil {
+			entry.Error = e.Err.Error()
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		err := appendAudit(file, entry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: cannot write audit log: %s\n", err)
+		}
+	}
+}
+
+// appendAudit appends entry to the log as a line of JSON.
+func appendAudit(file string, entry auditEntry) (err error) {
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	_, err = f.Write(append(b, '\n'))
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return
+}
+
+var audit = &Command{
+	Run:         runAudit,
+	CustomFlags: flagsAudit,
+	Offline:     true,
+	UsageLine: `audit [-name <name>] [-type <record type>] [-id <record id>]
+    [-op <operation>] [-user <user>] [-since <time>] [-until <time>]
+    [<domain>...]`,
+	Short: "show the log of changes made",
+	Long: `
+'audit' shows the audit log, to which every change made through the API
+is appended: each record or domain added, updated or deleted.  Each
+entry holds the time, the user and profile, the dnsme command line, the
+state of the record or domain before and after the change, and the error
+if the change failed.
+
+The changes are shown in the style of 'dnsme plan', each below a line
+giving the time, user, profile and command.  "-o json" writes them as a
+JSON array of the log entries, and "-o csv" one row for each.
+
+If domains are given, only changes to them are shown.  The other flags
+select the changes shown:
+
+-name, -type and -id select changes to the records with the name, type
+or record ID.  An empty -name selects the records of the base domain.
+
+-op selects the operation: add-record, update-record, delete-record,
+add-domain, delete-domain, add-secondary or delete-secondary.
+
+-user selects the changes made by a user.
+
+-since and -until select changes made from or before a time, given as
+e.g. "2026-10-18", "2026-10-18 15:04", an RFC 3339 time or a duration
+before now such as "24h".
+
+The log is written to audit.log in the directory of the config file.
+The global -audit-log flag, or the "audit_log" key of a profile, names
+another file, or turns the log off with "off".  Entries are only ever
+appended, each as a line of JSON.  The state of a record before it was
+updated or deleted is logged if dnsme knew it when making the change;
+records deleted by -id alone are logged by their ID.
+
+`,
+}
+
+func flagsAudit(f *flag.FlagSet) {
+	f.String("name", "", "")
+	f.String("type", "", "")
+	f.String("id", "", "")
+	f.String("op", "", "")
+	f.String("user", "", "")
+	f.String("since", "", "")
+	f.String("until", "", "")
+}
+
+// An auditFilter selects entries of the audit log.
+type auditFilter struct {
+	domains      []string
+	name         *string
+	rtype        string
+	id           int
+	op, user     string
+	since, until time.Time
+}
+
+func runAudit(cmd *Command, args []string) (err error) {
+
+	value := func(name string) string { return cmd.Flag.Lookup(name).Value.String() }
+
+	filter := auditFilter{domains: args, rtype: value("type"), op: value("op"), user: value("user")}
+	if givenFlags(cmd)("name") {
+		name := value("name")
+		filter.name = &name
+	}
+	if value("id") != "" {
+		filter.id, err = strconv.Atoi(value("id"))
+		if err != nil {
+			err = fmt.Errorf("invalid -id %q", value("id"))
+			return
+		}
+	}
+	for _, t := range []struct {
+		flag string
+		t    *time.Time
+	}{{"since", &filter.since}, {"until", &filter.until}} {
+		if value(t.flag) == "" {
+			continue
+		}
+		*t.t, err = parseAuditTime(value(t.flag))
+		if err != nil {
+			err = fmt.Errorf("invalid -%s %q", t.flag, value(t.flag))
+			return
+		}
+	}
+
+	file := auditPath()
+	if file == "" {
+		err = errors.New("the audit log is turned off")
+		return
+	}
+
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		err = fmt.Errorf("no audit log at %s", file)
+		return
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	entries := []auditEntry{}
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		var e auditEntry
+		if json.Unmarshal(s.Bytes(), &e) != nil {
+			err = fmt.Errorf("%s:%d: invalid audit log entry", file, n)
+			return
+		}
+		if filter.match(e) {
+			entries = append(entries, e)
+		}
+	}
+	err = s.Err()
+	if err != nil {
+		return
+	}
+
+	switch outputType {
+	default:
+		for i, e := range entries {
+			if i > 0 {
+				fmt.Println()
+			}
+			printAuditEntry(os.Stdout, e)
+		}
+	case "json":
+		b, _ := json.Marshal(entries)
+		os.Stdout.Write(b)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		for _, e := range entries {
+			r, _ := e.records()
+			w.Write([]string{
+				e.Time.Format(time.RFC3339), e.User, e.Profile, strings.Join(e.Command, " "),
+				e.Op, e.Domain, strconv.Itoa(r.ID), r.Name, r.Type, r.Data, e.Error,
+			})
+		}
+		w.Flush()
+	}
+	return
+}
+
+// parseAuditTime parses a time given to -since or -until.
+func parseAuditTime(s string) (t time.Time, err error) {
+
+	if d, e := time.ParseDuration(s); e == nil {
+		t = time.Now().Add(-d)
+		return
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		t, err = time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// records returns the record of e, as it was before the change if it
+// was deleted and after it otherwise, and the record before the change,
+// if any.
+func (e auditEntry) records() (r dnsme.Record, before *dnsme.Record) {
+
+	if len(e.Before) > 0 && strings.HasSuffix(e.Op, "-record") {
+		before = &dnsme.Record{}
+		json.Unmarshal(e.Before, before)
+		r = *before
+	}
+	if len(e.After) > 0 && strings.HasSuffix(e.Op, "-record") {
+		r = dnsme.Record{}
+		json.Unmarshal(e.After, &r)
+	}
+	if r.ID == 0 {
+		r.ID = e.RecordID
+	}
+	return
+}
+
+func (f auditFilter) match(e auditEntry) bool {
+
+	if len(f.domains) > 0 {
+		found := false
+		for _, d := range f.domains {
+			found = found || strings.EqualFold(d, e.Domain)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	switch {
+	case f.op != "" && e.Op != f.op,
+		f.user != "" && e.User != f.user,
+		!f.since.IsZero() && e.Time.Before(f.since),
+		!f.until.IsZero() && !e.Time.Before(f.until):
+		return false
+	}
+
+	if f.name == nil && f.rtype == "" && f.id == 0 {
+		return true
+	}
+	if !strings.HasSuffix(e.Op, "-record") {
+		return false
+	}
+
+	// either state of the record may match
+	r, before := e.records()
+	states := []dnsme.Record{r}
+	if before != nil {
+		states = append(states, *before)
+	}
+	for _, s := range states {
+		if (f.name == nil || s.Name == *f.name) && (f.rtype == "" || s.Type == f.rtype) && (f.id == 0 || e.RecordID == f.id || s.ID == f.id) {
+			return true
+		}
+	}
+	return false
+}
+
+// printAuditEntry writes e as a line describing who made the change,
+// followed by the change in the style of 'dnsme plan'.
+func printAuditEntry(w io.Writer, e auditEntry) {
+
+	command := make([]string, len(e.Command))
+	for i, arg := range e.Command {
+		if i == 0 {
+			arg = filepath.Base(arg)
+		}
+		if arg == "" || strings.ContainsAny(arg, " \t\"'\\$") {
+			arg = strconv.Quote(arg)
+		}
+		command[i] = arg
+	}
+	profile := ""
+	if e.Profile != "" {
+		profile = " [" + e.Profile + "]"
+	}
+	fmt.Fprintf(w, "%s %s%s: %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.User, profile, strings.Join(command, " "))
+
+	r, before := e.records()
+	switch e.Op {
+	case "add-record":
+		printChange(w, recordChange{Op: opCreate, Domain: e.Domain, Record: r})
+	case "update-record":
+		printChange(w, recordChange{Op: opUpdate, Domain: e.Domain, Record: r, Old: before})
+	case "delete-record":
+		printChange(w, recordChange{Op: opDelete, Domain: e.Domain, Record: r})
+	case "add-domain":
+		printChange(w, recordChange{Op: opCreateDomain, Domain: e.Domain})
+	case "delete-domain":
+		printChange(w, recordChange{Op: opDeleteDomain, Domain: e.Domain})
+	case "add-secondary":
+		fmt.Fprintf(w, "+ %s: secondary\n", e.Domain)
+	case "delete-secondary":
+		fmt.Fprintf(w, "- %s: secondary\n", e.Domain)
+	default:
+		fmt.Fprintf(w, "%s %s\n", e.Op, e.Domain)
+	}
+
+	if e.Error != "" {
+		fmt.Fprintf(w, "  failed: %s\n", e.Error)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+// readAudit returns the entries of the audit log in the directory of the
+// config file.
+func readAudit(t *testing.T) (entries []auditEntry) {
+	t.Helper()
+	f, err := os.Open(filepath.Join(filepath.Dir(os.Getenv("DNSME_CONFIG")), "audit.log"))
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e auditEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			t.Fatalf("audit log entry %s: %v", s.Bytes(), err)
+		}
+		entries = append(entries, e)
+	}
+	return
+}
+
+func TestAuditLog(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+		mustRun(t, "add-record", "-name", "www", "-type", "A", "-data", "192.0.2.1", "example.com")
+		mustRun(t, "update-record", "-name", "www", "-type", "A", "-data", "192.0.2.2", "example.com")
+		mustRun(t, "delete-record", "-name", "www", "-type", "A", "example.com")
+		mx := s.AddRecord("example.com", dnsme.Record{Name: "", Type: "MX", Data: "10 mail", TTL: 3600, GtdLocation: "DEFAULT"})
+		mustRun(t, "update-record", "-id", strconv.Itoa(mx), "-type", "MX", "-data", "20 mail", "example.com")
+		if _, _, err := run(t, "update-record", "-id", strconv.Itoa(mx), "-type", "MX", "-data", "30 mail", "-ttl", "1h", "example.com"); err == nil || !strings.Contains(err.Error(), "invalid -ttl") {
+			t.Errorf("update-record -ttl 1h: err = %v", err)
+		}
+		id := s.AddRecord("example.com", dnsme.Record{Name: "ftp", Type: "CNAME", Data: "example.com.", TTL: 3600, GtdLocation: "DEFAULT"})
+		mustRun(t, "delete-record", "-id", strconv.Itoa(id), "example.com")
+
+		// changes not made are not logged
+		mustRun(t, "add-record", "-dry-run", "-name", "www", "-type", "A", "-data", "192.0.2.3", "example.com")
+
+		entries := readAudit(t)
+		var ops []string
+		for _, e := range entries {
+			ops = append(ops, e.Op)
+			if e.Domain != "example.com" || e.User == "" || len(e.Command) == 0 || e.Error != "" {
+				t.Errorf("entry = %+v", e)
+			}
+		}
+		if got := strings.Join(ops, " "); got != "add-record update-record delete-record update-record delete-record" {
+			t.Fatalf("ops = %s", got)
+		}
+
+		// the records are logged as the command knew them
+		added, _ := entries[0].records()
+		updated, before := entries[1].records()
+		deleted, _ := entries[2].records()
+		switch {
+		case added.ID == 0 || added.Data != "192.0.2.1" || len(entries[0].Before) != 0:
+			t.Errorf("add-record entry = %+v", entries[0])
+		case before == nil || before.Data != "192.0.2.1" || updated.Data != "192.0.2.2" || updated.ID != added.ID:
+			t.Errorf("update-record entry = %+v", entries[1])
+		case deleted.Data != "192.0.2.2" || len(entries[2].After) != 0:
+			t.Errorf("delete-record entry = %+v", entries[2])
+		}
+		// a record updated by -id is fetched, and logged as it was
+		if updated, before := entries[3].records(); before == nil || before.Data != "10 mail" || updated.Data != "20 mail" || updated.ID != mx {
+			t.Errorf("update-record -id entry = %+v", entries[3])
+		}
+		// a record deleted by -id alone is logged by its ID
+		if e := entries[4]; e.RecordID != id || len(e.Before) != 0 {
+			t.Errorf("delete-record -id entry = %+v", e)
+		}
+	})
+}
+
+func TestAuditCommand(t *testing.T) {
+	s := testAPI(t, dnsme.V1)
+	s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+	if _, _, err := run(t, "audit"); err == nil || !strings.Contains(err.Error(), "no audit log") {
+		t.Errorf("audit without a log: err = %v", err)
+	}
+
+	mustRun(t, "add-domain", "example.org")
+	mustRun(t, "add-record", "-name", "www", "-type", "A", "-data", "192.0.2.1", "example.com")
+	mustRun(t, "update-record", "-name", "www", "-type", "A", "-data", "192.0.2.2", "example.com")
+	mustRun(t, "add-record", "-name", "ftp", "-type", "CNAME", "-data", "example.com.", "example.com")
+	s.Fail("DELETE", http.StatusBadRequest, 1)
+	if _, _, err := run(t, "delete-record", "-name", "ftp", "-type", "CNAME", "example.com"); err == nil {
+		t.Fatal("delete-record of a failing server succeeded")
+	}
+
+	out := mustRun(t, "audit")
+	for _, want := range []string{
+		"+ example.org: domain",
+		"+ example.com: www",
+		"~ example.com: www",
+		`; was data="192.0.2.1"`,
+		"- example.com: ftp",
+		"  failed: ",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("audit lacks %q:\n%s", want, out)
+		}
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want int
+	}{
+		{[]string{"example.com"}, 4},
+		{[]string{"example.org"}, 1},
+		{[]string{"-op", "add-record"}, 2},
+		{[]string{"-name", "www"}, 2},
+		{[]string{"-type", "CNAME"}, 2},
+		{[]string{"-since", "1h"}, 5},
+		{[]string{"-until", "2000-01-01"}, 0},
+		{[]string{"-user", "nobody"}, 0},
+	} {
+		var entries []auditEntry
+		out := mustRun(t, append([]string{"audit", "-o", "json"}, tt.args...)...)
+		if err := json.Unmarshal([]byte(out), &entries); err != nil || len(entries) != tt.want {
+			t.Errorf("audit %s: %d entries, %v; want %d", strings.Join(tt.args, " "), len(entries), err, tt.want)
+		}
+	}
+
+	// the log may be turned off
+	mustRun(t, "add-record", "-audit-log", "off", "-name", "mail", "-type", "A", "-data", "192.0.2.9", "example.com")
+	if n := len(readAudit(t)); n != 5 {
+		t.Errorf("%d entries after a change with -audit-log off, want 5", n)
+	}
+	if _, _, err := run(t, "audit", "-audit-log", "off"); err == nil {
+		t.Error("audit -audit-log off succeeded")
+	}
+
+	other := filepath.Join(t.TempDir(), "other.log")
+	mustRun(t, "delete-domain", "-audit-log", other, "example.org")
+	if out := mustRun(t, "audit", "-audit-log", other); !strings.Contains(out, "- example.org: domain") {
+		t.Errorf("audit -audit-log %s = %q", other, out)
+	}
+}
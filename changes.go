@@ -0,0 +1,329 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// Operations in a change set.
+const (
+	opCreate       = "create"
+	opUpdate       = "update"
+	opDelete       = "delete"
+	opCreateDomain = "create-domain"
+	opDeleteDomain = "delete-domain"
+)
+
+// A recordChange is a single operation needed to bring a domain to its
+// desired state.  Record is the desired record for creates and updates,
+// and the record to remove for deletes; for updates, Old is the record
+// being replaced.  Info describes a domain to be created.
+type recordChange struct {
+	Op     string        `json:"op"`
+	Domain string        `json:"domain"`
+	Record dnsme.Record  `json:"record"`
+	Old    *dnsme.Record `json:"old,omitempty"`
+	Info   *dnsme.Domain `json:"info,omitempty"`
+}
+
+// recordKey identifies a record for the purpose of comparing record
+// sets: records with the same key are the same record, possibly with a
+// different TTL.
+func recordKey(r dnsme.Record) string {
+	gtd := r.GtdLocation
+	if gtd == "" {
+		gtd = "DEFAULT"
+	}
+	return strings.Join([]string{strings.ToLower(r.Name), r.Type, r.Data, gtd}, "\x00")
+}
+
+// sameRedirect reports whether the HTTPRED fields of a and b match.
+func sameRedirect(a, b dnsme.Record) bool {
+	return a.RedirectType == b.RedirectType && a.Title == b.Title && a.Keywords == b.Keywords &&
+		a.Description == b.Description && a.HardLink == b.HardLink
+}
+
+// checkRecord validates r, a record of domain, and warns on w if its
+// type is one whose data cannot be checked.
+func checkRecord(w io.Writer, domain string, r dnsme.Record) (err error) {
+	err = r.Validate()
+	if err == nil && !dnsme.CheckedType(r.Type) {
+		name := r.Name
+		if name == "" {
+			name = "@"
+		}
+		fmt.Fprintf(w, "warning: %s: the data of %s record %q is not checked\n", domain, r.Type, name)
+	}
+	return
+}
+
+// checkRecords checks the records of d with checkRecord, writing each
+// problem found to w, and returns the valid records and the number of
+// invalid ones.
+func checkRecords(w io.Writer, d exportDomain) (valid []dnsme.Record, invalid int) {
+	for _, r := range d.Records {
+		if err := checkRecord(w, d.Domain.Name, r); err != nil {
+			fmt.Fprintf(w, "error: %s: %s\n", d.Domain.Name, err)
+			invalid++
+			continue
+		}
+		valid = append(valid, r)
+	}
+	return
+}
+
+// validateRecords returns domains without their invalid records, writing
+// each problem found to w, and the number of records left out.
+func validateRecords(w io.Writer, domains []exportDomain) (valid []exportDomain, invalid int) {
+	for _, d := range domains {
+		var n int
+		d.Records, n = checkRecords(w, d)
+		invalid += n
+		valid = append(valid, d)
+	}
+	return
+}
+
+// validDomains returns the domains all of whose records are valid,
+// writing each problem found with the others to w, and the number of
+// domains left out.  A domain is made to match its records as a whole,
+// as any record left out would be deleted.
+func validDomains(w io.Writer, domains []exportDomain) (valid []exportDomain, skipped int) {
+	for _, d := range domains {
+		if _, invalid := checkRecords(w, d); invalid > 0 {
+			fmt.Fprintf(w, "error: %s: skipped, as %d records are invalid\n", d.Domain.Name, invalid)
+			skipped++
+			continue
+		}
+		valid = append(valid, d)
+	}
+	return
+}
+
+// diffRecords returns the changes which turn the current records of a
+// domain into the desired ones: deletes first, then updates and creates.
+func diffRecords(domain string, current, desired []dnsme.Record) (changes []recordChange) {
+
+	unmatched := make(map[string][]dnsme.Record)
+	for _, r := range current {
+		k := recordKey(r)
+		unmatched[k] = append(unmatched[k], r)
+	}
+
+	var updates, creates []recordChange
+	for _, want := range desired {
+		if want.GtdLocation == "" {
+			want.GtdLocation = "DEFAULT"
+		}
+		want.Error = nil
+
+		k := recordKey(want)
+		have := unmatched[k]
+		if len(have) == 0 {
+			want.ID = 0
+			creates = append(creates, recordChange{Op: opCreate, Domain: domain, Record: want})
+			continue
+		}
+		old := have[0]
+		unmatched[k] = have[1:]
+
+		if want.TTL != old.TTL || want.Password != "" && want.Password != old.Password || !sameRedirect(want, old) {
+			want.ID = old.ID
+			updates = append(updates, recordChange{Op: opUpdate, Domain: domain, Record: want, Old: &old})
+		}
+	}
+
+	for _, r := range current {
+		k := recordKey(r)
+		for i, left := range unmatched[k] {
+			if left.ID == r.ID {
+				changes = append(changes, recordChange{Op: opDelete, Domain: domain, Record: r})
+				unmatched[k] = append(unmatched[k][:i], unmatched[k][i+1:]...)
+				break
+			}
+		}
+	}
+
+	changes = append(changes, updates...)
+	changes = append(changes, creates...)
+	return
+}
+
+// applyChanges makes each change through the API, in order, calling
+// done after each successful change.  It stops at the first error.
+func applyChanges(changes []recordChange, done func(c recordChange)) (err error) {
+
+	for _, c := range changes {
+		switch c.Op {
+		case opCreateDomain:
+			d := dnsme.Domain{Name: c.Domain}
+			if c.Info != nil {
+				d.NameServers, d.GtdEnabled = c.Info.NameServers, c.Info.GtdEnabled
+			}
+			_, err = client.AddDomain(d)
+		case opDeleteDomain:
+			err = client.DeleteDomain(c.Domain)
+		case opCreate:
+			var added dnsme.Record
+			added, err = client.AddRecord(c.Domain, c.Record)
+			if err == nil {
+				c.Record = added
+			}
+		case opUpdate:
+			err = replaceRecord(c)
+		case opDelete:
+			err = removeRecord(c.Domain, c.Record)
+		default:
+			err = fmt.Errorf("unknown operation %q", c.Op)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %s", describeChange(c), err)
+			return
+		}
+		if done != nil {
+			done(c)
+		}
+	}
+
+	return
+}
+
+// replaceRecord makes the update c, giving the audit log the record as it
+// was, if it is known.
+func replaceRecord(c recordChange) error {
+	if c.Old == nil || c.Old.Type == "" {
+		return client.UpdateRecord(c.Domain, c.Record)
+	}
+	return client.ReplaceRecord(c.Domain, *c.Old, c.Record)
+}
+
+// removeRecord deletes r from domain, giving the audit log the record,
+// if it is known rather than only its ID.
+func removeRecord(domain string, r dnsme.Record) error {
+	if r.Type == "" {
+		return client.DeleteRecord(domain, r.ID)
+	}
+	return client.RemoveRecord(domain, r)
+}
+
+// describeChange returns a one line description of c for messages.
+func describeChange(c recordChange) string {
+	switch c.Op {
+	case opCreateDomain, opDeleteDomain:
+		return c.Op + " " + c.Domain
+	}
+	return fmt.Sprintf("%s %s %s record %q in %s", c.Op, c.Record.Type, c.Record.Name, c.Record.Data, c.Domain)
+}
+
+// printChange writes c in the style of the records output, prefixed by
+// "+" for creates, "-" for deletes and "~" for updates.  Updates are
+// followed by a comment listing what changed.
+func printChange(w io.Writer, c recordChange) {
+	switch c.Op {
+	case opCreateDomain:
+		fmt.Fprintf(w, "+ %s: domain\n", c.Domain)
+		return
+	case opDeleteDomain:
+		fmt.Fprintf(w, "- %s: domain\n", c.Domain)
+		return
+	}
+
+	prefix := map[string]string{opCreate: "+", opUpdate: "~", opDelete: "-"}[c.Op]
+	fmt.Fprintf(w, "%s %s: ", prefix, c.Domain)
+	tmpl(w, recordTemplate, c.Record)
+
+	if c.Op == opUpdate && c.Old != nil {
+		fmt.Fprintf(w, "  %s  ; was %s\n", strings.Repeat(" ", len(c.Domain)+1), recordDifferences(*c.Old, c.Record))
+	}
+}
+
+// recordDifferences describes the fields of old which differ in r.
+func recordDifferences(old, r dnsme.Record) string {
+	var diffs []string
+	if old.Name != r.Name {
+		diffs = append(diffs, fmt.Sprintf("name=%q", old.Name))
+	}
+	if old.Type != r.Type {
+		diffs = append(diffs, "type="+old.Type)
+	}
+	if old.Data != r.Data {
+		diffs = append(diffs, fmt.Sprintf("data=%q", old.Data))
+	}
+	if old.TTL != r.TTL {
+		diffs = append(diffs, "ttl="+strconv.Itoa(old.TTL))
+	}
+	if old.GtdLocation != r.GtdLocation {
+		diffs = append(diffs, "gtd="+old.GtdLocation)
+	}
+	if old.Password != r.Password {
+		diffs = append(diffs, "password")
+	}
+	if old.RedirectType != r.RedirectType {
+		diffs = append(diffs, fmt.Sprintf("redirect=%q", old.RedirectType))
+	}
+	if old.Title != r.Title {
+		diffs = append(diffs, fmt.Sprintf("title=%q", old.Title))
+	}
+	if old.Keywords != r.Keywords {
+		diffs = append(diffs, fmt.Sprintf("keywords=%q", old.Keywords))
+	}
+	if old.Description != r.Description {
+		diffs = append(diffs, fmt.Sprintf("description=%q", old.Description))
+	}
+	if old.HardLink != r.HardLink {
+		diffs = append(diffs, "hardLink="+strconv.FormatBool(old.HardLink))
+	}
+	if len(diffs) == 0 {
+		return "unchanged"
+	}
+	return strings.Join(diffs, ", ")
+}
+
+// printChanges writes changes as a diff followed by a summary.
+func printChanges(w io.Writer, changes []recordChange) {
+	counts := make(map[string]int)
+	for _, c := range changes {
+		printChange(w, c)
+		counts[c.Op]++
+	}
+
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "No changes.")
+		return
+	}
+	summary := fmt.Sprintf("%d to create, %d to update, %d to delete", counts[opCreate], counts[opUpdate], counts[opDelete])
+	if n := counts[opCreateDomain]; n > 0 {
+		summary += fmt.Sprintf(", %d domains to create", n)
+	}
+	if n := counts[opDeleteDomain]; n > 0 {
+		summary += fmt.Sprintf(", %d domains to delete", n)
+	}
+	fmt.Fprintln(w, summary+".")
+}
+
+// outputChanges writes changes in the selected output type.
+func outputChanges(w io.Writer, changes []recordChange) {
+	switch outputType {
+	default:
+		printChanges(w, changes)
+	case "json":
+		if changes == nil {
+			changes = []recordChange{}
+		}
+		b, _ := json.Marshal(changes)
+		w.Write(b)
+	case "csv":
+		var rs [][]string
+		for _, c := range changes {
+			rs = append(rs, append([]string{c.Op, c.Domain}, recordCSV(c.Record)...))
+		}
+		cw := csv.NewWriter(w)
+		cw.WriteAll(rs)
+	}
+}
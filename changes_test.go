@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+var (
+	validRecord   = dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"}
+	invalidRecord = dnsme.Record{Name: "bad", Type: "A", Data: "2001:db8::1", TTL: 300, GtdLocation: "DEFAULT"}
+	caaRecord     = dnsme.Record{Name: "", Type: "CAA", Data: `0 issue "letsencrypt.org"`, TTL: 300, GtdLocation: "DEFAULT"}
+)
+
+func TestValidateRecords(t *testing.T) {
+	domains := []exportDomain{
+		{Domain: dnsme.Domain{Name: "example.com"}, Records: []dnsme.Record{validRecord, invalidRecord, caaRecord}},
+		{Domain: dnsme.Domain{Name: "example.org"}, Records: []dnsme.Record{validRecord}},
+	}
+
+	var w strings.Builder
+	valid, invalid := validateRecords(&w, domains)
+	if invalid != 1 || len(valid) != 2 || len(valid[0].Records) != 2 || valid[0].Records[1].Type != "CAA" {
+		t.Errorf("validateRecords = %+v, %d", valid, invalid)
+	}
+	if !strings.Contains(w.String(), `error: example.com: invalid A record "bad"`) ||
+		!strings.Contains(w.String(), `warning: example.com: the data of CAA record "@" is not checked`) {
+		t.Errorf("validateRecords wrote:\n%s", w.String())
+	}
+
+	w.Reset()
+	valid, skipped := validDomains(&w, domains)
+	if skipped != 1 || len(valid) != 1 || valid[0].Domain.Name != "example.org" {
+		t.Errorf("validDomains = %+v, %d", valid, skipped)
+	}
+	if !strings.Contains(w.String(), "error: example.com: skipped, as 1 records are invalid") {
+		t.Errorf("validDomains wrote:\n%s", w.String())
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		file := exportFile(t, exportDomain{Domain: dnsme.Domain{Name: "example.com"}, Records: []dnsme.Record{validRecord, invalidRecord, caaRecord}})
+
+		_, stderr, err := run(t, "import", "-file", file)
+		if err == nil || err.Error() != "import failed: 1 errors" {
+			t.Errorf("import with an invalid record: err = %v", err)
+		}
+		if !strings.Contains(stderr, "warning: example.com: the data of CAA record") {
+			t.Errorf("import stderr lacks a warning for the CAA record:\n%s", stderr)
+		}
+		if got := recordsOf(s, "example.com"); got != "www A 192.0.2.1\nCAA 0 issue \"letsencrypt.org\"" {
+			t.Errorf("records after import:\n%s", got)
+		}
+	})
+}
+
+func TestSyncInvalid(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddRecord("example.com", invalidRecord)
+		s.AddRecord("example.com", validRecord)
+
+		file := exportFile(t,
+			exportDomain{Domain: dnsme.Domain{Name: "example.com"}, Records: []dnsme.Record{invalidRecord}},
+			exportDomain{Domain: dnsme.Domain{Name: "example.org"}, Records: []dnsme.Record{validRecord, caaRecord}},
+		)
+
+		for _, command := range []string{"plan", "sync"} {
+			if _, _, err := run(t, command, "-file", file); err == nil || !strings.Contains(err.Error(), "1 domains skipped") {
+				t.Errorf("%s with an invalid record: err = %v", command, err)
+			}
+		}
+
+		// the other domain is synced, and example.com left alone
+		if got := recordsOf(s, "example.org"); got != "www A 192.0.2.1\nCAA 0 issue \"letsencrypt.org\"" {
+			t.Errorf("example.org after sync:\n%s", got)
+		}
+		if got := recordsOf(s, "example.com"); got != "bad A 2001:db8::1\nwww A 192.0.2.1" {
+			t.Errorf("example.com after sync:\n%s", got)
+		}
+	})
+}
+
+func TestAddRecordUnchecked(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+		_, stderr, err := run(t, "add-record", "-name", "", "-type", "CAA", "-data", `0 issue "letsencrypt.org"`, "example.com")
+		if err != nil || !strings.Contains(stderr, "warning: example.com: the data of CAA record") {
+			t.Errorf("add-record of a CAA record: err = %v, stderr %q", err, stderr)
+		}
+		if _, _, err := run(t, "add-record", "-name", "www", "-type", "A", "-data", "2001:db8::1", "example.com"); err == nil {
+			t.Error("add-record of an invalid record succeeded")
+		}
+		if got := recordsOf(s, "example.com"); got != "CAA 0 issue \"letsencrypt.org\"" {
+			t.Errorf("records after add-record:\n%s", got)
+		}
+	})
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var profileName string
+
+// A profile is a named section of the config file, holding the API
+// credentials of an account and defaults for flags.
+type profile struct {
+	Name      string
+	URL       string
+	APIKey    string
+	SecretKey string
+
+	// Alternative sources of the credentials; see credentials.go.
+	CredentialsFile   string
+	CredentialProcess string
+	CredentialStore   string
+
+	// Flags maps flag names to the default values used by this profile.
+	Flags map[string]string
+}
+
+// profileFlags maps config file keys to the flags whose default values
+// they set.
+var profileFlags = map[string]string{
+	"output":      "o",
+	"api":         "api",
+	"max_wait":    "max-wait",
+	"ttl":         "ttl",
+	"gtdLocation": "gtdLocation",
+	"nameserver":  "nameserver",
+	"audit_log":   "audit-log",
+
+	"snapshot_keep":    "keep",
+	"snapshot_max_age": "max-age",
+}
+
+// recordValueCommands are the commands whose -ttl and -gtdLocation flags
+// describe the record written, and so take the ttl and gtdLocation
+// defaults of a profile.  Other commands use these flags to select
+// records, which a default must not do.
+var recordValueCommands = map[string]bool{
+	"add-record":    true,
+	"update-record": true,
+	"upsert-record": true,
+}
+
+// configPath returns the name of the config file: $DNSME_CONFIG, or
+// dnsme/config in the user's config directory.
+func configPath() string {
+
+	if name := os.Getenv("DNSME_CONFIG"); name != "" {
+		return name
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		dir = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(dir, "dnsme", "config")
+}
+
+// A configSection is a named section of a file in the format of the
+// config file.
+type configSection struct {
+	Name   string
+	Lineno int
+	Keys   []configKey
+}
+
+type configKey struct {
+	Key, Value string
+	Lineno     int
+}
+
+// readSections parses a file made up of sections in the form
+//
+//	[name]
+//	key = value
+//
+// Blank lines and lines starting with "#" or ";" are ignored.  what
+// names the sections in messages.
+func readSections(r io.Reader, file, what string) (sections []*configSection, err error) {
+
+	names := make(map[string]bool)
+	var sec *configSection
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+		case line[0] == '[':
+			if !strings.HasSuffix(line, "]") {
+				err = fmt.Errorf("%s:%d: bad %s name %s", file, n, what, line)
+				return
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if names[name] {
+				err = fmt.Errorf("%s:%d: %s %s defined twice", file, n, what, name)
+				return
+			}
+			names[name] = true
+			sec = &configSection{Name: name, Lineno: n}
+			sections = append(sections, sec)
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			err = fmt.Errorf("%s:%d: expected key = value", file, n)
+			return
+		}
+		if sec == nil {
+			err = fmt.Errorf("%s:%d: %s is not in a %s", file, n, line, what)
+			return
+		}
+
+		sec.Keys = append(sec.Keys, configKey{strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), n})
+	}
+
+	err = s.Err()
+	return
+}
+
+// readConfig parses a config file, which is made up of profiles.
+func readConfig(r io.Reader, file string) (profiles map[string]*profile, err error) {
+
+	sections, err := readSections(r, file, "profile")
+	if err != nil {
+		return
+	}
+
+	profiles = make(map[string]*profile)
+	for _, sec := range sections {
+		p := &profile{Name: sec.Name, Flags: make(map[string]string)}
+		profiles[sec.Name] = p
+
+		for _, k := range sec.Keys {
+			value := k.Value
+			switch k.Key {
+			case "url":
+				p.URL = value
+			case "api_key":
+				p.APIKey = value
+			case "secret_key":
+				p.SecretKey = value
+			case "credentials_file":
+				p.CredentialsFile = expandHome(value)
+			case "credential_process":
+				p.CredentialProcess = value
+			case "credential_store":
+				p.CredentialStore = expandHome(value)
+			default:
+				f, ok := profileFlags[k.Key]
+				if !ok {
+					err = fmt.Errorf("%s:%d: unknown key %s", file, k.Lineno, k.Key)
+					return
+				}
+				p.Flags[f] = value
+			}
+		}
+	}
+	return
+}
+
+// loadProfile returns the selected profile: the one named by -profile
+// or $DNSME_PROFILE, else "default".  A missing config file or default
+// profile is not an error, as everything may be given in the
+// environment instead.
+func loadProfile() (p *profile, err error) {
+
+	name := profileName
+	if name == "" {
+		name = os.Getenv("DNSME_PROFILE")
+	}
+	required := name != ""
+	if name == "" {
+		name = "default"
+	}
+
+	p = &profile{Name: name}
+
+	file := configPath()
+	f, err := os.Open(file)
+	if os.IsNotExist(err) && !required {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	profiles, err := readConfig(f, file)
+	if err != nil {
+		return
+	}
+
+	if profiles[name] == nil {
+		if required {
+			err = fmt.Errorf("%s: profile %s not found", file, name)
+		}
+		return
+	}
+	p = profiles[name]
+
+	if p.SecretKey != "" {
+		if fi, e := f.Stat(); e == nil && fi.Mode().Perm()&0077 != 0 {
+			fmt.Fprintf(os.Stderr, "warning: %s holds a secret key but is accessible by other users\n", file)
+		}
+	}
+	return
+}
+
+// expandHome replaces a leading "~/" in name with the home directory.
+func expandHome(name string) string {
+	if strings.HasPrefix(name, "~/") {
+		return filepath.Join(os.Getenv("HOME"), name[2:])
+	}
+	return name
+}
+
+// applyProfile sets the flags of a command which were not given on the
+// command line to the defaults of the profile.
+func applyProfile(p *profile, cmd *Command) (err error) {
+
+	given := givenFlags(cmd)
+
+	for name, value := range p.Flags {
+		f := cmd.Flag.Lookup(name)
+		if given(name) || f == nil {
+			continue
+		}
+		if (name == "ttl" || name == "gtdLocation") && !recordValueCommands[cmd.Name()] {
+			continue
+		}
+		// the value remains a default rather than a flag given on
+		// the command line
+		err = f.Value.Set(value)
+		if err != nil {
+			err = fmt.Errorf("profile %s: invalid -%s: %s", p.Name, name, err)
+			return
+		}
+		f.DefValue = value
+	}
+	return
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+const testConfig = `# accounts
+[default]
+api_key = key
+secret_key = secret
+ttl = 300
+gtdLocation = DEFAULT
+
+[sandbox]
+url = https://api.sandbox.dnsmadeeasy.com/V2.0
+credentials_file = ~/dnsme.json
+output = json
+max_wait = 1m
+`
+
+func TestReadConfig(t *testing.T) {
+	t.Setenv("HOME", "/home/user")
+
+	profiles, err := readConfig(strings.NewReader(testConfig), "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := profiles["default"]
+	if p == nil || p.APIKey != "key" || p.SecretKey != "secret" || p.Flags["ttl"] != "300" || p.Flags["gtdLocation"] != "DEFAULT" {
+		t.Errorf("default profile = %+v", p)
+	}
+	p = profiles["sandbox"]
+	if p == nil || p.URL != "https://api.sandbox.dnsmadeeasy.com/V2.0" || p.CredentialsFile != "/home/user/dnsme.json" ||
+		p.Flags["o"] != "json" || p.Flags["max-wait"] != "1m" {
+		t.Errorf("sandbox profile = %+v", p)
+	}
+
+	for config, want := range map[string]string{
+		"[default\n":                   "config:1: bad profile name [default",
+		"[a]\n[a]\n":                   "config:2: profile a defined twice",
+		"[a]\nttl\n":                   "config:2: expected key = value",
+		"ttl = 300\n":                  "config:1: ttl = 300 is not in a profile",
+		"[a]\n\n# comment\ncolour = 1": "config:4: unknown key colour",
+	} {
+		if _, err := readConfig(strings.NewReader(config), "config"); err == nil || err.Error() != want {
+			t.Errorf("readConfig(%q): err = %v, want %s", config, err, want)
+		}
+	}
+}
+
+// writeConfig writes the config file used by the commands run in a
+// test.
+func writeConfig(t *testing.T, config string) {
+	t.Helper()
+	if err := os.WriteFile(os.Getenv("DNSME_CONFIG"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	testAPI(t, dnsme.V1)
+	writeConfig(t, testConfig)
+
+	if _, _, err := run(t, "domains", "-profile", "missing"); err == nil || !strings.Contains(err.Error(), "profile missing not found") {
+		t.Errorf("-profile missing: err = %v", err)
+	}
+	t.Setenv("DNSME_PROFILE", "missing")
+	if _, _, err := run(t, "domains"); err == nil {
+		t.Error("DNSME_PROFILE=missing succeeded")
+	}
+	t.Setenv("DNSME_PROFILE", "")
+
+	writeConfig(t, "[default]\nmax_wait = soon\n")
+	if _, _, err := run(t, "domains"); err == nil || !strings.Contains(err.Error(), "profile default: invalid -max-wait") {
+		t.Errorf("invalid max_wait: err = %v", err)
+	}
+}
+
+func TestProfileRecordDefaults(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		writeConfig(t, testConfig)
+		eu := s.AddRecord("example.com", dnsme.Record{Name: "eu", Type: "A", Data: "192.0.2.1", TTL: 3600, GtdLocation: "EUROPE"})
+
+		// the profile sets the TTL of new records, unless -ttl is given
+		mustRun(t, "add-record", "-name", "www", "-type", "A", "-data", "192.0.2.2", "example.com")
+		mustRun(t, "add-record", "-name", "ftp", "-type", "A", "-data", "192.0.2.3", "-ttl", "60", "example.com")
+		records := s.Records("example.com")
+		if len(records) != 3 || records[1].TTL != 300 || records[1].GtdLocation != "DEFAULT" || records[2].TTL != 60 {
+			t.Errorf("records after add-record = %+v", records)
+		}
+
+		// but does not select records
+		if out := mustRun(t, "records", "example.com"); !strings.Contains(out, "eu ") {
+			t.Errorf("records lacks the record in EUROPE:\n%s", out)
+		}
+		id := strconv.Itoa(eu)
+		if out := mustRun(t, "record", "-id", id, "example.com"); !strings.Contains(out, "192.0.2.1") {
+			t.Errorf("record -id %s = %q", id, out)
+		}
+		if _, _, err := run(t, "delete-records", "-dry-run", "example.com"); err == nil {
+			t.Error("delete-records without filter flags succeeded")
+		}
+		mustRun(t, "delete-record", "-id", id, "example.com")
+		if got := recordsOf(s, "example.com"); got != "www A 192.0.2.2\nftp A 192.0.2.3" {
+			t.Errorf("records after delete-record -id:\n%s", got)
+		}
+	})
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// credentials are an API key pair, as read from a credentials file, a
+// credential process or a credential store.
+type credentials struct {
+	APIKey    string `json:"apiKey"`
+	SecretKey string `json:"secretKey"`
+}
+
+// A credentialStore is an encrypted credentials file.  The credentials
+// are encrypted with AES-256-GCM, using a key derived from a passphrase
+// with PBKDF2-SHA256.
+type credentialStore struct {
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+const (
+	storeKDF        = "pbkdf2-sha256"
+	storeIterations = 600000
+
+	// maxStoreIterations bounds the work a store can demand, as its
+	// iteration count is read from the file.
+	maxStoreIterations = 100 * storeIterations
+)
+
+// credentials returns the credentials of the profile from whichever
+// source it is configured with.  Credentials are empty if the profile
+// has none.
+func (p *profile) credentials() (creds credentials, err error) {
+
+	sources := 0
+	for _, s := range []string{p.APIKey + p.SecretKey, p.CredentialsFile, p.CredentialProcess, p.CredentialStore} {
+		if s != "" {
+			sources++
+		}
+	}
+	if sources > 1 {
+		err = fmt.Errorf("profile %s has more than one source of credentials", p.Name)
+		return
+	}
+
+	switch {
+	case p.CredentialsFile != "":
+		creds, err = readCredentialsFile(p.CredentialsFile)
+	case p.CredentialProcess != "":
+		creds, err = runCredentialProcess(p.CredentialProcess)
+	case p.CredentialStore != "":
+		creds, err = openCredentialStore(p.CredentialStore)
+	default:
+		creds = credentials{APIKey: p.APIKey, SecretKey: p.SecretKey}
+	}
+	return
+}
+
+// readCredentialsFile reads credentials from a JSON file, which must
+// not be accessible by other users.
+func readCredentialsFile(name string) (creds credentials, err error) {
+
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		err = fmt.Errorf("%s is accessible by other users (mode %s); run chmod 600 %s", name, fi.Mode().Perm(), name)
+		return
+	}
+
+	err = json.NewDecoder(f).Decode(&creds)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", name, err)
+	}
+	return
+}
+
+// runCredentialProcess runs command with the shell and reads credentials
+// from its output, in the same format as a credentials file.  The
+// command may prompt on the terminal.
+func runCredentialProcess(command string) (creds credentials, err error) {
+
+	c := exec.Command("/bin/sh", "-c", command)
+	c.Stdin = os.Stdin
+	c.Stderr = os.Stderr
+
+	out, err := c.Output()
+	if err != nil {
+		err = fmt.Errorf("credential_process %q: %s", command, err)
+		return
+	}
+
+	err = json.Unmarshal(out, &creds)
+	if err != nil {
+		err = fmt.Errorf("credential_process %q: %s", command, err)
+	}
+	return
+}
+
+// openCredentialStore decrypts a credential store with a passphrase
+// read from the terminal.
+func openCredentialStore(name string) (creds credentials, err error) {
+
+	s, err := readCredentialStore(name)
+	if err != nil {
+		return
+	}
+
+	passphrase, err := getPassphrase("Passphrase for " + name + ": ")
+	if err != nil {
+		return
+	}
+
+	creds, err = s.open(name, passphrase)
+	return
+}
+
+// readCredentialStore reads the store name, checking that it uses the
+// supported key derivation with a sane number of iterations.
+func readCredentialStore(name string) (s credentialStore, err error) {
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", name, err)
+		return
+	}
+	if s.KDF != storeKDF {
+		err = fmt.Errorf("%s: unsupported key derivation %q", name, s.KDF)
+		return
+	}
+	if s.Iterations < storeIterations || s.Iterations > maxStoreIterations {
+		err = fmt.Errorf("%s: %d iterations is outside the range %d to %d", name, s.Iterations, storeIterations, maxStoreIterations)
+		return
+	}
+	return
+}
+
+// open decrypts the credentials in the store name with passphrase.
+func (s credentialStore) open(name, passphrase string) (creds credentials, err error) {
+
+	aead, err := storeCipher(passphrase, s.Salt, s.Iterations)
+	if err != nil {
+		return
+	}
+
+	if len(s.Nonce) != aead.NonceSize() {
+		err = fmt.Errorf("%s: corrupt store", name)
+		return
+	}
+	plaintext, err := aead.Open(nil, s.Nonce, s.Ciphertext, nil)
+	if err != nil {
+		err = fmt.Errorf("%s: wrong passphrase or corrupt store", name)
+		return
+	}
+
+	err = json.Unmarshal(plaintext, &creds)
+	return
+}
+
+// writeCredentialStore encrypts creds with passphrase into the store
+// name, replacing any existing store.
+func writeCredentialStore(name string, creds credentials, passphrase string) (err error) {
+
+	s := credentialStore{
+		KDF:        storeKDF,
+		Iterations: storeIterations,
+		Salt:       make([]byte, 16),
+	}
+	_, err = rand.Read(s.Salt)
+	if err != nil {
+		return
+	}
+
+	aead, err := storeCipher(passphrase, s.Salt, s.Iterations)
+	if err != nil {
+		return
+	}
+
+	s.Nonce = make([]byte, aead.NonceSize())
+	_, err = rand.Read(s.Nonce)
+	if err != nil {
+		return
+	}
+
+	plaintext, err := json.Marshal(creds)
+	if err != nil {
+		return
+	}
+	s.Ciphertext = aead.Seal(nil, s.Nonce, plaintext, nil)
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), 0700)
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(name, append(b, '\n'), 0600)
+	return
+}
+
+func storeCipher(passphrase string, salt []byte, iterations int) (aead cipher.AEAD, err error) {
+
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(passphrase), salt, iterations, 32))
+	if err != nil {
+		return
+	}
+	aead, err = cipher.NewGCM(block)
+	return
+}
+
+// pbkdf2SHA256 derives a key of keyLen bytes from password and salt
+// with PBKDF2, as in RFC 8018, using HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) (key []byte) {
+
+	prf := hmac.New(sha256.New, password)
+	u := make([]byte, prf.Size())
+	t := make([]byte, prf.Size())
+
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
+
+// getPassphrase reads a passphrase from the terminal.  It is not taken
+// from the environment, which other processes may be able to read.
+func getPassphrase(prompt string) (passphrase string, err error) {
+
+	passphrase, err = readTerminal(prompt, false)
+	if err == nil && passphrase == "" {
+		err = errors.New("empty passphrase")
+	}
+	return
+}
+
+// readTerminal prompts for and reads a line from the terminal, without
+// echoing it unless echo is set.
+func readTerminal(prompt string, echo bool) (line string, err error) {
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		err = errors.New("no terminal to prompt on")
+		return
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+	if !echo {
+		stty := func(arg string) {
+			c := exec.Command("stty", arg)
+			c.Stdin = tty
+			c.Run()
+		}
+		stty("-echo")
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(tty)
+		}()
+	}
+
+	line, err = bufio.NewReader(tty).ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	line = strings.TrimRight(line, "\r\n")
+	return
+}
+
+var saveCredentials = &Command{
+	Run:         runSaveCredentials,
+	CustomFlags: flagsSaveCredentials,
+	Offline:     true,
+	UsageLine:   "save-credentials [-store <file>]",
+	Short:       "save an API key pair in an encrypted store",
+	Long: `
+'save-credentials' encrypts an API key pair with a passphrase and saves
+it in a credential store, which a profile can then use with:
+
+    credential_store = <file>
+
+The key pair is taken from DNSME_API_KEY and DNSME_SECRET_KEY if they
+are set, and is otherwise prompted for.  The passphrase is always read
+from the terminal, and is needed whenever the store is used.  Where
+there is no terminal, use credential_process instead, e.g. with a
+password manager.
+
+-store is the file to write.  Default is the credential_store of the
+profile, or "credentials" in the directory of the config file.
+
+`,
+}
+
+func flagsSaveCredentials(f *flag.FlagSet) {
+	f.String("store", "", "")
+}
+
+func runSaveCredentials(cmd *Command, args []string) (err error) {
+
+	name := expandHome(cmd.Flag.Lookup("store").Value.String())
+	if name == "" {
+		var p *profile
+		p, err = loadProfile()
+		if err != nil {
+			return
+		}
+		name = p.CredentialStore
+	}
+	if name == "" {
+		name = filepath.Join(filepath.Dir(configPath()), "credentials")
+	}
+
+	creds := credentials{
+		APIKey:    os.Getenv("DNSME_API_KEY"),
+		SecretKey: os.Getenv("DNSME_SECRET_KEY"),
+	}
+	if creds.APIKey == "" {
+		creds.APIKey, err = readTerminal("API key: ", true)
+		if err != nil {
+			return
+		}
+	}
+	if creds.SecretKey == "" {
+		creds.SecretKey, err = readTerminal("Secret key: ", false)
+		if err != nil {
+			return
+		}
+	}
+	if creds.APIKey == "" || creds.SecretKey == "" {
+		err = errors.New("API key and secret key are required")
+		return
+	}
+
+	passphrase, err := getPassphrase("New passphrase: ")
+	if err != nil {
+		return
+	}
+	again, err := readTerminal("Repeat passphrase: ", false)
+	if err != nil {
+		return
+	}
+	if passphrase != again {
+		err = errors.New("passphrases do not match")
+		return
+	}
+
+	err = writeCredentialStore(name, creds, passphrase)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "credentials saved to %s\n", name)
+	return
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCredentialStore(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "dnsme", "credentials")
+	want := credentials{APIKey: "key", SecretKey: "secret"}
+	if err := writeCredentialStore(name, want, "passphrase"); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(name); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("store mode = %v, %v; want 0600", fi.Mode(), err)
+	}
+
+	s, err := readCredentialStore(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds, err := s.open(name, "passphrase"); err != nil || creds != want {
+		t.Errorf("open = %+v, %v; want %+v", creds, err, want)
+	}
+	if _, err := s.open(name, "wrong"); err == nil || !strings.Contains(err.Error(), "wrong passphrase") {
+		t.Errorf("open with the wrong passphrase: err = %v", err)
+	}
+	s.Nonce = s.Nonce[1:]
+	if _, err := s.open(name, "passphrase"); err == nil {
+		t.Error("open with a short nonce succeeded")
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// test vectors of RFC 7914, section 11
+	for _, tt := range []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	} {
+		if got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, 64)); got != tt.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+	if key := pbkdf2SHA256([]byte("p"), []byte("s"), 1, 20); len(key) != 20 {
+		t.Errorf("pbkdf2SHA256 of 20 bytes returned %d", len(key))
+	}
+}
+
+func TestCredentialStoreIterations(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "credentials")
+
+	for _, n := range []int{0, 1, storeIterations - 1, maxStoreIterations + 1, -1} {
+		b, _ := json.Marshal(credentialStore{KDF: storeKDF, Iterations: n})
+		if err := os.WriteFile(name, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readCredentialStore(name); err == nil || !strings.Contains(err.Error(), "iterations") {
+			t.Errorf("store with %d iterations: err = %v", n, err)
+		}
+	}
+
+	b, _ := json.Marshal(credentialStore{KDF: "scrypt", Iterations: storeIterations})
+	os.WriteFile(name, b, 0600)
+	if _, err := readCredentialStore(name); err == nil || !strings.Contains(err.Error(), "unsupported key derivation") {
+		t.Errorf("store with another KDF: err = %v", err)
+	}
+}
+
+func TestCredentialSources(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "credentials.json")
+	os.WriteFile(file, []byte(`{"apiKey": "key", "secretKey": "secret"}`), 0600)
+	want := credentials{APIKey: "key", SecretKey: "secret"}
+
+	for _, p := range []*profile{
+		{Name: "keys", APIKey: "key", SecretKey: "secret"},
+		{Name: "file", CredentialsFile: file},
+		{Name: "process", CredentialProcess: "cat " + file},
+	} {
+		if creds, err := p.credentials(); err != nil || creds != want {
+			t.Errorf("credentials of profile %s = %+v, %v", p.Name, creds, err)
+		}
+	}
+
+	p := &profile{Name: "both", APIKey: "key", CredentialsFile: file}
+	if _, err := p.credentials(); err == nil {
+		t.Error("credentials of a profile with two sources succeeded")
+	}
+
+	os.Chmod(file, 0644)
+	if _, err := readCredentialsFile(file); err == nil || !strings.Contains(err.Error(), "accessible by other users") {
+		t.Errorf("credentials file readable by others: err = %v", err)
+	}
+
+	if _, err := runCredentialProcess("exit 1"); err == nil {
+		t.Error("failing credential process succeeded")
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// Services returning the public address of the caller as plain text.
+const (
+	defaultIPv4URL = "https://api.ipify.org"
+	defaultIPv6URL = "https://api6.ipify.org"
+)
+
+// ipClient fetches the address from -ip-url.  A service which does not
+// answer must not hold up ddns until the next interval, or forever.
+var ipClient = &http.Client{Timeout: 30 * time.Second}
+
+var ddns = &Command{
+	Run:         runDDNS,
+	CustomFlags: flagsDDNS,
+	Offline:     true,
+	UsageLine: `ddns -id <id> -user <username> [-password <password>]
+    [-type A|AAAA] [-ip-url <url> | -interface <name>]
+    [-update-url <url>] [-state <file>] [-interval <duration>] [-dry-run]
+       dnsme ddns -key-pair -name <name> [-type A|AAAA]
+    [-ip-url <url> | -interface <name>] [-ttl <ttl>]
+    [-gtdLocation <gtdLocation>] [-state <file>]
+    [-interval <duration>] [-dry-run] <domain>`,
+	Short: "keep a record pointing at the current address",
+	Long: `
+'ddns' keeps an A or AAAA record pointing at the current public address
+of this host, like a dynamic DNS client.
+
+The address is found by fetching -ip-url, which must return the address
+as plain text, or from the network interface named by -interface.  The
+default URL is ` + defaultIPv4URL + ` for A records and
+` + defaultIPv6URL + ` for AAAA records.
+
+By default the record is updated through the dynamic DNS service of DNS
+Made Easy, with the dynamic DNS password of the record rather than the
+API key pair of the account, so a host running ddns cannot make any
+other change to the account.  -id is the ID of the record, -user the
+username of the account and -password the password of the record; the
+password may instead be given in DNSME_DDNS_PASSWORD, where other users
+of the host cannot see it.  The record must already exist, with a
+password set, e.g. with 'dnsme update-record -password'.  -update-url is
+the service, by default ` + dnsme.DefaultDynamicURL + `.
+
+-key-pair updates the record through the API with the key pair of the
+account instead.  It is needed to create the record, or to update one
+without a password, but gives the host full access to the account.  The
+record is named by -name and the domain, and is created with -ttl and
+-gtdLocation if it does not exist.  Only the address of an existing
+record is changed; its password and other fields are left alone.
+
+The record is updated only when the address changes.  The last address
+set is saved in a state file, so that no requests are made while the
+address stays the same.  Remove the file to force the record to be
+updated.  -state names the file; the default is in the user's cache
+directory.
+
+-interval runs ddns repeatedly, e.g. "5m", until it is killed; errors
+are reported and retried at the next interval.  By default it runs
+once, e.g. from cron.
+
+-dry-run shows the change that would be made, without making it or
+saving the state.
+
+`,
+}
+
+func flagsDDNS(f *flag.FlagSet) {
+	f.String("id", "", "")
+	f.String("user", "", "")
+	f.String("password", "", "")
+	f.String("update-url", dnsme.DefaultDynamicURL, "")
+	f.Bool("key-pair", false, "")
+	f.String("name", "", "")
+	f.String("type", "A", "")
+	f.String("ip-url", "", "")
+	f.String("interface", "", "")
+	f.String("ttl", "300", "")
+	f.String("gtdLocation", "DEFAULT", "")
+	f.String("state", "", "")
+	f.Duration("interval", 0, "")
+	flagDryRun(f)
+}
+
+// ddnsState is the state saved between runs of ddns.
+type ddnsState struct {
+	Domain  string    `json:"domain,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	Type    string    `json:"type"`
+	IP      string    `json:"ip"`
+	ID      int       `json:"id"`
+	Updated time.Time `json:"updated"`
+}
+
+// A ddnsUpdater keeps one record pointing at the current address.  With
+// dynamic set, the record is updated through the dynamic DNS service;
+// otherwise through the API, by domain and name.
+type ddnsUpdater struct {
+	dynamic     *dnsme.DynamicRecord
+	domain      string
+	name        string
+	rtype       string
+	gtdLocation string
+	ttl         int
+	ipURL       string
+	iface       string
+	stateFile   string
+	dry         bool
+}
+
+func runDDNS(cmd *Command, args []string) (err error) {
+
+	value := func(name string) string { return cmd.Flag.Lookup(name).Value.String() }
+	given := givenFlags(cmd)
+
+	u := &ddnsUpdater{
+		rtype:     value("type"),
+		ipURL:     value("ip-url"),
+		iface:     value("interface"),
+		stateFile: expandHome(value("state")),
+	}
+
+	if value("key-pair") == "true" {
+		err = u.keyPairFlags(cmd, args)
+		if err != nil {
+			return
+		}
+		if client == nil {
+			var p *profile
+			p, err = loadProfile()
+			if err == nil {
+				err = newClient(p)
+			}
+			if err != nil {
+				return
+			}
+		}
+		u.dry = dryRun(cmd)
+	} else {
+		for _, name := range []string{"name", "ttl", "gtdLocation"} {
+			if given(name) {
+				err = fmt.Errorf("-%s is only used with -key-pair", name)
+				return
+			}
+		}
+		if len(args) > 0 {
+			err = errors.New("a domain is only given with -key-pair")
+			return
+		}
+		u.dynamic = &dnsme.DynamicRecord{
+			URL:        value("update-url"),
+			Username:   value("user"),
+			Password:   value("password"),
+			HTTPClient: ipClient,
+		}
+		if u.dynamic.Password == "" {
+			u.dynamic.Password = os.Getenv("DNSME_DDNS_PASSWORD")
+		}
+		u.dynamic.ID, err = strconv.Atoi(value("id"))
+		switch {
+		case !given("id"):
+			err = errors.New("-id not specified")
+		case err != nil || u.dynamic.ID < 1:
+			err = fmt.Errorf("invalid -id %q", value("id"))
+		case u.dynamic.Username == "":
+			err = errors.New("-user not specified")
+		case u.dynamic.Password == "":
+			err = errors.New("-password not specified, and DNSME_DDNS_PASSWORD is not set")
+		}
+		if err != nil {
+			return
+		}
+		u.dry = value("dry-run") == "true"
+	}
+
+	switch u.rtype {
+	case "A":
+		if u.ipURL == "" {
+			u.ipURL = defaultIPv4URL
+		}
+	case "AAAA":
+		if u.ipURL == "" {
+			u.ipURL = defaultIPv6URL
+		}
+	default:
+		err = fmt.Errorf("ddns only updates A and AAAA records, not %s", u.rtype)
+		return
+	}
+	if u.stateFile == "" {
+		u.stateFile, err = u.defaultStateFile()
+		if err != nil {
+			return
+		}
+	}
+
+	interval, _ := time.ParseDuration(value("interval"))
+	if interval <= 0 {
+		return u.run(os.Stdout)
+	}
+
+	for {
+		if err := u.run(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "%s error: %s\n", time.Now().Format(time.RFC3339), err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// keyPairFlags sets up u from the flags of -key-pair.
+func (u *ddnsUpdater) keyPairFlags(cmd *Command, args []string) (err error) {
+
+	value := func(name string) string { return cmd.Flag.Lookup(name).Value.String() }
+	given := givenFlags(cmd)
+
+	for _, name := range []string{"id", "user", "password"} {
+		if given(name) {
+			err = fmt.Errorf("-%s is not used with -key-pair", name)
+			return
+		}
+	}
+	if len(args) == 0 {
+		err = errors.New("domain not specified")
+		return
+	}
+	if !given("name") {
+		err = errors.New("-name not specified")
+		return
+	}
+
+	u.domain, u.name, u.gtdLocation = args[0], value("name"), value("gtdLocation")
+	u.ttl, err = strconv.Atoi(value("ttl"))
+	if err != nil || u.ttl < 1 || u.ttl > dnsme.MaxTTL {
+		err = fmt.Errorf("invalid -ttl %q", value("ttl"))
+		return
+	}
+	return
+}
+
+// label names the record in messages.
+func (u *ddnsUpdater) label() string {
+	if u.dynamic != nil {
+		return "record " + strconv.Itoa(u.dynamic.ID)
+	}
+	if u.name == "" {
+		return u.domain
+	}
+	return u.name + "." + u.domain
+}
+
+func (u *ddnsUpdater) defaultStateFile() (name string, err error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return
+	}
+	base := fmt.Sprintf("ddns-%s-%s.json", u.label(), u.rtype)
+	if u.dynamic != nil {
+		base = fmt.Sprintf("ddns-%d-%s.json", u.dynamic.ID, u.rtype)
+	}
+	name = filepath.Join(dir, "dnsme", base)
+	return
+}
+
+// run updates the record once, if the address has changed, writing
+// what was done to w.
+func (u *ddnsUpdater) run(w io.Writer) (err error) {
+
+	ip, err := u.currentIP()
+	if err != nil {
+		return
+	}
+
+	state := u.readState()
+	if state.IP == ip && state.ID != 0 {
+		return
+	}
+
+	if u.dynamic != nil {
+		err = u.updateDynamic(w, ip, state)
+	} else {
+		err = u.updateRecord(w, ip, state)
+	}
+	return
+}
+
+// updateDynamic sets the address of the record through the dynamic DNS
+// service.  The previous address is only known from the state.
+func (u *ddnsUpdater) updateDynamic(w io.Writer, ip string, state ddnsState) (err error) {
+
+	if u.dry {
+		fmt.Fprintf(w, "~ %s %s: %s\n", u.label(), u.rtype, ip)
+		return
+	}
+
+	err = u.dynamic.UpdateIP(ip)
+	if err != nil {
+		return
+	}
+	was := state.IP
+	state.ID = u.dynamic.ID
+	err = u.saveState(w, ip, was, state)
+	return
+}
+
+// updateRecord sets the address of the record through the API, creating
+// the record if it does not exist.
+func (u *ddnsUpdater) updateRecord(w io.Writer, ip string, state ddnsState) (err error) {
+
+	name := u.name
+	existing, err := matchRecords(u.domain, recordSelector{Name: &name, Type: u.rtype, GtdLocation: u.gtdLocation})
+	if err != nil {
+		return
+	}
+
+	var c *recordChange
+	switch len(existing) {
+	case 0:
+		r := dnsme.Record{Name: u.name, Type: u.rtype, Data: ip, TTL: u.ttl, GtdLocation: u.gtdLocation}
+		c = &recordChange{Op: opCreate, Domain: u.domain, Record: r}
+	case 1:
+		old := existing[0]
+		old.Error = nil
+		if old.Data != ip {
+			r := old
+			r.Data = ip
+			c = &recordChange{Op: opUpdate, Domain: u.domain, Record: r, Old: &old}
+		}
+		state.ID = old.ID
+	default:
+		err = fmt.Errorf("%d %s records named %q exist in %s", len(existing), u.rtype, u.name, u.domain)
+		return
+	}
+
+	if c != nil {
+		err = checkRecord(os.Stderr, u.domain, c.Record)
+		if err != nil {
+			return
+		}
+	}
+
+	if u.dry {
+		if c == nil {
+			fmt.Fprintf(w, "%s %s is up to date: %s\n", u.label(), u.rtype, ip)
+		} else {
+			printChange(w, *c)
+		}
+		return
+	}
+
+	var was string
+	if c != nil {
+		err = applyChanges([]recordChange{*c}, func(c recordChange) {
+			state.ID = c.Record.ID
+		})
+		if err != nil {
+			return
+		}
+		if c.Old != nil {
+			was = c.Old.Data
+		}
+	} else {
+		was = ip
+	}
+	err = u.saveState(w, ip, was, state)
+	return
+}
+
+// saveState reports the address set, unless it was already set, and
+// saves it in the state.
+func (u *ddnsUpdater) saveState(w io.Writer, ip, was string, state ddnsState) (err error) {
+
+	if was != ip {
+		if was != "" {
+			was = " (was " + was + ")"
+		}
+		fmt.Fprintf(w, "%s %s %s set to %s%s\n", time.Now().Format(time.RFC3339), u.label(), u.rtype, ip, was)
+	}
+
+	state.Domain, state.Name, state.Type, state.IP = u.domain, u.name, u.rtype, ip
+	state.Updated = time.Now().UTC()
+	err = u.writeState(state)
+	return
+}
+
+// currentIP returns the current address, from the interface if one was
+// given, otherwise from the URL.
+func (u *ddnsUpdater) currentIP() (ip string, err error) {
+
+	if u.iface != "" {
+		return interfaceIP(u.iface, u.rtype == "AAAA")
+	}
+
+	resp, err := ipClient.Get(u.ipURL)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%s: %s", u.ipURL, resp.Status)
+		return
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return
+	}
+
+	addr := net.ParseIP(strings.TrimSpace(string(b)))
+	if addr == nil || (addr.To4() == nil) != (u.rtype == "AAAA") {
+		err = fmt.Errorf("%s did not return an address for a %s record", u.ipURL, u.rtype)
+		return
+	}
+	ip = addr.String()
+	return
+}
+
+// interfaceIP returns the first global unicast address of the named
+// interface, IPv6 if ipv6 is set and IPv4 otherwise.
+func interfaceIP(name string, ipv6 bool) (ip string, err error) {
+
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return
+	}
+
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok || !n.IP.IsGlobalUnicast() || (n.IP.To4() == nil) != ipv6 {
+			continue
+		}
+		ip = n.IP.String()
+		return
+	}
+
+	family := "IPv4"
+	if ipv6 {
+		family = "IPv6"
+	}
+	err = fmt.Errorf("interface %s has no global %s address", name, family)
+	return
+}
+
+// readState returns the saved state, or an empty state if there is none
+// for this record.
+func (u *ddnsUpdater) readState() (state ddnsState) {
+
+	b, err := os.ReadFile(u.stateFile)
+	if err != nil {
+		return
+	}
+	if json.Unmarshal(b, &state) != nil || state.Domain != u.domain || state.Name != u.name || state.Type != u.rtype {
+		state = ddnsState{}
+	}
+	if u.dynamic != nil && state.ID != u.dynamic.ID {
+		state = ddnsState{}
+	}
+	return
+}
+
+func (u *ddnsUpdater) writeState(state ddnsState) (err error) {
+
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(u.stateFile), 0700)
+	if err != nil {
+		return
+	}
+	err = os.WriteFile(u.stateFile, append(b, '\n'), 0600)
+	return
+}
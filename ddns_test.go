@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+// ipServer starts a server answering with the address in *ip.
+func ipServer(t *testing.T, ip *string) string {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, *ip)
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func TestDDNS(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddDomain(dnsme.Domain{Name: "example.com"})
+		ip := "192.0.2.1"
+		args := []string{"ddns", "-key-pair", "-name", "home", "-ip-url", ipServer(t, &ip), "-state", filepath.Join(t.TempDir(), "state.json")}
+
+		if out := mustRun(t, append(args, "-dry-run", "example.com")...); !strings.Contains(out, "+ example.com: home") {
+			t.Errorf("ddns -dry-run of a new record:\n%s", out)
+		}
+
+		out := mustRun(t, append(args, "example.com")...)
+		if !strings.Contains(out, "home.example.com A set to 192.0.2.1") {
+			t.Errorf("ddns of a new record:\n%s", out)
+		}
+		r := s.Records("example.com")
+		if len(r) != 1 || r[0].Data != "192.0.2.1" || r[0].TTL != 300 {
+			t.Fatalf("records after ddns = %+v", r)
+		}
+
+		// the state saves any API requests while the address is the same
+		s.Fail("", http.StatusForbidden, 1)
+		if out, _, err := run(t, append(args, "example.com")...); err != nil || out != "" {
+			t.Errorf("ddns with the same address = %q, %v", out, err)
+		}
+		if _, _, err := run(t, "domains"); err != dnsme.ErrForbidden {
+			t.Errorf("ddns with the same address made a request")
+		}
+
+		// other fields are left alone
+		mustRun(t, "update-record", "-name", "home", "-type", "A", "-password", "secret", "example.com")
+		ip = "192.0.2.2"
+		out = mustRun(t, append(args, "example.com")...)
+		if !strings.Contains(out, "set to 192.0.2.2 (was 192.0.2.1)") {
+			t.Errorf("ddns of a new address:\n%s", out)
+		}
+		if r := s.Records("example.com"); len(r) != 1 || r[0].Data != "192.0.2.2" || r[0].Password != "secret" {
+			t.Errorf("records after ddns = %+v", r)
+		}
+
+		ip = "2001:db8::1"
+		if _, _, err := run(t, append(args, "example.com")...); err == nil || !strings.Contains(err.Error(), "did not return an address for a A record") {
+			t.Errorf("ddns of an A record with an IPv6 address: err = %v", err)
+		}
+		for _, args := range [][]string{
+			{"-name", "home", "-type", "MX", "example.com"},
+			{"example.com"},
+			{"-name", "home", "-ttl", "0", "example.com"},
+			{"-name", "home", "-ttl", "2147483648", "example.com"},
+			{"-name", "home", "-id", "1", "example.com"},
+			{"-name", "home"},
+		} {
+			if _, _, err := run(t, append([]string{"ddns", "-key-pair"}, args...)...); err == nil {
+				t.Errorf("ddns -key-pair %s succeeded", strings.Join(args, " "))
+			}
+		}
+
+		// a new record is checked before it is created
+		ip = "192.0.2.5"
+		bad := []string{"ddns", "-key-pair", "-name", "bad_name-", "-ip-url", ipServer(t, &ip), "-state", filepath.Join(t.TempDir(), "state.json"), "example.com"}
+		if _, _, err := run(t, bad...); err == nil || !strings.Contains(err.Error(), "not a valid host name") {
+			t.Errorf("ddns of an invalid name: err = %v", err)
+		}
+		if r := s.Records("example.com"); len(r) != 1 {
+			t.Errorf("records after ddns of an invalid name = %+v", r)
+		}
+	})
+}
+
+func TestDDNSPassword(t *testing.T) {
+	s := testAPI(t, dnsme.V1)
+	s.Username = "user"
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	id := s.AddRecord("example.com", dnsme.Record{Name: "home", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT", Password: "secret"})
+
+	// no API requests are made
+	s.Fail("", http.StatusForbidden, 1)
+
+	ip := "192.0.2.2"
+	state := filepath.Join(t.TempDir(), "state.json")
+	args := []string{"ddns", "-id", fmt.Sprint(id), "-user", "user", "-ip-url", ipServer(t, &ip), "-update-url", ts.URL + dnsmetest.DynamicPath, "-state", state}
+
+	if out := mustRun(t, append(args, "-password", "secret", "-dry-run")...); out != fmt.Sprintf("~ record %d A: 192.0.2.2\n", id) {
+		t.Errorf("ddns -dry-run = %q", out)
+	}
+	if r := s.Records("example.com"); r[0].Data != "192.0.2.1" {
+		t.Errorf("ddns -dry-run changed the record: %+v", r[0])
+	}
+
+	out := mustRun(t, append(args, "-password", "secret")...)
+	if !strings.Contains(out, fmt.Sprintf("record %d A set to 192.0.2.2\n", id)) {
+		t.Errorf("ddns = %q", out)
+	}
+	if r := s.Records("example.com"); r[0].Data != "192.0.2.2" || r[0].Password != "secret" {
+		t.Errorf("record after ddns = %+v", r[0])
+	}
+
+	// the password may be given in the environment
+	t.Setenv("DNSME_DDNS_PASSWORD", "secret")
+	ip = "192.0.2.3"
+	out = mustRun(t, args...)
+	if !strings.Contains(out, "set to 192.0.2.3 (was 192.0.2.2)") {
+		t.Errorf("ddns of a new address = %q", out)
+	}
+	if out := mustRun(t, args...); out != "" {
+		t.Errorf("ddns with the same address = %q", out)
+	}
+
+	if _, _, err := run(t, "domains"); err != dnsme.ErrForbidden {
+		t.Error("ddns made an API request")
+	}
+
+	t.Setenv("DNSME_DDNS_PASSWORD", "wrong")
+	ip = "192.0.2.4"
+	if _, _, err := run(t, args...); err == nil || !strings.Contains(err.Error(), "invalid username or password") {
+		t.Errorf("ddns with a wrong password: err = %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"-user", "user"},
+		{"-id", "x", "-user", "user"},
+		{"-id", fmt.Sprint(id)},
+		{"-id", fmt.Sprint(id), "-user", "user", "-name", "home"},
+		{"-id", fmt.Sprint(id), "-user", "user", "example.com"},
+	} {
+		if _, _, err := run(t, append([]string{"ddns"}, args...)...); err == nil {
+			t.Errorf("ddns %s succeeded", strings.Join(args, " "))
+		}
+	}
+	t.Setenv("DNSME_DDNS_PASSWORD", "")
+	if _, _, err := run(t, "ddns", "-id", fmt.Sprint(id), "-user", "user"); err == nil {
+		t.Error("ddns without a password succeeded")
+	}
+}
+
+func TestDDNSTimeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	saved := ipClient.Timeout
+	ipClient.Timeout = 100 * time.Millisecond
+	defer func() { ipClient.Timeout = saved }()
+
+	u := &ddnsUpdater{rtype: "A", ipURL: ts.URL}
+	start := time.Now()
+	if _, err := u.currentIP(); err == nil {
+		t.Error("currentIP from a server which does not answer succeeded")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("currentIP gave up after %s", d)
+	}
+}
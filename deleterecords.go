@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var deleteRecords = &Command{
+	Run:         runDeleteRecords,
+	CustomFlags: flagsDeleteRecords,
+	UsageLine:   "delete-records <filter flags> [-yes] [-dry-run] [-wait <duration>] <domain>",
+	Short:       "delete all records matching filters",
+	Long: `
+'delete-records' deletes every record in the domain which matches the
+filter flags, which are those of 'dnsme records', e.g. to remove stale
+ACME challenges:
+
+    dnsme delete-records -type TXT -name _acme-challenge example.com
+
+At least one filter flag must be given, with a value.
+
+The matching records are shown, and must be confirmed on the terminal
+before they are deleted.  -yes deletes them without asking.
+
+Each record is shown as it is deleted, in the style of 'dnsme plan'.  A
+record which cannot be deleted is reported, and the others are still
+deleted.
+
+-dry-run shows the records that would be deleted, without deleting them.
+
+-wait waits, up to the given time, e.g. "2m", until the records are no
+longer served by the nameservers of the domain, or those given by
+-nameserver; see 'dnsme help wait'.
+
+`,
+}
+
+func flagsDeleteRecords(f *flag.FlagSet) {
+	flagsFilter(f)
+	f.Bool("yes", false, "")
+	flagDryRun(f)
+	flagsWait(f)
+}
+
+func runDeleteRecords(cmd *Command, args []string) (err error) {
+
+	if len(args) == 0 {
+		err = errors.New("domain not specified")
+		return
+	}
+
+	domain := args[0]
+
+	records, filtered, err := filterRecords(cmd, domain)
+	if err != nil {
+		return
+	}
+	if !filtered {
+		err = errors.New("no filter flags given; see 'dnsme help delete-records'")
+		return
+	}
+
+	var changes []recordChange
+	for _, r := range records {
+		changes = append(changes, recordChange{Op: opDelete, Domain: domain, Record: r})
+	}
+
+	if dryRun(cmd) {
+		outputChanges(os.Stdout, changes)
+		return
+	}
+
+	if len(changes) == 0 {
+		if outputType == "json" {
+			os.Stdout.Write([]byte("[]"))
+		} else {
+			fmt.Println("No matching records.")
+		}
+		return
+	}
+
+	if cmd.Flag.Lookup("yes").Value.String() != "true" {
+		printChanges(os.Stderr, changes)
+		var answer string
+		answer, err = readTerminal(fmt.Sprintf("Delete %d records from %s? [y/N] ", len(changes), domain), true)
+		if err != nil {
+			err = errors.New("cannot confirm without a terminal; use -yes")
+			return
+		}
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			err = errors.New("nothing deleted")
+			return
+		}
+	}
+
+	deleted := []recordChange{}
+	failed := 0
+	for _, c := range changes {
+		e := applyChanges([]recordChange{c}, nil)
+		if e != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", e)
+			failed++
+			continue
+		}
+		deleted = append(deleted, c)
+		if outputType != "json" {
+			printChange(os.Stdout, c)
+		}
+	}
+
+	if outputType == "json" {
+		b, _ := json.Marshal(deleted)
+		os.Stdout.Write(b)
+	}
+
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d records could not be deleted", failed, len(changes))
+		return
+	}
+
+	err = waitForChanges(cmd, deleted)
+	return
+}
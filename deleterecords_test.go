@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+// addTestRecords adds records with a variety of names, types and data to
+// example.com.
+func addTestRecords(s *dnsmetest.Server) {
+	for _, r := range []dnsme.Record{
+		{Name: "www", Type: "A", Data: "192.0.2.1"},
+		{Name: "_acme-challenge", Type: "TXT", Data: "token1"},
+		{Name: "_acme-challenge.www", Type: "TXT", Data: "token2"},
+		{Name: "", Type: "TXT", Data: "v=spf1 -all"},
+		{Name: "eu", Type: "A", Data: "192.0.2.2", GtdLocation: "EUROPE"},
+	} {
+		r.TTL = 300
+		if r.GtdLocation == "" {
+			r.GtdLocation = "DEFAULT"
+		}
+		s.AddRecord("example.com", r)
+	}
+}
+
+func TestFilterRecords(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		addTestRecords(s)
+
+		for _, tt := range []struct {
+			args []string
+			want int
+		}{
+			{nil, 5},
+			{[]string{"-type", "TXT"}, 3},
+			{[]string{"-name", "www"}, 1},
+			{[]string{"-nameContains", "acme"}, 2},
+			{[]string{"-gtdLocation", "EUROPE"}, 1},
+			{[]string{"-value", "token1"}, 1},
+			{[]string{"-valueContains", "192.0.2"}, 2},
+			{[]string{"-nameRegexp", "^_acme-challenge(\\.|$)"}, 2},
+			{[]string{"-type", "TXT", "-valueRegexp", "^token"}, 2},
+		} {
+			var records []dnsme.Record
+			out := mustRun(t, append(append([]string{"records", "-o", "json"}, tt.args...), "example.com")...)
+			if err := json.Unmarshal([]byte(out), &records); err != nil || len(records) != tt.want {
+				t.Errorf("records %s = %d records, %v; want %d", strings.Join(tt.args, " "), len(records), err, tt.want)
+			}
+		}
+
+		if _, _, err := run(t, "records", "-nameRegexp", "(", "example.com"); err == nil || !strings.Contains(err.Error(), "invalid -nameRegexp") {
+			t.Errorf("records with an invalid regexp: err = %v", err)
+		}
+	})
+}
+
+func TestFilterDefaults(t *testing.T) {
+	s := testAPI(t, dnsme.V1)
+	addTestRecords(s)
+
+	cmd := &Command{UsageLine: "delete-records"}
+	flagsDeleteRecords(&cmd.Flag)
+	if err := cmd.Flag.Parse([]string{"example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	// defaults which were not given do not filter
+	cmd.Flag.Lookup("gtdLocation").Value.Set("DEFAULT")
+	cmd.Flag.Lookup("nameRegexp").Value.Set(".")
+
+	records, filtered, err := filterRecords(cmd, "example.com")
+	if err != nil || filtered || len(records) != 5 {
+		t.Errorf("filterRecords with defaults = %d records, filtered %t, err %v; want 5 records unfiltered", len(records), filtered, err)
+	}
+}
+
+func TestDeleteRecords(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		addTestRecords(s)
+		before := recordsOf(s, "example.com")
+
+		for _, args := range [][]string{{"-dry-run"}, {"-yes"}, {"-name", "", "-yes"}} {
+			args = append(append([]string{"delete-records"}, args...), "example.com")
+			if _, _, err := run(t, args...); err == nil || !strings.Contains(err.Error(), "no filter flags given") {
+				t.Errorf("%s: err = %v", strings.Join(args, " "), err)
+			}
+		}
+
+		out := mustRun(t, "delete-records", "-dry-run", "-nameRegexp", "^_acme-challenge", "example.com")
+		if strings.Count(out, "- example.com: _acme-challenge") != 2 || !strings.Contains(out, "0 to create, 0 to update, 2 to delete.") {
+			t.Errorf("delete-records -dry-run:\n%s", out)
+		}
+		if got := recordsOf(s, "example.com"); got != before {
+			t.Errorf("records changed by delete-records -dry-run:\n%s", got)
+		}
+
+		mustRun(t, "delete-records", "-yes", "-type", "TXT", "-nameContains", "acme", "example.com")
+		if got := recordsOf(s, "example.com"); got != "www A 192.0.2.1\nTXT v=spf1 -all\neu A 192.0.2.2" {
+			t.Errorf("records after delete-records:\n%s", got)
+		}
+
+		if out := mustRun(t, "delete-records", "-yes", "-nameContains", "acme", "example.com"); out != "No matching records.\n" {
+			t.Errorf("delete-records matching nothing = %q", out)
+		}
+	})
+}
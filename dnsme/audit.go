@@ -0,0 +1,80 @@
+package dnsme
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// An AuditEntry describes a request which changed, or tried to change,
+// the account.
+type AuditEntry struct {
+	Time time.Time
+
+	// Op is the change requested: "add-domain", "delete-domain",
+	// "add-secondary", "delete-secondary", "add-record",
+	// "update-record" or "delete-record".
+	Op string
+
+	// Domain is the name of the domain changed, and RecordID the ID of
+	// the record, if a record was changed and its ID is known.
+	Domain   string
+	RecordID int
+
+	// Before is the Record before the change, or nil if it is not
+	// known: it is only known when given to ReplaceRecord or
+	// RemoveRecord.  After is the Record, Domain or Secondary as
+	// requested, or nil for deletions.
+	Before interface{}
+	After  interface{}
+
+	// Err is the outcome of the request, nil if it succeeded.
+	Err error
+}
+
+// auditKey is the context key under which a request carries its
+// AuditEntry.
+type auditKey struct{}
+
+// newChange builds a request which changes the account, as newRequest
+// does.  do passes e, with the outcome of the request, to the Audit hook.
+func (c *Client) newChange(e AuditEntry, method, p string, body interface{}) (req *http.Request, err error) {
+
+	req, err = c.newRequest(method, p, body)
+	if err != nil || c.Audit == nil {
+		return
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), auditKey{}, e))
+	return
+}
+
+// audit passes the entry of r, if it is a change, to the Audit hook,
+// with err and the response body as the outcome.
+func (c *Client) audit(r *http.Request, body []byte, err error) {
+
+	e, ok := r.Context().Value(auditKey{}).(AuditEntry)
+	if !ok || c.Audit == nil {
+		return
+	}
+
+	// errors may be reported in the body of a successful response, and
+	// the ID of a record created is only known from it
+	var resp struct {
+		ID    int      `json:"id"`
+		Error []string `json:"error"`
+	}
+	json.Unmarshal(body, &resp)
+	if err == nil {
+		err = apiError(resp.Error)
+	}
+	if rec, ok := e.After.(Record); ok && err == nil && e.RecordID == 0 {
+		e.RecordID, rec.ID = resp.ID, resp.ID
+		e.After = rec
+	}
+
+	e.Time = time.Now()
+	e.Err = err
+	c.Audit(e)
+}
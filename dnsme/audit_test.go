@@ -0,0 +1,186 @@
+package dnsme_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+// newAuditClient returns a client of a new fake server which appends the
+// entries passed to its Audit hook to entries, and counts the requests
+// made in requests.
+func newAuditClient(t *testing.T, version string, entries *[]dnsme.AuditEntry, requests *int32) (*dnsme.Client, *dnsmetest.Server) {
+	t.Helper()
+	s := dnsmetest.NewServer("key", "secret")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		s.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	c := dnsme.NewClient(ts.URL+"/V"+version, "key", "secret")
+	c.Audit = func(e dnsme.AuditEntry) {
+		if e.Time.IsZero() {
+			t.Errorf("%s entry without a time", e.Op)
+		}
+		*entries = append(*entries, e)
+	}
+	return c, s
+}
+
+func TestAudit(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v, func(t *testing.T) {
+			var entries []dnsme.AuditEntry
+			var requests int32
+			c, s := newAuditClient(t, v, &entries, &requests)
+			s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+			r := dnsme.Record{ID: 99, Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"}
+			added, err := c.AddRecord("example.com", r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			updated := added
+			updated.Data = "192.0.2.2"
+			if err := c.ReplaceRecord("example.com", added, updated); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.UpdateRecord("example.com", added); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.RemoveRecord("example.com", added); err != nil {
+				t.Fatal(err)
+			}
+			id := s.AddRecord("example.com", r)
+			if err := c.DeleteRecord("example.com", id); err != nil {
+				t.Fatal(err)
+			}
+
+			// the ID given to AddRecord is ignored
+			r.ID = added.ID
+			want := []dnsme.AuditEntry{
+				{Op: "add-record", Domain: "example.com", RecordID: added.ID, After: r},
+				{Op: "update-record", Domain: "example.com", RecordID: added.ID, Before: added, After: updated},
+				{Op: "update-record", Domain: "example.com", RecordID: added.ID, After: added},
+				{Op: "delete-record", Domain: "example.com", RecordID: added.ID, Before: added},
+				{Op: "delete-record", Domain: "example.com", RecordID: id},
+			}
+			if len(entries) != len(want) {
+				t.Fatalf("%d entries, want %d: %+v", len(entries), len(want), entries)
+			}
+			for i := range want {
+				entries[i].Time = want[i].Time
+				if !reflect.DeepEqual(entries[i], want[i]) {
+					t.Errorf("entry %d = %+v, want %+v", i, entries[i], want[i])
+				}
+			}
+
+			// records are not fetched to be audited
+			max := int32(5)
+			if v == dnsme.V2 {
+				// the ID of the domain is looked up once
+				max++
+			}
+			if requests := atomic.LoadInt32(&requests); requests != max {
+				t.Errorf("%d requests made for 5 changes, want %d", requests, max)
+			}
+		})
+	}
+}
+
+func TestAuditDomains(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v, func(t *testing.T) {
+			var entries []dnsme.AuditEntry
+			var requests int32
+			c, _ := newAuditClient(t, v, &entries, &requests)
+
+			d := dnsme.Domain{Name: "example.com"}
+			if _, err := c.AddDomain(d); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.DeleteDomain("example.com"); err != nil {
+				t.Fatal(err)
+			}
+			want := []dnsme.AuditEntry{
+				{Op: "add-domain", Domain: "example.com", After: d},
+				{Op: "delete-domain", Domain: "example.com"},
+			}
+			for i := range entries {
+				entries[i].Time = want[i].Time
+			}
+			if !reflect.DeepEqual(entries, want) {
+				t.Errorf("entries = %+v, want %+v", entries, want)
+			}
+		})
+	}
+}
+
+func TestAuditFailure(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v, func(t *testing.T) {
+			var entries []dnsme.AuditEntry
+			var requests int32
+			c, s := newAuditClient(t, v, &entries, &requests)
+			s.AddDomain(dnsme.Domain{Name: "example.com"})
+			s.Fail("POST", http.StatusInternalServerError, 1)
+
+			r := dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"}
+			_, err := c.AddRecord("example.com", r)
+			if err == nil {
+				t.Fatal("AddRecord succeeded")
+			}
+			// a change rejected by the API is reported too
+			_, err2 := c.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", TTL: 300, GtdLocation: "DEFAULT"})
+			if err2 == nil {
+				t.Fatal("AddRecord without data succeeded")
+			}
+
+			if len(entries) != 2 || entries[0].Err == nil || entries[0].Err.Error() != err.Error() || entries[1].Err == nil {
+				t.Fatalf("entries = %+v, want the errors %v and %v", entries, err, err2)
+			}
+			if entries[0].RecordID != 0 || !reflect.DeepEqual(entries[0].After, r) {
+				t.Errorf("entry of the failed change = %+v", entries[0])
+			}
+		})
+	}
+}
+
+func TestAuditReadOnly(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v, func(t *testing.T) {
+			var entries []dnsme.AuditEntry
+			var requests int32
+			c, s := newAuditClient(t, v, &entries, &requests)
+			id := s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+			c.ReadOnly = true
+
+			// the V2 ID of the domain is looked up, but nothing is
+			// fetched for the audit
+			r := dnsme.Record{ID: id, Name: "www", Type: "A", Data: "192.0.2.2", TTL: 300, GtdLocation: "DEFAULT"}
+			if err := c.UpdateRecord("example.com", r); err != dnsme.ErrReadOnly {
+				t.Errorf("UpdateRecord: err = %v, want ErrReadOnly", err)
+			}
+			if err := c.DeleteRecord("example.com", id); err != dnsme.ErrReadOnly {
+				t.Errorf("DeleteRecord: err = %v, want ErrReadOnly", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("entries = %+v, want none", entries)
+			}
+
+			max := int32(0)
+			if v == dnsme.V2 {
+				max = 1
+			}
+			if requests := atomic.LoadInt32(&requests); requests > max {
+				t.Errorf("%d requests made, want at most %d", requests, max)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+// Package dnsme is a client for the DNS Made Easy REST API.
+//
+// A Client holds everything needed to talk to a single account: the API
+// base URL, the API key pair and the HTTP client used to make requests.
+// Several clients may be used side by side in the same process.
+package dnsme
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API versions supported by Client.
+const (
+	V1 = "1.2"
+	V2 = "2.0"
+)
+
+const (
+	// Production Values
+	DefaultURL   = "http://api.dnsmadeeasy.com/V1.2"
+	DefaultV2URL = "https://api.dnsmadeeasy.com/V2.0"
+
+	// Development Values
+	SandboxURL   = "http://api.sandbox.dnsmadeeasy.com/V1.2"
+	SandboxV2URL = "https://api.sandbox.dnsmadeeasy.com/V2.0"
+)
+
+var (
+	ErrForbidden   = errors.New("API access forbidden")
+	ErrNotFound    = errors.New("Not found")
+	ErrUnsupported = errors.New("not supported by this API version")
+	ErrReadOnly    = errors.New("client is read-only")
+)
+
+// A Client performs requests against the DNS Made Easy API on behalf of
+// a single account.
+type Client struct {
+	// URL is the base URL of the API, e.g. DefaultURL.
+	URL string
+
+	// Version is the API version spoken at URL, V1 or V2.
+	Version string
+
+	// APIKey and SecretKey are the account's API key pair.
+	APIKey    string
+	SecretKey string
+
+	// HTTPClient is used to perform requests.  If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Debug, if not nil, receives a dump of every raw HTTP request
+	// and response.
+	Debug io.Writer
+
+	// ReadOnly, if set, causes any request which would change the
+	// account (anything but GET) to fail with ErrReadOnly without
+	// being sent.
+	ReadOnly bool
+
+	// MaxWait is the longest a request may wait, in total, for the
+	// rate limit and between retries.  If zero, DefaultMaxWait is used.
+	MaxWait time.Duration
+
+	// Log, if not nil, receives a line whenever a request is held back
+	// by the rate limit or retried.
+	Log io.Writer
+
+	// Audit, if not nil, is called after every request which changes
+	// the account, whether or not it succeeded.  Requests not sent
+	// because the client is ReadOnly are not reported.
+	Audit func(e AuditEntry)
+
+	limiter rateLimiter
+
+	mu        sync.Mutex
+	domainIDs map[string]int // V2 domain IDs by name
+}
+
+// NewClient returns a Client for the API at url, authenticating with the
+// given key pair.  The API version is taken from the last element of the
+// URL path, e.g. ".../V2.0"; anything else is assumed to be V1.
+func NewClient(url, apiKey, secretKey string) *Client {
+	return &Client{
+		URL:       strings.TrimRight(url, "/"),
+		Version:   urlVersion(url),
+		APIKey:    apiKey,
+		SecretKey: secretKey,
+	}
+}
+
+func urlVersion(url string) string {
+	url = strings.TrimRight(url, "/")
+	if strings.HasSuffix(strings.ToUpper(url), "/V"+V2) {
+		return V2
+	}
+	return V1
+}
+
+func (c *Client) v2() bool {
+	return c.Version == V2
+}
+
+// RequestsRemaining returns the number of requests the API reported as
+// remaining in the current rate-limit window on the last response.
+func (c *Client) RequestsRemaining() int {
+	return c.limiter.requestsRemaining()
+}
+
+func (c *Client) maxWait() time.Duration {
+	if c.MaxWait > 0 {
+		return c.MaxWait
+	}
+	return DefaultMaxWait
+}
+
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.Log != nil {
+		fmt.Fprintf(c.Log, "dnsme: "+format+"\n", args...)
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// newRequest builds a request for the API path p.  If body is not nil,
+// it is JSON encoded and sent as the request body.
+func (c *Client) newRequest(method, p string, body interface{}) (req *http.Request, err error) {
+
+	var rd io.Reader
+	if body != nil {
+		var buf bytes.Buffer
+		err = json.NewEncoder(&buf).Encode(body)
+		if err != nil {
+			return
+		}
+		rd = &buf
+	}
+
+	req, err = http.NewRequest(method, c.URL+p, rd)
+	if err != nil {
+		return
+	}
+
+	if body != nil {
+		req.Header.Add("content-type", "application/json")
+	}
+
+	return
+}
+
+// sign adds the authentication headers required by the API.
+func (c *Client) sign(r *http.Request) {
+	r.Header.Set("x-dnsme-apiKey", c.APIKey)
+
+	requestDate := time.Now().UTC().Format(time.RFC1123)
+	r.Header.Set("x-dnsme-requestDate", requestDate)
+
+	h := hmac.New(sha1.New, []byte(c.SecretKey))
+	h.Write([]byte(requestDate))
+	r.Header.Set("x-dnsme-hmac", fmt.Sprintf("%x", h.Sum(nil)))
+
+	r.Header.Set("Accept", "application/json")
+}
+
+/*
+ * do() performs http requests that are built by API methods, decoding
+ * the JSON response body into into (if not nil).  The outcome of changes
+ * built by newChange is passed to the Audit hook.
+ */
+func (c *Client) do(r *http.Request, into interface{}) (err error) {
+
+	if c.ReadOnly && r.Method != "GET" {
+		err = ErrReadOnly
+		return
+	}
+
+	var body []byte
+	defer func() {
+		c.audit(r, body, err)
+	}()
+
+	resp, err := c.send(r)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusForbidden {
+		err = ErrForbidden
+		return
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		err = ErrNotFound
+		return
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode >= 400 {
+		var e struct {
+			Error []string `json:"error"`
+		}
+		json.Unmarshal(body, &e)
+		err = apiError(e.Error)
+		if err == nil {
+			err = fmt.Errorf("API request failed: %s", resp.Status)
+		}
+		return
+	}
+
+	// some requests (updates, deletes) return an empty body
+	if into == nil || len(bytes.TrimSpace(body)) == 0 {
+		return
+	}
+
+	err = json.Unmarshal(body, into)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// send performs r, scheduling it within the API rate limit.  Requests
+// rejected for exceeding the limit are retried once the limit allows,
+// or after the time given by Retry-After.  Transport errors and server
+// errors are retried with exponential backoff, unless the request is
+// not idempotent.  send gives up once the total wait would exceed
+// MaxWait, returning the last response or error.
+func (c *Client) send(r *http.Request) (resp *http.Response, err error) {
+
+	var waited time.Duration
+
+	for attempt := 0; ; attempt++ {
+		// a request is only reserved if it can be made within MaxWait
+		if wait, ok := c.limiter.take(c.maxWait() - waited); !ok {
+			err = fmt.Errorf("%s %s: rate limit would be exceeded for more than %s", r.Method, r.URL.Path, c.maxWait())
+			return
+		} else if wait > 0 {
+			c.logf("rate limit reached, waiting %s", wait.Round(time.Millisecond))
+			time.Sleep(wait)
+			waited += wait
+		}
+
+		if attempt > 0 && r.GetBody != nil {
+			r.Body, err = r.GetBody()
+			if err != nil {
+				return
+			}
+		}
+
+		c.sign(r)
+
+		if c.Debug != nil {
+			dump, d_err := httputil.DumpRequestOut(r, true)
+			if d_err == nil {
+				c.Debug.Write(dump)
+			}
+		}
+
+		resp, err = c.httpClient().Do(r)
+
+		var wait time.Duration
+		var reason string
+		switch {
+		case err != nil:
+			if !idempotent(r.Method) {
+				return
+			}
+			wait, reason = backoff(attempt), err.Error()
+			if e, ok := err.(*url.Error); ok {
+				reason = e.Err.Error()
+			}
+		case throttled(resp):
+			c.limiter.update(resp.Header)
+			wait, reason = retryAfter(resp.Header), "rate limit exceeded"
+			if wait == 0 {
+				wait = c.limiter.wait()
+			}
+		case resp.StatusCode >= 500 && idempotent(r.Method):
+			c.limiter.update(resp.Header)
+			wait, reason = retryAfter(resp.Header), resp.Status
+			if wait == 0 {
+				wait = backoff(attempt)
+			}
+		default:
+			c.limiter.update(resp.Header)
+			if c.Debug != nil {
+				dump, d_err := httputil.DumpResponse(resp, true)
+				if d_err == nil {
+					c.Debug.Write(dump)
+				}
+			}
+			return
+		}
+
+		if waited+wait > c.maxWait() {
+			if err != nil {
+				err = fmt.Errorf("giving up after %d attempts: %s", attempt+1, err)
+			}
+			return
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		c.logf("%s %s: %s, retrying in %s", r.Method, r.URL.Path, reason, wait.Round(time.Millisecond))
+		time.Sleep(wait)
+		waited += wait
+	}
+}
+
+// apiError converts the error messages included in an API response
+// into an error.
+func apiError(msgs []string) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, " "))
+}
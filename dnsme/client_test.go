@@ -0,0 +1,354 @@
+package dnsme_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+// newTestClient returns a client for the given API version of a new
+// fake server.
+func newTestClient(t *testing.T, version string) (*dnsme.Client, *dnsmetest.Server) {
+	t.Helper()
+	s := dnsmetest.NewServer("key", "secret")
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	return dnsme.NewClient(ts.URL+"/V"+version, "key", "secret"), s
+}
+
+var versions = []string{dnsme.V1, dnsme.V2}
+
+func TestNewClientVersion(t *testing.T) {
+	for url, want := range map[string]string{
+		dnsme.DefaultURL:             dnsme.V1,
+		dnsme.DefaultV2URL:           dnsme.V2,
+		dnsme.DefaultV2URL + "/":     dnsme.V2,
+		"https://example.com/v2.0":   dnsme.V2,
+		"https://example.com/api":    dnsme.V1,
+		"https://example.com/V2.0.1": dnsme.V1,
+	} {
+		if got := dnsme.NewClient(url, "k", "s").Version; got != want {
+			t.Errorf("NewClient(%q).Version = %q, want %q", url, got, want)
+		}
+	}
+}
+
+func TestDomains(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v, func(t *testing.T) {
+			c, _ := newTestClient(t, v)
+
+			info, err := c.AddDomain(dnsme.Domain{Name: "example.com"})
+			if err != nil {
+				t.Fatalf("AddDomain: %v", err)
+			}
+			if info.Name != "example.com" || len(info.NameServers) == 0 {
+				t.Errorf("AddDomain = %+v, want example.com with nameservers", info)
+			}
+			if _, err := c.AddDomain(dnsme.Domain{Name: "example.org"}); err != nil {
+				t.Fatalf("AddDomain: %v", err)
+			}
+
+			domains, err := c.Domains()
+			if err != nil {
+				t.Fatalf("Domains: %v", err)
+			}
+			if strings.Join(domains, " ") != "example.com example.org" {
+				t.Errorf("Domains = %q", domains)
+			}
+
+			info, err = c.Domain("example.org")
+			if err != nil || info.Name != "example.org" {
+				t.Errorf("Domain = %+v, %v", info, err)
+			}
+
+			if err := c.DeleteDomain("example.org"); err != nil {
+				t.Fatalf("DeleteDomain: %v", err)
+			}
+			if _, err := c.Domain("example.org"); err != dnsme.ErrNotFound {
+				t.Errorf("Domain after DeleteDomain: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestRecords(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v, func(t *testing.T) {
+			c, s := newTestClient(t, v)
+			s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+			add := []dnsme.Record{
+				{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"},
+				{Name: "", Type: "MX", Data: "10 mail.example.com.", TTL: 3600, GtdLocation: "DEFAULT"},
+				{Name: "_sip._tcp", Type: "SRV", Data: "10 20 5060 sip.example.com.", TTL: 3600, GtdLocation: "DEFAULT"},
+			}
+			var ids []int
+			for _, r := range add {
+				added, err := c.AddRecord("example.com", r)
+				if err != nil {
+					t.Fatalf("AddRecord(%+v): %v", r, err)
+				}
+				if added.ID == 0 || added.Data != r.Data {
+					t.Errorf("AddRecord = %+v, want data %q and an ID", added, r.Data)
+				}
+				ids = append(ids, added.ID)
+			}
+
+			records, err := c.Records("example.com", nil)
+			if err != nil {
+				t.Fatalf("Records: %v", err)
+			}
+			if len(records) != len(add) {
+				t.Fatalf("Records returned %d records, want %d", len(records), len(add))
+			}
+			for i, r := range records {
+				if r.Data != add[i].Data || r.Type != add[i].Type {
+					t.Errorf("record %d = %+v, want %+v", i, r, add[i])
+				}
+			}
+
+			records, err = c.Records("example.com", url.Values{"type": {"MX"}})
+			if err != nil || len(records) != 1 || records[0].Type != "MX" {
+				t.Errorf("Records(type=MX) = %+v, %v", records, err)
+			}
+
+			r, err := c.Record("example.com", ids[0])
+			if err != nil || r.Name != "www" {
+				t.Fatalf("Record = %+v, %v", r, err)
+			}
+
+			r.Data = "192.0.2.2"
+			if err := c.UpdateRecord("example.com", r); err != nil {
+				t.Fatalf("UpdateRecord: %v", err)
+			}
+			if got := s.Records("example.com")[0].Data; got != "192.0.2.2" {
+				t.Errorf("data after UpdateRecord = %q", got)
+			}
+
+			if err := c.DeleteRecord("example.com", ids[1]); err != nil {
+				t.Fatalf("DeleteRecord: %v", err)
+			}
+			if n := len(s.Records("example.com")); n != 2 {
+				t.Errorf("%d records after DeleteRecord, want 2", n)
+			}
+		})
+	}
+}
+
+func TestV2Pages(t *testing.T) {
+	c, s := newTestClient(t, dnsme.V2)
+	s.PageSize = 2
+	for i := 0; i < 5; i++ {
+		s.AddRecord("example.com", dnsme.Record{Name: "host" + string(rune('a'+i)), Type: "A", Data: "192.0.2.1", TTL: 60})
+	}
+	s.AddDomain(dnsme.Domain{Name: "example.org"})
+	s.AddDomain(dnsme.Domain{Name: "example.net"})
+
+	records, err := c.Records("example.com", nil)
+	if err != nil || len(records) != 5 {
+		t.Errorf("Records = %d records, %v; want 5", len(records), err)
+	}
+	domains, err := c.Domains()
+	if err != nil || len(domains) != 3 {
+		t.Errorf("Domains = %q, %v; want 3 domains", domains, err)
+	}
+}
+
+func TestForbidden(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v, func(t *testing.T) {
+			c, _ := newTestClient(t, v)
+			c.SecretKey = "wrong"
+			if _, err := c.Domains(); err != dnsme.ErrForbidden {
+				t.Errorf("Domains with the wrong secret: err = %v, want ErrForbidden", err)
+			}
+
+			c.SecretKey = "secret"
+			if _, err := c.Domains(); err != nil {
+				t.Errorf("Domains: %v", err)
+			}
+		})
+	}
+}
+
+func TestInjectedFailures(t *testing.T) {
+	c, s := newTestClient(t, dnsme.V1)
+	s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+	s.Fail("GET", http.StatusForbidden, 1)
+	if _, err := c.Domains(); err != dnsme.ErrForbidden {
+		t.Errorf("err = %v, want ErrForbidden", err)
+	}
+
+	s.Fail("GET", http.StatusNotFound, 1)
+	if _, err := c.Domain("example.com"); err != dnsme.ErrNotFound {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+
+	// server errors are retried for idempotent requests only
+	s.Fail("GET", http.StatusInternalServerError, 1)
+	if _, err := c.Domains(); err != nil {
+		t.Errorf("GET after a 500: %v", err)
+	}
+	s.Fail("POST", http.StatusInternalServerError, 1)
+	if _, err := c.AddRecord("example.com", dnsme.Record{Type: "A", Data: "192.0.2.1", TTL: 60}); err == nil {
+		t.Error("POST after a 500 succeeded; it should not be retried")
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	for _, v := range versions {
+		t.Run(v, func(t *testing.T) {
+			c, s := newTestClient(t, v)
+			s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+			if _, err := c.Domain("example.org"); err != dnsme.ErrNotFound {
+				t.Errorf("Domain: err = %v, want ErrNotFound", err)
+			}
+			if _, err := c.Record("example.com", 12345); err != dnsme.ErrNotFound {
+				t.Errorf("Record: err = %v, want ErrNotFound", err)
+			}
+			if err := c.DeleteRecord("example.com", 12345); err != dnsme.ErrNotFound {
+				t.Errorf("DeleteRecord: err = %v, want ErrNotFound", err)
+			}
+		})
+	}
+}
+
+func TestEmptyCNAMEData(t *testing.T) {
+	c, s := newTestClient(t, dnsme.V1)
+	id := s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "CNAME", Data: "example.com.", TTL: 60, GtdLocation: "DEFAULT"})
+
+	records, err := c.Records("example.com", nil)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("Records = %+v, %v", records, err)
+	}
+	if records[0].Data != "example.com." {
+		t.Errorf("Records: CNAME data = %q, want example.com.", records[0].Data)
+	}
+
+	r, err := c.Record("example.com", id)
+	if err != nil || r.Data != "example.com." {
+		t.Errorf("Record = %+v, %v; want data example.com.", r, err)
+	}
+
+	// the record read back can be written back
+	if err := c.UpdateRecord("example.com", r); err != nil {
+		t.Errorf("UpdateRecord: %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	c, s := newTestClient(t, dnsme.V1)
+	// 10 requests a second, as the client assumes a window of RateWindow
+	s.RequestLimit = int(dnsme.RateWindow / (100 * time.Millisecond))
+	s.Window = 200 * time.Millisecond
+	s.ExhaustRequests()
+
+	var log strings.Builder
+	c.Log = &log
+
+	// rejected requests are retried once the window allows
+	start := time.Now()
+	if _, err := c.Domains(); err != nil {
+		t.Fatalf("Domains: %v", err)
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Errorf("request with no requests remaining took only %s", d)
+	}
+	if !strings.Contains(log.String(), "rate limit exceeded") {
+		t.Errorf("log = %q, want a rate limit message", log.String())
+	}
+	if n := c.RequestsRemaining(); n != s.RequestLimit-1 {
+		t.Errorf("RequestsRemaining = %d, want %d", n, s.RequestLimit-1)
+	}
+}
+
+func TestRateLimitMaxWait(t *testing.T) {
+	c, s := newTestClient(t, dnsme.V1)
+	s.Window = time.Hour
+	s.ExhaustRequests()
+	c.MaxWait = 100 * time.Millisecond
+
+	start := time.Now()
+	if _, err := c.Domains(); err == nil {
+		t.Fatal("request succeeded with no requests remaining")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("request took %s to give up with a MaxWait of 100ms", d)
+	}
+	if c.RequestsRemaining() != 0 {
+		t.Errorf("RequestsRemaining = %d, want 0", c.RequestsRemaining())
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	c, s := newTestClient(t, dnsme.V1)
+	s.AddDomain(dnsme.Domain{Name: "example.com"})
+	c.ReadOnly = true
+
+	if _, err := c.Domains(); err != nil {
+		t.Errorf("Domains: %v", err)
+	}
+	_, err := c.AddRecord("example.com", dnsme.Record{Type: "A", Data: "192.0.2.1", TTL: 60, GtdLocation: "DEFAULT"})
+	if err != dnsme.ErrReadOnly {
+		t.Errorf("AddRecord: err = %v, want ErrReadOnly", err)
+	}
+	if n := len(s.Records("example.com")); n != 0 {
+		t.Errorf("%d records added by a read-only client", n)
+	}
+}
+
+func TestSecondaries(t *testing.T) {
+	c, _ := newTestClient(t, dnsme.V1)
+
+	if _, err := c.AddSecondary(dnsme.Secondary{Name: "example.net", IP: []string{"192.0.2.53"}}); err != nil {
+		t.Fatalf("AddSecondary: %v", err)
+	}
+	list, err := c.Secondaries()
+	if err != nil || len(list) != 1 || list[0] != "example.net" {
+		t.Errorf("Secondaries = %q, %v", list, err)
+	}
+	info, err := c.Secondary("example.net")
+	if err != nil || len(info.IP) != 1 {
+		t.Errorf("Secondary = %+v, %v", info, err)
+	}
+	if err := c.DeleteSecondary("example.net"); err != nil {
+		t.Errorf("DeleteSecondary: %v", err)
+	}
+
+	c2, _ := newTestClient(t, dnsme.V2)
+	if _, err := c2.Secondaries(); err != dnsme.ErrUnsupported {
+		t.Errorf("V2 Secondaries: err = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestAddRecordUnchecked(t *testing.T) {
+	for _, v := range versions {
+		c, s := newTestClient(t, v)
+		s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+		// types Validate does not know are left to the API
+		r := dnsme.Record{Name: "", Type: "CAA", Data: `0 issue "letsencrypt.org"`, TTL: 300, GtdLocation: "DEFAULT"}
+		added, err := c.AddRecord("example.com", r)
+		if err != nil {
+			t.Fatalf("%s: AddRecord of a CAA record: %v", v, err)
+		}
+		added.TTL = 600
+		if err := c.UpdateRecord("example.com", added); err != nil {
+			t.Errorf("%s: UpdateRecord of a CAA record: %v", v, err)
+		}
+
+		// and so is an invalid record
+		if _, err := c.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", TTL: 300}); err == nil || strings.Contains(err.Error(), "invalid A record") {
+			t.Errorf("%s: AddRecord without data: err = %v, want the API's error", v, err)
+		}
+	}
+}
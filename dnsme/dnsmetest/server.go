@@ -0,0 +1,606 @@
+// Package dnsmetest provides an in-memory implementation of the DNS Made
+// Easy V1.2 and V2.0 REST APIs, for use in tests and for working offline.
+//
+// A Server is an http.Handler, so it can be used with httptest:
+//
+//	fake := dnsmetest.NewServer("key", "secret")
+//	ts := httptest.NewServer(fake)
+//	defer ts.Close()
+//	c := dnsme.NewClient(ts.URL+"/V1.2", "key", "secret")
+//
+// Both versions serve the same domains and records, at ts.URL+"/V1.2"
+// and ts.URL+"/V2.0".  Secondary domains are only served by V1.2.
+package dnsmetest
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+const (
+	// DefaultRequestLimit and DefaultWindow mirror the limits of the
+	// production API.
+	DefaultRequestLimit = 150
+	DefaultWindow       = 5 * time.Minute
+
+	// MaxClockSkew is the largest difference allowed between the
+	// x-dnsme-requestDate header and the server's clock.
+	MaxClockSkew = 5 * time.Minute
+
+	// DefaultPageSize is the number of items in each page of a V2.0
+	// list.
+	DefaultPageSize = 100
+
+	// DynamicPath is the path of the dynamic DNS update service, for
+	// use as the URL of a dnsme.DynamicRecord.
+	DynamicPath = "/servlet/updateip"
+)
+
+// A Server is a fake DNS Made Easy API holding domains, secondaries and
+// records in memory.
+type Server struct {
+	// APIKey and SecretKey are the key pair requests must be signed
+	// with.
+	APIKey    string
+	SecretKey string
+
+	// Username is the username of the account, which dynamic DNS
+	// updates must give.  If empty, any username is accepted.
+	Username string
+
+	// RequestLimit is the number of requests allowed per Window.  A
+	// request beyond the limit is rejected, and reports zero requests
+	// remaining.  If RequestLimit is zero, requests are not limited.
+	RequestLimit int
+	Window       time.Duration
+
+	// EmptyCNAMEData reproduces a quirk of the API: CNAME records
+	// pointing at the domain itself are returned with empty data.
+	EmptyCNAMEData bool
+
+	// PageSize is the number of items in each page of a V2.0 list.  If
+	// zero, lists are returned in a single page.
+	PageSize int
+
+	// Now returns the current time; it defaults to time.Now.
+	Now func() time.Time
+
+	mu          sync.Mutex
+	domains     map[string]*zone
+	secondaries map[string]dnsme.Secondary
+	lastID      int
+	used        int
+	windowStart time.Time
+	failures    []failure
+}
+
+type zone struct {
+	id      int // V2.0 domain ID
+	info    dnsme.Domain
+	records []dnsme.Record
+}
+
+type failure struct {
+	method string
+	status int
+}
+
+// NewServer returns an empty Server accepting requests signed with the
+// given key pair.
+func NewServer(apiKey, secretKey string) *Server {
+	return &Server{
+		APIKey:         apiKey,
+		SecretKey:      secretKey,
+		RequestLimit:   DefaultRequestLimit,
+		Window:         DefaultWindow,
+		EmptyCNAMEData: true,
+		PageSize:       DefaultPageSize,
+		domains:        make(map[string]*zone),
+		secondaries:    make(map[string]dnsme.Secondary),
+	}
+}
+
+// AddDomain adds the domain d, replacing any domain of the same name
+// along with its records.
+func (s *Server) AddDomain(d dnsme.Domain) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addDomain(d)
+}
+
+func (s *Server) addDomain(d dnsme.Domain) *zone {
+	if len(d.NameServers) == 0 {
+		d.NameServers = []string{"ns0.dnsmadeeasy.com", "ns1.dnsmadeeasy.com", "ns2.dnsmadeeasy.com"}
+	}
+	if d.VanityNameServers == nil {
+		d.VanityNameServers = []string{}
+	}
+	d.Error = nil
+	s.lastID++
+	z := &zone{id: s.lastID, info: d, records: []dnsme.Record{}}
+	s.domains[d.Name] = z
+	return z
+}
+
+// AddRecord adds r to domain, assigning it a new ID which is returned.
+// The domain is created if it does not exist.
+func (s *Server) AddRecord(domain string, r dnsme.Record) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, ok := s.domains[domain]
+	if !ok {
+		z = s.addDomain(dnsme.Domain{Name: domain})
+	}
+	s.lastID++
+	r.ID = s.lastID
+	r.Error = nil
+	z.records = append(z.records, r)
+	return r.ID
+}
+
+// AddSecondary adds the secondary domain sec.
+func (s *Server) AddSecondary(sec dnsme.Secondary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sec.Error = nil
+	s.secondaries[sec.Name] = sec
+}
+
+// Records returns a copy of the records stored for domain, ordered by
+// ID.
+func (s *Server) Records(domain string) []dnsme.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z, ok := s.domains[domain]
+	if !ok {
+		return nil
+	}
+	records := make([]dnsme.Record, len(z.records))
+	copy(records, z.records)
+	sort.Sort(byID(records))
+	return records
+}
+
+// Fail causes the next n requests using method to be answered with the
+// given HTTP status, e.g. http.StatusForbidden.  An empty method
+// matches any request.
+func (s *Server) Fail(method string, status, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, failure{method, status})
+	}
+}
+
+// ExhaustRequests uses up the remaining requests in the current
+// rate-limit window.
+func (s *Server) ExhaustRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remaining()
+	s.used = s.RequestLimit
+}
+
+func (s *Server) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// remaining returns the requests left in the current window, starting a
+// new window if the previous one has expired.
+func (s *Server) remaining() int {
+	if s.RequestLimit == 0 {
+		return DefaultRequestLimit
+	}
+	if now := s.now(); now.Sub(s.windowStart) >= s.Window {
+		s.windowStart = now
+		s.used = 0
+	}
+	return s.RequestLimit - s.used
+}
+
+// authorized checks the headers added by dnsme.Client when signing a
+// request.
+func (s *Server) authorized(r *http.Request) bool {
+	if r.Header.Get("x-dnsme-apiKey") != s.APIKey {
+		return false
+	}
+
+	requestDate := r.Header.Get("x-dnsme-requestDate")
+	t, err := time.Parse(time.RFC1123, requestDate)
+	if err != nil {
+		return false
+	}
+	skew := s.now().Sub(t)
+	if skew > MaxClockSkew || skew < -MaxClockSkew {
+		return false
+	}
+
+	h := hmac.New(sha1.New, []byte(s.SecretKey))
+	h.Write([]byte(requestDate))
+	return hmac.Equal([]byte(r.Header.Get("x-dnsme-hmac")), []byte(fmt.Sprintf("%x", h.Sum(nil))))
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// dynamic DNS updates are not part of the API, and are not signed
+	if r.URL.Path == DynamicPath {
+		s.updateIP(w, r)
+		return
+	}
+
+	remaining := s.remaining()
+	limited := s.RequestLimit > 0 && remaining == 0
+	if s.RequestLimit > 0 && !limited {
+		s.used++
+		remaining--
+	}
+	w.Header().Set("x-dnsme-requestLimit", strconv.Itoa(s.RequestLimit))
+	w.Header().Set("x-dnsme-requestsRemaining", strconv.Itoa(remaining))
+
+	for i, f := range s.failures {
+		if f.method == "" || f.method == r.Method {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			writeError(w, f.status, http.StatusText(f.status))
+			return
+		}
+	}
+
+	if limited {
+		writeError(w, http.StatusBadRequest, "Rate limit exceeded")
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusForbidden, "API access forbidden")
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/V2.0/") {
+		s.serveV2(w, r, strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/V2.0"), "/"), "/"))
+		return
+	}
+
+	// V1.2 requests may be made against the base URL with or without
+	// the version, e.g. /V1.2/domains/ or /domains/
+	p := strings.TrimPrefix(r.URL.Path, "/V1.2")
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+
+	switch {
+	case len(parts) == 1 && parts[0] == "domains":
+		s.listDomains(w, r)
+	case len(parts) == 2 && parts[0] == "domains":
+		s.domain(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "domains" && parts[2] == "records":
+		s.records(w, r, parts[1])
+	case len(parts) == 4 && parts[0] == "domains" && parts[2] == "records":
+		s.record(w, r, parts[1], parts[3])
+	case len(parts) == 1 && parts[0] == "secondary":
+		s.listSecondaries(w, r)
+	case len(parts) == 2 && parts[0] == "secondary":
+		s.secondary(w, r, parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) listDomains(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w)
+		return
+	}
+
+	list := []string{}
+	for name := range s.domains {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	writeJSON(w, http.StatusOK, map[string][]string{"list": list})
+}
+
+func (s *Server) domain(w http.ResponseWriter, r *http.Request, name string) {
+	z, ok := s.domains[name]
+
+	switch r.Method {
+	case "GET":
+		if !ok {
+			notFound(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, z.info)
+	case "PUT":
+		if ok {
+			writeError(w, http.StatusBadRequest, "Domain already exists.")
+			return
+		}
+		var d dnsme.Domain
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		d.Name = name
+		z = s.addDomain(d)
+		writeJSON(w, http.StatusCreated, z.info)
+	case "DELETE":
+		if !ok {
+			notFound(w)
+			return
+		}
+		delete(s.domains, name)
+		w.WriteHeader(http.StatusOK)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) records(w http.ResponseWriter, r *http.Request, domain string) {
+	z, ok := s.domains[domain]
+	if !ok {
+		notFound(w)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		records := []dnsme.Record{}
+		for _, rec := range z.records {
+			if match(rec, r.URL.Query()) {
+				records = append(records, s.response(domain, rec))
+			}
+		}
+		sort.Sort(byID(records))
+		writeJSON(w, http.StatusOK, records)
+	case "POST":
+		var rec dnsme.Record
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		if msgs := validate(rec); len(msgs) > 0 {
+			writeError(w, http.StatusBadRequest, msgs...)
+			return
+		}
+		for _, existing := range z.records {
+			if existing.Name == rec.Name && existing.Type == rec.Type && existing.Data == rec.Data && existing.GtdLocation == rec.GtdLocation {
+				writeError(w, http.StatusBadRequest, "Record with this type, name, and value already exists.")
+				return
+			}
+		}
+		s.lastID++
+		rec.ID = s.lastID
+		rec.Error = nil
+		z.records = append(z.records, rec)
+		writeJSON(w, http.StatusCreated, s.response(domain, rec))
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) record(w http.ResponseWriter, r *http.Request, domain, id string) {
+	z, ok := s.domains[domain]
+	if !ok {
+		notFound(w)
+		return
+	}
+
+	i := z.index(id)
+	if i < 0 {
+		notFound(w)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, s.response(domain, z.records[i]))
+	case "PUT":
+		var rec dnsme.Record
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		if msgs := validate(rec); len(msgs) > 0 {
+			writeError(w, http.StatusBadRequest, msgs...)
+			return
+		}
+		rec.ID = z.records[i].ID
+		rec.Error = nil
+		z.records[i] = rec
+		w.WriteHeader(http.StatusOK)
+	case "DELETE":
+		z.records = append(z.records[:i], z.records[i+1:]...)
+		w.WriteHeader(http.StatusOK)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// index returns the index of the record with the ID given in a path, or
+// -1 if there is none.
+func (z *zone) index(id string) int {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return -1
+	}
+	for i, rec := range z.records {
+		if rec.ID == n {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) listSecondaries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w)
+		return
+	}
+
+	list := []string{}
+	for name := range s.secondaries {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	writeJSON(w, http.StatusOK, map[string][]string{"list": list})
+}
+
+func (s *Server) secondary(w http.ResponseWriter, r *http.Request, name string) {
+	sec, ok := s.secondaries[name]
+
+	switch r.Method {
+	case "GET":
+		if !ok {
+			notFound(w)
+			return
+		}
+		writeJSON(w, http.StatusOK, sec)
+	case "PUT":
+		if err := json.NewDecoder(r.Body).Decode(&sec); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		if len(sec.IP) == 0 {
+			writeError(w, http.StatusBadRequest, "At least one IP address is required.")
+			return
+		}
+		sec.Name = name
+		sec.Error = nil
+		s.secondaries[name] = sec
+		writeJSON(w, http.StatusCreated, sec)
+	case "DELETE":
+		if !ok {
+			notFound(w)
+			return
+		}
+		delete(s.secondaries, name)
+		w.WriteHeader(http.StatusOK)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// response returns rec as the API would present it.
+// updateIP serves a dynamic DNS update, which sets the address of an A
+// or AAAA record given its ID and dynamic DNS password.
+func (s *Server) updateIP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id, _ := strconv.Atoi(q.Get("id"))
+	ip := net.ParseIP(q.Get("ip"))
+
+	for _, z := range s.domains {
+		for i, rec := range z.records {
+			if rec.ID != id || id == 0 {
+				continue
+			}
+			switch {
+			case rec.Password == "" || (s.Username != "" && q.Get("username") != s.Username) || q.Get("password") != rec.Password:
+				fmt.Fprintln(w, "error-auth")
+			case ip == nil || (rec.Type != "A" && rec.Type != "AAAA") || (ip.To4() == nil) != (rec.Type == "AAAA"):
+				fmt.Fprintln(w, "error-record-invalid")
+			case rec.Data == ip.String():
+				fmt.Fprintln(w, "error-record-ip-same")
+			default:
+				z.records[i].Data = ip.String()
+				fmt.Fprintln(w, "success")
+			}
+			return
+		}
+	}
+	fmt.Fprintln(w, "error-record-invalid")
+}
+
+func (s *Server) response(domain string, rec dnsme.Record) dnsme.Record {
+	if s.EmptyCNAMEData && rec.Type == "CNAME" && rec.Data == domain+"." {
+		rec.Data = ""
+	}
+	return rec
+}
+
+func validate(rec dnsme.Record) (msgs []string) {
+	switch rec.Type {
+	case "A", "AAAA", "ANAME", "CAA", "CNAME", "HTTPRED", "MX", "NS", "PTR", "SPF", "SRV", "TXT":
+	default:
+		msgs = append(msgs, "Invalid record type.")
+	}
+	if rec.Data == "" {
+		msgs = append(msgs, "Record data is required.")
+	}
+	if rec.TTL <= 0 {
+		msgs = append(msgs, "TTL must be a positive number.")
+	}
+	if rec.Type == "HTTPRED" {
+		switch rec.RedirectType {
+		case dnsme.RedirectHidden, dnsme.Redirect301, dnsme.Redirect302:
+		default:
+			msgs = append(msgs, "Invalid redirect type.")
+		}
+	}
+	return
+}
+
+func match(rec dnsme.Record, q url.Values) bool {
+	for k := range q {
+		v := q.Get(k)
+		var ok bool
+		switch k {
+		case "gtdLocation":
+			ok = rec.GtdLocation == v
+		case "type":
+			ok = rec.Type == v
+		case "name":
+			ok = rec.Name == v
+		case "nameContains":
+			ok = strings.Contains(rec.Name, v)
+		case "value":
+			ok = rec.Data == v
+		case "valueContains":
+			ok = strings.Contains(rec.Data, v)
+		default:
+			ok = true
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+type byID []dnsme.Record
+
+func (r byID) Len() int           { return len(r) }
+func (r byID) Less(i, j int) bool { return r[i].ID < r[j].ID }
+func (r byID) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msgs ...string) {
+	writeJSON(w, status, map[string][]string{"error": msgs})
+}
+
+func notFound(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, "Method not allowed.")
+}
@@ -0,0 +1,135 @@
+package dnsmetest
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// request performs a request signed with key and secret at time t.
+func request(s *Server, method, path, key, secret string, t time.Time) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	date := t.UTC().Format(time.RFC1123)
+	h := hmac.New(sha1.New, []byte(secret))
+	h.Write([]byte(date))
+	r.Header.Set("x-dnsme-apiKey", key)
+	r.Header.Set("x-dnsme-requestDate", date)
+	r.Header.Set("x-dnsme-hmac", fmt.Sprintf("%x", h.Sum(nil)))
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthorization(t *testing.T) {
+	s := NewServer("key", "secret")
+	now := time.Now()
+
+	for _, tt := range []struct {
+		key, secret string
+		t           time.Time
+		status      int
+	}{
+		{"key", "secret", now, http.StatusOK},
+		{"other", "secret", now, http.StatusForbidden},
+		{"key", "other", now, http.StatusForbidden},
+		{"key", "secret", now.Add(-MaxClockSkew - time.Minute), http.StatusForbidden},
+		{"key", "secret", now.Add(MaxClockSkew + time.Minute), http.StatusForbidden},
+	} {
+		w := request(s, "GET", "/V1.2/domains/", tt.key, tt.secret, tt.t)
+		if w.Code != tt.status {
+			t.Errorf("key %q, secret %q, date %s: status %d, want %d", tt.key, tt.secret, tt.t, w.Code, tt.status)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/V1.2/domains/", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("unsigned request: status %d, want 403", w.Code)
+	}
+}
+
+func TestRequestLimit(t *testing.T) {
+	s := NewServer("key", "secret")
+	s.RequestLimit = 3
+	now := time.Now()
+	s.Now = func() time.Time { return now }
+
+	for i := 2; i >= 0; i-- {
+		w := request(s, "GET", "/V1.2/domains/", "key", "secret", now)
+		if w.Code != http.StatusOK || w.Header().Get("x-dnsme-requestsRemaining") != strconv.Itoa(i) {
+			t.Errorf("status %d, %s remaining; want 200, %d remaining", w.Code, w.Header().Get("x-dnsme-requestsRemaining"), i)
+		}
+	}
+	w := request(s, "GET", "/V1.2/domains/", "key", "secret", now)
+	if w.Code != http.StatusBadRequest || w.Header().Get("x-dnsme-requestsRemaining") != "0" {
+		t.Errorf("request over the limit: status %d, %s remaining; want 400, 0 remaining", w.Code, w.Header().Get("x-dnsme-requestsRemaining"))
+	}
+
+	// the next window starts afresh
+	now = now.Add(s.Window)
+	w = request(s, "GET", "/V1.2/domains/", "key", "secret", now)
+	if w.Code != http.StatusOK {
+		t.Errorf("request in the next window: status %d, want 200", w.Code)
+	}
+}
+
+func TestEmptyCNAMEData(t *testing.T) {
+	s := NewServer("key", "secret")
+	s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "CNAME", Data: "example.com.", TTL: 60})
+	s.AddRecord("example.com", dnsme.Record{Name: "ftp", Type: "CNAME", Data: "www.example.com.", TTL: 60})
+
+	for quirk, want := range map[bool]string{true: "", false: "example.com."} {
+		s.EmptyCNAMEData = quirk
+		w := request(s, "GET", "/V1.2/domains/example.com/records", "key", "secret", time.Now())
+		var records []dnsme.Record
+		if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil || len(records) != 2 {
+			t.Fatalf("records = %s, %v", w.Body, err)
+		}
+		if records[0].Data != want || records[1].Data != "www.example.com." {
+			t.Errorf("EmptyCNAMEData %t: data %q and %q, want %q and www.example.com.", quirk, records[0].Data, records[1].Data, want)
+		}
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	s := NewServer("key", "secret")
+	s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 60})
+
+	for _, path := range []string{
+		"/V1.2/domains/example.org",
+		"/V1.2/domains/example.org/records",
+		"/V1.2/domains/example.com/records/999",
+		"/V1.2/secondary/example.net",
+		"/V2.0/dns/managed/999/records/",
+		"/V2.0/dns/managed/name?domainname=example.org",
+		"/V1.2/unknown",
+	} {
+		if w := request(s, "GET", path, "key", "secret", time.Now()); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want 404", path, w.Code)
+		}
+	}
+}
+
+func TestFail(t *testing.T) {
+	s := NewServer("key", "secret")
+	s.Fail("DELETE", http.StatusInternalServerError, 1)
+
+	if w := request(s, "GET", "/V1.2/domains/", "key", "secret", time.Now()); w.Code != http.StatusOK {
+		t.Errorf("GET: status %d, want 200", w.Code)
+	}
+	if w := request(s, "DELETE", "/V1.2/domains/example.com", "key", "secret", time.Now()); w.Code != http.StatusInternalServerError {
+		t.Errorf("DELETE: status %d, want 500", w.Code)
+	}
+	if w := request(s, "DELETE", "/V1.2/domains/example.com", "key", "secret", time.Now()); w.Code != http.StatusNotFound {
+		t.Errorf("second DELETE: status %d, want 404", w.Code)
+	}
+}
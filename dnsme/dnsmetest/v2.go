@@ -0,0 +1,321 @@
+package dnsmetest
+
+// This file serves the V2.0 API from the same domains and records as
+// V1.2.  Domains are addressed by a numeric ID under /dns/managed, lists
+// are returned in pages of PageSize items, and MX and SRV records have
+// their priority, weight and port in separate fields.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+type v2NameServer struct {
+	FQDN string `json:"fqdn"`
+}
+
+type v2Domain struct {
+	ID          int            `json:"id"`
+	Name        string         `json:"name"`
+	GtdEnabled  bool           `json:"gtdEnabled"`
+	NameServers []v2NameServer `json:"nameServers"`
+}
+
+type v2Record struct {
+	ID          int    `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	TTL         int    `json:"ttl"`
+	GtdLocation string `json:"gtdLocation"`
+	MxLevel     int    `json:"mxLevel"`
+	Priority    int    `json:"priority"`
+	Weight      int    `json:"weight"`
+	Port        int    `json:"port"`
+	DynamicDNS  bool   `json:"dynamicDns"`
+	Password    string `json:"password,omitempty"`
+
+	RedirectType string `json:"redirectType,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Keywords     string `json:"keywords,omitempty"`
+	Description  string `json:"description,omitempty"`
+	HardLink     bool   `json:"hardLink,omitempty"`
+}
+
+func (z *zone) v2() (d v2Domain) {
+	d.ID = z.id
+	d.Name = z.info.Name
+	d.GtdEnabled = z.info.GtdEnabled
+	for _, ns := range z.info.NameServers {
+		d.NameServers = append(d.NameServers, v2NameServer{ns})
+	}
+	return
+}
+
+func newV2Record(rec dnsme.Record) (r v2Record) {
+	r = v2Record{
+		ID:           rec.ID,
+		Name:         rec.Name,
+		Type:         rec.Type,
+		Value:        rec.Data,
+		TTL:          rec.TTL,
+		GtdLocation:  rec.GtdLocation,
+		DynamicDNS:   rec.Password != "",
+		Password:     rec.Password,
+		RedirectType: rec.RedirectType,
+		Title:        rec.Title,
+		Keywords:     rec.Keywords,
+		Description:  rec.Description,
+		HardLink:     rec.HardLink,
+	}
+
+	f := strings.Fields(rec.Data)
+	switch {
+	case rec.Type == "MX" && len(f) == 2:
+		r.MxLevel, _ = strconv.Atoi(f[0])
+		r.Value = f[1]
+	case rec.Type == "SRV" && len(f) == 4:
+		r.Priority, _ = strconv.Atoi(f[0])
+		r.Weight, _ = strconv.Atoi(f[1])
+		r.Port, _ = strconv.Atoi(f[2])
+		r.Value = f[3]
+	}
+	return
+}
+
+// record converts r into the V1.2 form in which records are stored.
+func (r v2Record) record() dnsme.Record {
+	rec := dnsme.Record{
+		ID:           r.ID,
+		Name:         r.Name,
+		Type:         r.Type,
+		Data:         r.Value,
+		TTL:          r.TTL,
+		GtdLocation:  r.GtdLocation,
+		Password:     r.Password,
+		RedirectType: r.RedirectType,
+		Title:        r.Title,
+		Keywords:     r.Keywords,
+		Description:  r.Description,
+		HardLink:     r.HardLink,
+	}
+	switch r.Type {
+	case "MX":
+		rec.Data = fmt.Sprintf("%d %s", r.MxLevel, r.Value)
+	case "SRV":
+		rec.Data = fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Value)
+	}
+	return rec
+}
+
+// zoneByID returns the domain with the V2.0 ID given in the path.
+func (s *Server) zoneByID(id string) *zone {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil
+	}
+	for _, z := range s.domains {
+		if z.id == n {
+			return z
+		}
+	}
+	return nil
+}
+
+func (s *Server) serveV2(w http.ResponseWriter, r *http.Request, parts []string) {
+	if len(parts) < 2 || parts[0] != "dns" || parts[1] != "managed" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 2:
+		s.v2Domains(w, r)
+	case len(parts) == 3 && parts[2] == "name":
+		s.v2DomainByName(w, r)
+	case len(parts) == 3:
+		s.v2Domain(w, r, parts[2])
+	case len(parts) == 4 && parts[3] == "records":
+		s.v2Records(w, r, parts[2])
+	case len(parts) == 5 && parts[3] == "records":
+		s.v2Record(w, r, parts[2], parts[4])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writePage writes the items of page of a list, as given by the page
+// query parameter, counting from 0.
+func (s *Server) writePage(w http.ResponseWriter, r *http.Request, items []interface{}) {
+	size := s.PageSize
+	if size <= 0 {
+		size = len(items) + 1
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	total := (len(items) + size - 1) / size
+
+	start, end := page*size, (page+1)*size
+	if start > len(items) {
+		start = len(items)
+	}
+	if end > len(items) {
+		end = len(items)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data":         items[start:end],
+		"page":         page,
+		"totalPages":   total,
+		"totalRecords": len(items),
+	})
+}
+
+func (s *Server) v2Domains(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		var names []string
+		for name := range s.domains {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		items := []interface{}{}
+		for _, name := range names {
+			items = append(items, s.domains[name].v2())
+		}
+		s.writePage(w, r, items)
+	case "POST":
+		var d v2Domain
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil || d.Name == "" {
+			writeError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		if _, ok := s.domains[d.Name]; ok {
+			writeError(w, http.StatusBadRequest, "Domain already exists.")
+			return
+		}
+		z := s.addDomain(dnsme.Domain{Name: d.Name, GtdEnabled: d.GtdEnabled})
+		writeJSON(w, http.StatusCreated, z.v2())
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) v2DomainByName(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w)
+		return
+	}
+	z, ok := s.domains[r.URL.Query().Get("domainname")]
+	if !ok {
+		notFound(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, z.v2())
+}
+
+func (s *Server) v2Domain(w http.ResponseWriter, r *http.Request, id string) {
+	z := s.zoneByID(id)
+	if z == nil {
+		notFound(w)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, z.v2())
+	case "DELETE":
+		delete(s.domains, z.info.Name)
+		w.WriteHeader(http.StatusOK)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) v2Records(w http.ResponseWriter, r *http.Request, id string) {
+	z := s.zoneByID(id)
+	if z == nil {
+		notFound(w)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		q := r.URL.Query()
+		records := []dnsme.Record{}
+		for _, rec := range z.records {
+			if (q.Get("recordName") == "" || rec.Name == q.Get("recordName")) && (q.Get("type") == "" || rec.Type == q.Get("type")) {
+				records = append(records, rec)
+			}
+		}
+		sort.Sort(byID(records))
+		items := []interface{}{}
+		for _, rec := range records {
+			items = append(items, newV2Record(rec))
+		}
+		s.writePage(w, r, items)
+	case "POST":
+		var v v2Record
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		rec := v.record()
+		if msgs := validate(rec); len(msgs) > 0 {
+			writeError(w, http.StatusBadRequest, msgs...)
+			return
+		}
+		for _, existing := range z.records {
+			if existing.Name == rec.Name && existing.Type == rec.Type && existing.Data == rec.Data && existing.GtdLocation == rec.GtdLocation {
+				writeError(w, http.StatusBadRequest, "Record with this type, name, and value already exists.")
+				return
+			}
+		}
+		s.lastID++
+		rec.ID = s.lastID
+		z.records = append(z.records, rec)
+		writeJSON(w, http.StatusCreated, newV2Record(rec))
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+func (s *Server) v2Record(w http.ResponseWriter, r *http.Request, domainID, id string) {
+	z := s.zoneByID(domainID)
+	if z == nil {
+		notFound(w)
+		return
+	}
+
+	i := z.index(id)
+	if i < 0 {
+		notFound(w)
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		var v v2Record
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		rec := v.record()
+		if msgs := validate(rec); len(msgs) > 0 {
+			writeError(w, http.StatusBadRequest, msgs...)
+			return
+		}
+		rec.ID = z.records[i].ID
+		z.records[i] = rec
+		w.WriteHeader(http.StatusOK)
+	case "DELETE":
+		z.records = append(z.records[:i], z.records[i+1:]...)
+		w.WriteHeader(http.StatusOK)
+	default:
+		methodNotAllowed(w)
+	}
+}
@@ -0,0 +1,100 @@
+package dnsme
+
+// A Domain is a primary domain managed by DNS Made Easy.
+type Domain struct {
+	Name              string   `json:"name"`
+	NameServers       []string `json:"nameServer"`
+	VanityNameServers []string `json:"vanityNameServers"`
+	GtdEnabled        bool     `json:"gtdEnabled"`
+	Error             []string `json:"error,omitempty"`
+}
+
+type domainList struct {
+	List []string `json:"list"`
+}
+
+// Domains returns the names of all primary domains in the account.
+func (c *Client) Domains() (domains []string, err error) {
+
+	if c.v2() {
+		return c.v2Domains()
+	}
+
+	req, err := c.newRequest("GET", "/domains/", nil)
+	if err != nil {
+		return
+	}
+
+	var list domainList
+	err = c.do(req, &list)
+	if err != nil {
+		return
+	}
+
+	domains = list.List
+	return
+}
+
+// Domain returns information about the named domain.
+func (c *Client) Domain(name string) (info Domain, err error) {
+
+	if c.v2() {
+		var d v2Domain
+		d, err = c.v2Domain(name)
+		info = d.domain()
+		return
+	}
+
+	req, err := c.newRequest("GET", "/domains/"+name, nil)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, &info)
+	if err != nil {
+		return
+	}
+
+	err = apiError(info.Error)
+	return
+}
+
+// AddDomain creates the domain d, returning the domain as created by
+// the API.
+func (c *Client) AddDomain(d Domain) (info Domain, err error) {
+
+	e := AuditEntry{Op: "add-domain", Domain: d.Name, After: d}
+	if c.v2() {
+		return c.v2AddDomain(d, e)
+	}
+
+	req, err := c.newChange(e, "PUT", "/domains/"+d.Name, d)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, &info)
+	if err != nil {
+		return
+	}
+
+	err = apiError(info.Error)
+	return
+}
+
+// DeleteDomain removes the named domain.
+func (c *Client) DeleteDomain(name string) (err error) {
+
+	e := AuditEntry{Op: "delete-domain", Domain: name}
+	if c.v2() {
+		return c.v2DeleteDomain(name, e)
+	}
+
+	req, err := c.newChange(e, "DELETE", "/domains/"+name, nil)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, nil)
+	return
+}
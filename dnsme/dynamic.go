@@ -0,0 +1,89 @@
+package dnsme
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultDynamicURL is the dynamic DNS update service of DNS Made Easy.
+const DefaultDynamicURL = "https://cp.dnsmadeeasy.com/servlet/updateip"
+
+// A DynamicRecord is an A or AAAA record with dynamic DNS enabled, whose
+// address may be changed through the dynamic DNS update service with
+// the password of the record, rather than the API key pair of the
+// account.
+type DynamicRecord struct {
+	// URL is the update service, e.g. DefaultDynamicURL.
+	URL string
+
+	// Username is the username of the account holding the record.
+	Username string
+
+	// ID and Password are the ID and dynamic DNS password of the
+	// record.
+	ID       int
+	Password string
+
+	// HTTPClient is used to perform requests.  If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// dynamicErrors describes the errors returned by the update service.
+var dynamicErrors = map[string]string{
+	"error-auth":           "invalid username or password",
+	"error-auth-suspend":   "account suspended",
+	"error-auth-voided":    "account revoked",
+	"error-record-invalid": "record does not exist",
+	"error-record-auth":    "no access to the record",
+	"error-system":         "system error",
+}
+
+// UpdateIP points the record at ip.  Setting the address the record
+// already has is not an error.
+func (d *DynamicRecord) UpdateIP(ip string) (err error) {
+
+	u := d.URL
+	if u == "" {
+		u = DefaultDynamicURL
+	}
+	q := url.Values{
+		"username": {d.Username},
+		"password": {d.Password},
+		"id":       {strconv.Itoa(d.ID)},
+		"ip":       {ip},
+	}
+
+	hc := d.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Get(u + "?" + q.Encode())
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("dynamic DNS update of record %d: %s", d.ID, resp.Status)
+		return
+	}
+
+	switch answer := strings.TrimSpace(string(b)); answer {
+	case "success", "error-record-ip-same":
+	default:
+		if msg, ok := dynamicErrors[answer]; ok {
+			answer = msg
+		}
+		err = fmt.Errorf("dynamic DNS update of record %d: %s", d.ID, answer)
+	}
+	return
+}
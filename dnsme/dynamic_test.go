@@ -0,0 +1,50 @@
+package dnsme_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+func TestDynamicRecord(t *testing.T) {
+	s := dnsmetest.NewServer("key", "secret")
+	s.Username = "user"
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	id := s.AddRecord("example.com", dnsme.Record{Name: "home", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT", Password: "secret"})
+	d := &dnsme.DynamicRecord{URL: ts.URL + dnsmetest.DynamicPath, Username: "user", ID: id, Password: "secret"}
+
+	if err := d.UpdateIP("192.0.2.2"); err != nil {
+		t.Fatal(err)
+	}
+	if r := s.Records("example.com"); r[0].Data != "192.0.2.2" {
+		t.Errorf("record after UpdateIP = %+v", r[0])
+	}
+	// the same address is not an error
+	if err := d.UpdateIP("192.0.2.2"); err != nil {
+		t.Errorf("UpdateIP of the same address: %v", err)
+	}
+
+	for _, tt := range []struct {
+		d   dnsme.DynamicRecord
+		ip  string
+		err string
+	}{
+		{dnsme.DynamicRecord{Username: "user", ID: id, Password: "wrong"}, "192.0.2.3", "invalid username or password"},
+		{dnsme.DynamicRecord{Username: "other", ID: id, Password: "secret"}, "192.0.2.3", "invalid username or password"},
+		{dnsme.DynamicRecord{Username: "user", ID: id + 1, Password: "secret"}, "192.0.2.3", "record does not exist"},
+		{dnsme.DynamicRecord{Username: "user", ID: id, Password: "secret"}, "2001:db8::1", "record does not exist"},
+	} {
+		tt.d.URL = d.URL
+		if err := tt.d.UpdateIP(tt.ip); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("UpdateIP(%q) of %+v: err = %v, want %q", tt.ip, tt.d, err, tt.err)
+		}
+	}
+	if r := s.Records("example.com"); r[0].Data != "192.0.2.2" {
+		t.Errorf("record after failed updates = %+v", r[0])
+	}
+}
@@ -0,0 +1,165 @@
+package dnsme
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// RateWindow is the period over which the API applies its request
+	// limit (x-dnsme-requestLimit).
+	RateWindow = 5 * time.Minute
+
+	// DefaultMaxWait is the longest a request waits, in total, for the
+	// rate limit and between retries before giving up.
+	DefaultMaxWait = 5 * time.Minute
+
+	minBackoff = 1 * time.Second
+	maxBackoff = 1 * time.Minute
+)
+
+// rateLimiter is a token bucket holding the requests which may be made
+// without exceeding the API's rate limit.  The bucket refills evenly
+// over RateWindow and is resynchronised with the limit and remaining
+// requests reported by every response.  Until the first response, the
+// limit is unknown and requests are not held back.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limit     int     // x-dnsme-requestLimit
+	remaining int     // x-dnsme-requestsRemaining
+	tokens    float64 // may be negative when requests are queued
+	last      time.Time
+}
+
+// rate returns the refill rate in tokens per second.
+func (l *rateLimiter) rate() float64 {
+	return float64(l.limit) / RateWindow.Seconds()
+}
+
+func (l *rateLimiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate()
+		l.tokens = math.Min(l.tokens, float64(l.limit))
+	}
+	l.last = now
+}
+
+// take reserves a request, returning how long to wait before making it.
+// If the wait would be longer than max, no request is reserved and ok is
+// false.
+func (l *rateLimiter) take(max time.Duration) (wait time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == 0 {
+		return 0, true
+	}
+
+	l.refill(time.Now())
+	if tokens := l.tokens - 1; tokens < 0 {
+		wait = time.Duration(-tokens / l.rate() * float64(time.Second))
+		if wait > max {
+			return wait, false
+		}
+	}
+	l.tokens--
+	return wait, true
+}
+
+// update resynchronises the bucket with the rate-limit headers of a
+// response.
+func (l *rateLimiter) update(h http.Header) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	remaining, err := strconv.Atoi(h.Get("x-dnsme-requestsRemaining"))
+	if err != nil {
+		return
+	}
+	l.remaining = remaining
+
+	if limit, err := strconv.Atoi(h.Get("x-dnsme-requestLimit")); err == nil && limit > 0 {
+		l.limit = limit
+	} else if l.limit == 0 {
+		// the limit is unknown: assume the window started full
+		l.limit = remaining + 1
+	}
+
+	l.refill(time.Now())
+	// requests already reserved by other callers stay reserved
+	if float64(remaining) < l.tokens || l.tokens >= 0 {
+		l.tokens = float64(remaining)
+	}
+}
+
+// wait returns the time until a request is available, used when the
+// API has rejected a request for exceeding the limit.
+func (l *rateLimiter) wait() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit == 0 {
+		return minBackoff
+	}
+	return time.Duration(float64(time.Second) / l.rate())
+}
+
+func (l *rateLimiter) requestsRemaining() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.remaining
+}
+
+// backoff returns the delay before retry attempt n (starting at 0):
+// exponential, capped, with full jitter.
+func backoff(n int) time.Duration {
+	d := maxBackoff
+	if n < 16 {
+		d = minBackoff << uint(n)
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d))) + time.Millisecond
+}
+
+// retryAfter parses the Retry-After header, given either in seconds or
+// as an HTTP date.
+func retryAfter(h http.Header) time.Duration {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(time.Now()); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// throttled reports whether resp is a rejection for exceeding the rate
+// limit.  The API answers these with 400 and no remaining requests.
+func throttled(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return resp.StatusCode == http.StatusBadRequest && resp.Header.Get("x-dnsme-requestsRemaining") == "0"
+}
+
+// idempotent reports whether a request using method may safely be
+// repeated after it may have reached the server.
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package dnsme
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// limiter returns a rate limiter synchronised with a response reporting
+// limit and remaining requests.
+func limiter(limit, remaining int) *rateLimiter {
+	l := &rateLimiter{}
+	h := http.Header{}
+	h.Set("x-dnsme-requestLimit", strconv.Itoa(limit))
+	h.Set("x-dnsme-requestsRemaining", strconv.Itoa(remaining))
+	l.update(h)
+	return l
+}
+
+func TestTake(t *testing.T) {
+	l := &rateLimiter{}
+	if wait, ok := l.take(0); wait != 0 || !ok {
+		t.Errorf("take before the limit is known = %s, %t; want 0, true", wait, ok)
+	}
+
+	l = limiter(300, 1)
+	if wait, ok := l.take(0); wait != 0 || !ok {
+		t.Errorf("take with a request remaining = %s, %t; want 0, true", wait, ok)
+	}
+
+	// one request per second is refilled
+	wait, ok := l.take(time.Minute)
+	if !ok || wait <= 0 || wait > time.Second {
+		t.Errorf("take with no requests remaining = %s, %t; want up to 1s, true", wait, ok)
+	}
+	wait, ok = l.take(time.Minute)
+	if !ok || wait <= time.Second || wait > 2*time.Second {
+		t.Errorf("take with a request queued = %s, %t; want up to 2s, true", wait, ok)
+	}
+}
+
+func TestTakeRefused(t *testing.T) {
+	l := limiter(300, 0)
+	tokens := l.tokens
+
+	for i := 0; i < 3; i++ {
+		if wait, ok := l.take(100 * time.Millisecond); ok || wait <= 100*time.Millisecond {
+			t.Errorf("take over the maximum wait = %s, %t; want over 100ms, false", wait, ok)
+		}
+	}
+	// refused requests are not reserved, so the wait does not grow
+	if l.tokens < tokens {
+		t.Errorf("tokens after refused takes = %f, want at least %f", l.tokens, tokens)
+	}
+	if wait, ok := l.take(2 * time.Second); !ok || wait > time.Second {
+		t.Errorf("take after refused takes = %s, %t; want up to 1s, true", wait, ok)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	l := limiter(100, 40)
+	if l.limit != 100 || l.tokens != 40 || l.requestsRemaining() != 40 {
+		t.Errorf("limiter = %+v, want limit 100 and 40 tokens", l)
+	}
+
+	// without a limit, the window is assumed to have started full
+	l = &rateLimiter{}
+	h := http.Header{}
+	h.Set("x-dnsme-requestsRemaining", "9")
+	l.update(h)
+	if l.limit != 10 {
+		t.Errorf("limit = %d, want 10", l.limit)
+	}
+
+	// headers which cannot be parsed are ignored
+	l.update(http.Header{})
+	if l.remaining != 9 {
+		t.Errorf("remaining after a response without headers = %d, want 9", l.remaining)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for n, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if d := backoff(n); d <= 0 || d > max+time.Millisecond {
+			t.Errorf("backoff(%d) = %s, want up to %s", n, d, max)
+		}
+	}
+	if d := backoff(100); d > maxBackoff+time.Millisecond {
+		t.Errorf("backoff(100) = %s, want up to %s", d, maxBackoff)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for v, want := range map[string]time.Duration{
+		"":        0,
+		"3":       3 * time.Second,
+		"-1":      0,
+		"invalid": 0,
+		time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat): 0,
+	} {
+		h := http.Header{}
+		h.Set("Retry-After", v)
+		if d := retryAfter(h); d != want {
+			t.Errorf("retryAfter(%q) = %s, want %s", v, d, want)
+		}
+	}
+
+	h := http.Header{}
+	h.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if d := retryAfter(h); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("retryAfter of a date an hour away = %s", d)
+	}
+}
+
+func TestThrottled(t *testing.T) {
+	for _, tt := range []struct {
+		status    int
+		remaining string
+		want      bool
+	}{
+		{http.StatusTooManyRequests, "", true},
+		{http.StatusBadRequest, "0", true},
+		{http.StatusBadRequest, "10", false},
+		{http.StatusOK, "0", false},
+	} {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+		resp.Header.Set("x-dnsme-requestsRemaining", tt.remaining)
+		if got := throttled(resp); got != tt.want {
+			t.Errorf("throttled(%d, %q remaining) = %t, want %t", tt.status, tt.remaining, got, tt.want)
+		}
+	}
+}
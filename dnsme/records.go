@@ -0,0 +1,187 @@
+package dnsme
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// A Record is a resource record within a domain.
+type Record struct {
+	Name        string `json:"name"`
+	ID          int    `json:"id,omitempty"`
+	Type        string `json:"type"`
+	Data        string `json:"data"`
+	GtdLocation string `json:"gtdLocation"`
+	TTL         int    `json:"ttl"`
+	Password    string `json:"password,omitempty"`
+
+	// HTTP redirection (HTTPRED) records only: Data is the destination
+	// URL.  Title, Keywords and Description are used for the frame of
+	// a masked redirect; HardLink redirects to the destination URL
+	// exactly, rather than appending the requested path.
+	RedirectType string `json:"redirectType,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Keywords     string `json:"keywords,omitempty"`
+	Description  string `json:"description,omitempty"`
+	HardLink     bool   `json:"hardLink,omitempty"`
+
+	Error []string `json:"error,omitempty"`
+}
+
+// Redirect types of HTTPRED records.
+const (
+	RedirectHidden = "Hidden Frame Masked"
+	Redirect301    = "Standard - 301"
+	Redirect302    = "Standard - 302"
+)
+
+func recordsPath(domain string) string {
+	return "/domains/" + domain + "/records/"
+}
+
+// Records returns the records in domain.  The optional filter is passed
+// to the API as query parameters; supported keys are gtdLocation, type,
+// name, nameContains, value and valueContains.
+func (c *Client) Records(domain string, filter url.Values) (records []Record, err error) {
+
+	if c.v2() {
+		return c.v2Records(domain, filter)
+	}
+
+	req, err := c.newRequest("GET", "/domains/"+domain+"/records", nil)
+	if err != nil {
+		return
+	}
+
+	if filter != nil {
+		req.URL.RawQuery = filter.Encode()
+	}
+
+	err = c.do(req, &records)
+	if err != nil {
+		return
+	}
+
+	for i := range records {
+		fixCNAME(domain, &records[i])
+	}
+	return
+}
+
+// Record returns the record identified by id in domain.
+func (c *Client) Record(domain string, id int) (record Record, err error) {
+
+	if c.v2() {
+		return c.v2Record(domain, id)
+	}
+
+	req, err := c.newRequest("GET", recordsPath(domain)+strconv.Itoa(id), nil)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, &record)
+	if err != nil {
+		return
+	}
+
+	err = apiError(record.Error)
+	if err != nil {
+		return
+	}
+
+	fixCNAME(domain, &record)
+	return
+}
+
+// AddRecord creates r in domain, returning the record as created by the
+// API.  The ID of r is ignored.  r is not checked: see Validate.
+func (c *Client) AddRecord(domain string, r Record) (record Record, err error) {
+
+	r.ID = 0
+	e := AuditEntry{Op: "add-record", Domain: domain, After: r}
+	if c.v2() {
+		return c.v2AddRecord(domain, r, e)
+	}
+
+	req, err := c.newChange(e, "POST", recordsPath(domain), r)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, &record)
+	if err != nil {
+		return
+	}
+
+	err = apiError(record.Error)
+	if err != nil {
+		return
+	}
+
+	fixCNAME(domain, &record)
+	return
+}
+
+// UpdateRecord replaces the record in domain identified by r.ID with r.
+// r is not checked: see Validate.
+func (c *Client) UpdateRecord(domain string, r Record) (err error) {
+	return c.updateRecord(domain, r, AuditEntry{Op: "update-record", Domain: domain, RecordID: r.ID, After: r})
+}
+
+// ReplaceRecord is UpdateRecord for a record known to be old before the
+// update, which is passed to the Audit hook.
+func (c *Client) ReplaceRecord(domain string, old, r Record) (err error) {
+	return c.updateRecord(domain, r, AuditEntry{Op: "update-record", Domain: domain, RecordID: r.ID, Before: old, After: r})
+}
+
+func (c *Client) updateRecord(domain string, r Record, e AuditEntry) (err error) {
+
+	if c.v2() {
+		return c.v2UpdateRecord(domain, r, e)
+	}
+
+	req, err := c.newChange(e, "PUT", recordsPath(domain)+strconv.Itoa(r.ID), r)
+	if err != nil {
+		return
+	}
+
+	// update requests return an empty body
+	err = c.do(req, nil)
+	return
+}
+
+// DeleteRecord removes the record identified by id from domain.
+func (c *Client) DeleteRecord(domain string, id int) (err error) {
+	return c.deleteRecord(domain, id, AuditEntry{Op: "delete-record", Domain: domain, RecordID: id})
+}
+
+// RemoveRecord is DeleteRecord for the record old, which is passed to
+// the Audit hook.
+func (c *Client) RemoveRecord(domain string, old Record) (err error) {
+	return c.deleteRecord(domain, old.ID, AuditEntry{Op: "delete-record", Domain: domain, RecordID: old.ID, Before: old})
+}
+
+func (c *Client) deleteRecord(domain string, id int, e AuditEntry) (err error) {
+
+	if c.v2() {
+		return c.v2DeleteRecord(domain, id, e)
+	}
+
+	req, err := c.newChange(e, "DELETE", recordsPath(domain)+strconv.Itoa(id), nil)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, nil)
+	return
+}
+
+// This is a shortcoming in the DNSME API: CNAME responses may have an
+// empty "data" field, but updating/adding records always require the
+// data field.
+func fixCNAME(domain string, r *Record) {
+	if r.Type == "CNAME" && r.Data == "" {
+		r.Data = domain + "."
+	}
+}
@@ -0,0 +1,97 @@
+package dnsme
+
+// A Secondary is a secondary domain, transferred from the listed master
+// name servers.
+type Secondary struct {
+	Name  string   `json:"name"`
+	IP    []string `json:"ip"`
+	Error []string `json:"error,omitempty"`
+}
+
+// Secondaries returns the names of all secondary domains in the account.
+// Secondary domains are only supported with the V1.2 API.
+func (c *Client) Secondaries() (domains []string, err error) {
+
+	if c.v2() {
+		err = ErrUnsupported
+		return
+	}
+
+	req, err := c.newRequest("GET", "/secondary/", nil)
+	if err != nil {
+		return
+	}
+
+	var list domainList
+	err = c.do(req, &list)
+	if err != nil {
+		return
+	}
+
+	domains = list.List
+	return
+}
+
+// Secondary returns information about the named secondary domain.
+func (c *Client) Secondary(name string) (info Secondary, err error) {
+
+	if c.v2() {
+		err = ErrUnsupported
+		return
+	}
+
+	req, err := c.newRequest("GET", "/secondary/"+name, nil)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, &info)
+	if err != nil {
+		return
+	}
+
+	err = apiError(info.Error)
+	return
+}
+
+// AddSecondary creates the secondary domain s, or replaces the master IP
+// addresses of an existing one.
+func (c *Client) AddSecondary(s Secondary) (info Secondary, err error) {
+
+	if c.v2() {
+		err = ErrUnsupported
+		return
+	}
+
+	e := AuditEntry{Op: "add-secondary", Domain: s.Name, After: s}
+	req, err := c.newChange(e, "PUT", "/secondary/"+s.Name, s)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, &info)
+	if err != nil {
+		return
+	}
+
+	err = apiError(info.Error)
+	return
+}
+
+// DeleteSecondary removes the named secondary domain.
+func (c *Client) DeleteSecondary(name string) (err error) {
+
+	if c.v2() {
+		err = ErrUnsupported
+		return
+	}
+
+	e := AuditEntry{Op: "delete-secondary", Domain: name}
+	req, err := c.newChange(e, "DELETE", "/secondary/"+name, nil)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, nil)
+	return
+}
@@ -0,0 +1,419 @@
+package dnsme
+
+// This file maps the V2.0 API onto the same types used with V1.2.  V2.0
+// addresses domains by a numeric ID under /dns/managed, returns lists in
+// pages and splits the record data into separate fields for MX and SRV
+// records.
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type v2Page struct {
+	Data       json.RawMessage `json:"data"`
+	Page       int             `json:"page"`
+	TotalPages int             `json:"totalPages"`
+}
+
+type v2NameServer struct {
+	FQDN string `json:"fqdn"`
+}
+
+type v2Domain struct {
+	ID          int            `json:"id,omitempty"`
+	Name        string         `json:"name"`
+	GtdEnabled  bool           `json:"gtdEnabled"`
+	NameServers []v2NameServer `json:"nameServers,omitempty"`
+}
+
+type v2Record struct {
+	ID          int    `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	TTL         int    `json:"ttl"`
+	GtdLocation string `json:"gtdLocation"`
+	MxLevel     int    `json:"mxLevel"`
+	Priority    int    `json:"priority"`
+	Weight      int    `json:"weight"`
+	Port        int    `json:"port"`
+	DynamicDNS  bool   `json:"dynamicDns"`
+	Password    string `json:"password,omitempty"`
+
+	RedirectType string `json:"redirectType,omitempty"`
+	Title        string `json:"title,omitempty"`
+	Keywords     string `json:"keywords,omitempty"`
+	Description  string `json:"description,omitempty"`
+	HardLink     bool   `json:"hardLink,omitempty"`
+}
+
+func (d v2Domain) domain() (domain Domain) {
+	domain.Name = d.Name
+	domain.GtdEnabled = d.GtdEnabled
+	for _, ns := range d.NameServers {
+		domain.NameServers = append(domain.NameServers, ns.FQDN)
+	}
+	return
+}
+
+// record converts a V2.0 record into the V1.2 representation, where the
+// MX level and SRV priority, weight and port are part of the data.
+func (r v2Record) record() (record Record) {
+	record.ID = r.ID
+	record.Name = r.Name
+	record.Type = r.Type
+	record.TTL = r.TTL
+	record.GtdLocation = r.GtdLocation
+	record.Password = r.Password
+	record.RedirectType = r.RedirectType
+	record.Title = r.Title
+	record.Keywords = r.Keywords
+	record.Description = r.Description
+	record.HardLink = r.HardLink
+
+	switch r.Type {
+	case "MX":
+		record.Data = fmt.Sprintf("%d %s", r.MxLevel, r.Value)
+	case "SRV":
+		record.Data = fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, r.Value)
+	default:
+		record.Data = r.Value
+	}
+	return
+}
+
+func newV2Record(record Record) (r v2Record, err error) {
+	r.ID = record.ID
+	r.Name = record.Name
+	r.Type = record.Type
+	r.TTL = record.TTL
+	r.GtdLocation = record.GtdLocation
+	r.Password = record.Password
+	r.DynamicDNS = record.Password != ""
+	r.Value = record.Data
+	r.RedirectType = record.RedirectType
+	r.Title = record.Title
+	r.Keywords = record.Keywords
+	r.Description = record.Description
+	r.HardLink = record.HardLink
+
+	f := strings.Fields(record.Data)
+	switch record.Type {
+	case "MX":
+		if len(f) != 2 {
+			err = fmt.Errorf("invalid MX data %q", record.Data)
+			return
+		}
+		r.MxLevel, err = strconv.Atoi(f[0])
+		r.Value = f[1]
+	case "SRV":
+		if len(f) != 4 {
+			err = fmt.Errorf("invalid SRV data %q", record.Data)
+			return
+		}
+		var n [3]int
+		for i := range n {
+			n[i], err = strconv.Atoi(f[i])
+			if err != nil {
+				break
+			}
+		}
+		r.Priority, r.Weight, r.Port, r.Value = n[0], n[1], n[2], f[3]
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid %s data %q", record.Type, record.Data)
+	}
+	return
+}
+
+// v2List fetches every page of the list at p, calling fn with the data
+// of each page.
+func (c *Client) v2List(p string, query url.Values, fn func(data json.RawMessage) error) (err error) {
+
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+
+	for {
+		req, err := c.newRequest("GET", p, nil)
+		if err != nil {
+			return err
+		}
+		req.URL.RawQuery = q.Encode()
+
+		var page v2Page
+		err = c.do(req, &page)
+		if err != nil {
+			return err
+		}
+
+		if len(page.Data) > 0 {
+			err = fn(page.Data)
+			if err != nil {
+				return err
+			}
+		}
+
+		if page.Page+1 >= page.TotalPages {
+			return nil
+		}
+		q.Set("page", strconv.Itoa(page.Page+1))
+	}
+}
+
+// v2Domain looks up a domain by name, caching its ID.
+func (c *Client) v2Domain(name string) (d v2Domain, err error) {
+
+	req, err := c.newRequest("GET", "/dns/managed/name", nil)
+	if err != nil {
+		return
+	}
+	req.URL.RawQuery = url.Values{"domainname": {name}}.Encode()
+
+	err = c.do(req, &d)
+	if err != nil {
+		return
+	}
+	if d.ID == 0 {
+		err = ErrNotFound
+		return
+	}
+
+	c.mu.Lock()
+	if c.domainIDs == nil {
+		c.domainIDs = make(map[string]int)
+	}
+	c.domainIDs[name] = d.ID
+	c.mu.Unlock()
+
+	return
+}
+
+func (c *Client) v2DomainID(name string) (id int, err error) {
+
+	c.mu.Lock()
+	id, ok := c.domainIDs[name]
+	c.mu.Unlock()
+	if ok {
+		return
+	}
+
+	d, err := c.v2Domain(name)
+	id = d.ID
+	return
+}
+
+func (c *Client) v2RecordsPath(domain string) (p string, err error) {
+	id, err := c.v2DomainID(domain)
+	if err != nil {
+		return
+	}
+	p = "/dns/managed/" + strconv.Itoa(id) + "/records/"
+	return
+}
+
+func (c *Client) v2Domains() (domains []string, err error) {
+
+	err = c.v2List("/dns/managed/", nil, func(data json.RawMessage) error {
+		var ds []v2Domain
+		if err := json.Unmarshal(data, &ds); err != nil {
+			return err
+		}
+		for _, d := range ds {
+			domains = append(domains, d.Name)
+		}
+		return nil
+	})
+	return
+}
+
+func (c *Client) v2AddDomain(domain Domain, e AuditEntry) (info Domain, err error) {
+
+	req, err := c.newChange(e, "POST", "/dns/managed/", v2Domain{Name: domain.Name, GtdEnabled: domain.GtdEnabled})
+	if err != nil {
+		return
+	}
+
+	var d v2Domain
+	err = c.do(req, &d)
+	if err != nil {
+		return
+	}
+
+	info = d.domain()
+	return
+}
+
+func (c *Client) v2DeleteDomain(name string, e AuditEntry) (err error) {
+
+	id, err := c.v2DomainID(name)
+	if err != nil {
+		return
+	}
+
+	req, err := c.newChange(e, "DELETE", "/dns/managed/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, nil)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	delete(c.domainIDs, name)
+	c.mu.Unlock()
+	return
+}
+
+// v2Records lists the records of domain.  V2.0 only filters by name
+// and type, so the remaining V1.2 filters are applied here.
+func (c *Client) v2Records(domain string, filter url.Values) (records []Record, err error) {
+
+	p, err := c.v2RecordsPath(domain)
+	if err != nil {
+		return
+	}
+
+	q := url.Values{}
+	if v := filter.Get("name"); v != "" {
+		q.Set("recordName", v)
+	}
+	if v := filter.Get("type"); v != "" {
+		q.Set("type", v)
+	}
+
+	err = c.v2List(p, q, func(data json.RawMessage) error {
+		var rs []v2Record
+		if err := json.Unmarshal(data, &rs); err != nil {
+			return err
+		}
+		for _, r := range rs {
+			record := r.record()
+			if matchFilter(record, filter) {
+				records = append(records, record)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (c *Client) v2Record(domain string, id int) (record Record, err error) {
+
+	records, err := c.v2Records(domain, nil)
+	if err != nil {
+		return
+	}
+
+	for _, r := range records {
+		if r.ID == id {
+			record = r
+			return
+		}
+	}
+
+	err = ErrNotFound
+	return
+}
+
+func (c *Client) v2AddRecord(domain string, record Record, e AuditEntry) (added Record, err error) {
+
+	p, err := c.v2RecordsPath(domain)
+	if err != nil {
+		return
+	}
+
+	r, err := newV2Record(record)
+	if err != nil {
+		return
+	}
+	r.ID = 0
+
+	req, err := c.newChange(e, "POST", p, r)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, &r)
+	if err != nil {
+		return
+	}
+
+	added = r.record()
+	return
+}
+
+func (c *Client) v2UpdateRecord(domain string, record Record, e AuditEntry) (err error) {
+
+	p, err := c.v2RecordsPath(domain)
+	if err != nil {
+		return
+	}
+
+	r, err := newV2Record(record)
+	if err != nil {
+		return
+	}
+
+	req, err := c.newChange(e, "PUT", p+strconv.Itoa(r.ID), r)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, nil)
+	return
+}
+
+func (c *Client) v2DeleteRecord(domain string, id int, e AuditEntry) (err error) {
+
+	p, err := c.v2RecordsPath(domain)
+	if err != nil {
+		return
+	}
+
+	req, err := c.newChange(e, "DELETE", p+strconv.Itoa(id), nil)
+	if err != nil {
+		return
+	}
+
+	err = c.do(req, nil)
+	return
+}
+
+// matchFilter reports whether r matches the V1.2 record filter.
+func matchFilter(r Record, filter url.Values) bool {
+	for k := range filter {
+		v := filter.Get(k)
+		if v == "" {
+			continue
+		}
+		var ok bool
+		switch k {
+		case "gtdLocation":
+			ok = r.GtdLocation == v
+		case "type":
+			ok = r.Type == v
+		case "name":
+			ok = r.Name == v
+		case "nameContains":
+			ok = strings.Contains(r.Name, v)
+		case "value":
+			ok = r.Data == v
+		case "valueContains":
+			ok = strings.Contains(r.Data, v)
+		default:
+			ok = true
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
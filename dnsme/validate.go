@@ -0,0 +1,167 @@
+package dnsme
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MaxTTL is the largest TTL allowed by RFC 2181.
+const MaxTTL = 1<<31 - 1
+
+// A FieldError is a problem with one field of a record.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// A ValidationError lists the problems found with a record by Validate.
+type ValidationError struct {
+	Record   Record
+	Problems []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, p := range e.Problems {
+		msgs = append(msgs, p.Error())
+	}
+	name := e.Record.Name
+	if name == "" {
+		name = "@"
+	}
+	return fmt.Sprintf("invalid %s record %q: %s", e.Record.Type, name, strings.Join(msgs, "; "))
+}
+
+// Validate checks the name, TTL and data of r for the record type,
+// returning a *ValidationError listing every problem found, or nil.
+// The data of types other than those reported by CheckedType, such as
+// CAA, is not checked.
+func (r Record) Validate() error {
+
+	e := &ValidationError{Record: r}
+	add := func(field, format string, args ...interface{}) {
+		e.Problems = append(e.Problems, FieldError{field, fmt.Sprintf(format, args...)})
+	}
+
+	if r.Name != "" && !validName(r.Name, true) {
+		add("name", "%q is not a valid host name", r.Name)
+	}
+
+	if r.TTL < 1 || r.TTL > MaxTTL {
+		add("ttl", "%d is not between 1 and %d", r.TTL, MaxTTL)
+	}
+
+	f := strings.Fields(r.Data)
+
+	switch r.Type {
+	case "A":
+		if ip := net.ParseIP(r.Data); ip == nil || ip.To4() == nil || strings.Contains(r.Data, ":") {
+			add("data", "%q is not an IPv4 address", r.Data)
+		}
+	case "AAAA":
+		if ip := net.ParseIP(r.Data); ip == nil || !strings.Contains(r.Data, ":") {
+			add("data", "%q is not an IPv6 address", r.Data)
+		}
+	case "CNAME", "NS", "PTR":
+		if !validName(r.Data, false) {
+			add("data", "%q is not a valid host name", r.Data)
+		}
+	case "MX":
+		if len(f) != 2 {
+			add("data", "%q is not of the form <priority> <host>", r.Data)
+			break
+		}
+		if !validUint16(f[0]) {
+			add("data", "priority %q is not between 0 and 65535", f[0])
+		}
+		if !validName(f[1], false) {
+			add("data", "%q is not a valid host name", f[1])
+		}
+	case "SRV":
+		if len(f) != 4 {
+			add("data", "%q is not of the form <priority> <weight> <port> <target>", r.Data)
+			break
+		}
+		for i, field := range []string{"priority", "weight", "port"} {
+			if !validUint16(f[i]) {
+				add("data", "%s %q is not between 0 and 65535", field, f[i])
+			}
+		}
+		if !validName(f[3], false) {
+			add("data", "%q is not a valid host name", f[3])
+		}
+	case "TXT", "SPF":
+		if r.Data == "" {
+			add("data", "text is required")
+		}
+	case "HTTPRED":
+		switch r.RedirectType {
+		case RedirectHidden, Redirect301, Redirect302:
+		default:
+			add("redirectType", "%q is not one of %q, %q or %q", r.RedirectType, Redirect301, Redirect302, RedirectHidden)
+		}
+		u, err := url.Parse(r.Data)
+		if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			add("data", "%q is not an absolute http or https URL", r.Data)
+		}
+	case "":
+		add("type", "type is required")
+	}
+
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+// CheckedType reports whether Validate checks the data of records of
+// type typ.
+func CheckedType(typ string) bool {
+	switch typ {
+	case "A", "AAAA", "CNAME", "NS", "PTR", "MX", "SRV", "TXT", "SPF", "HTTPRED":
+		return true
+	}
+	return false
+}
+
+// validName reports whether name is a valid host name, either relative
+// to the domain or fully qualified with a trailing dot.  Underscores
+// are allowed, for names such as _sip._tcp; wildcard allows a leading
+// "*" label.
+func validName(name string, wildcard bool) bool {
+
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+
+	labels := strings.Split(name, ".")
+	for i, l := range labels {
+		if wildcard && i == 0 && l == "*" {
+			continue
+		}
+		if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return false
+		}
+		for _, c := range l {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func validUint16(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 16)
+	return err == nil
+}
@@ -0,0 +1,57 @@
+package dnsme
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, r := range []Record{
+		{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300},
+		{Name: "*.dev", Type: "AAAA", Data: "2001:db8::1", TTL: 300},
+		{Name: "", Type: "MX", Data: "10 mail.example.com.", TTL: 300},
+		{Name: "_sip._tcp", Type: "SRV", Data: "10 20 5060 sip", TTL: 300},
+		{Name: "ftp", Type: "CNAME", Data: "www", TTL: 300},
+		{Name: "txt", Type: "TXT", Data: "v=spf1 -all", TTL: 300},
+		{Name: "go", Type: "HTTPRED", Data: "https://example.org/", TTL: 300, RedirectType: Redirect301},
+		// the data of these types is not checked
+		{Name: "", Type: "CAA", Data: `0 issue "letsencrypt.org"`, TTL: 300},
+		{Name: "", Type: "ANAME", Data: "example.net.", TTL: 300},
+	} {
+		if err := r.Validate(); err != nil {
+			t.Errorf("Validate(%+v) = %v", r, err)
+		}
+	}
+
+	for _, tt := range []struct {
+		r    Record
+		want string
+	}{
+		{Record{Name: "www", Type: "A", Data: "2001:db8::1", TTL: 300}, `invalid A record "www": data: "2001:db8::1" is not an IPv4 address`},
+		{Record{Name: "www", Type: "AAAA", Data: "192.0.2.1", TTL: 300}, "not an IPv6 address"},
+		{Record{Name: "-www", Type: "A", Data: "192.0.2.1", TTL: 300}, "name:"},
+		{Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 0}, "ttl: 0 is not between 1 and"},
+		{Record{Type: "MX", Data: "mail", TTL: 300}, `invalid MX record "@"`},
+		{Record{Type: "MX", Data: "70000 mail", TTL: 300}, "priority"},
+		{Record{Name: "_sip._tcp", Type: "SRV", Data: "10 20 sip", TTL: 300}, "<priority> <weight> <port> <target>"},
+		{Record{Name: "ftp", Type: "CNAME", Data: "bad name", TTL: 300}, "not a valid host name"},
+		{Record{Name: "txt", Type: "TXT", TTL: 300}, "text is required"},
+		{Record{Name: "go", Type: "HTTPRED", Data: "example.org", TTL: 300, RedirectType: Redirect301}, "absolute http or https URL"},
+		{Record{Name: "go", Type: "HTTPRED", Data: "https://example.org/", TTL: 300}, "redirectType"},
+		{Record{Name: "www", Data: "192.0.2.1", TTL: 300}, "type is required"},
+		{Record{Name: "", Type: "CAA", Data: `0 issue "letsencrypt.org"`, TTL: -1}, "ttl:"},
+	} {
+		err := tt.r.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Validate(%+v) = %v, want an error containing %q", tt.r, err, tt.want)
+		}
+	}
+}
+
+func TestCheckedType(t *testing.T) {
+	for typ, want := range map[string]bool{"A": true, "HTTPRED": true, "CAA": false, "ANAME": false} {
+		if got := CheckedType(typ); got != want {
+			t.Errorf("CheckedType(%s) = %t, want %t", typ, got, want)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// dnsTimeout is how long to wait for an answer to a DNS query.
+const dnsTimeout = 5 * time.Second
+
+// dnsTypes are the DNS type codes of the record types which can be
+// looked up.  HTTPRED records are served as addresses of the redirect
+// servers, so cannot be.
+var dnsTypes = map[string]uint16{
+	"A":     1,
+	"NS":    2,
+	"CNAME": 5,
+	"PTR":   12,
+	"MX":    15,
+	"TXT":   16,
+	"AAAA":  28,
+	"SRV":   33,
+	"SPF":   99,
+}
+
+// DNS response codes.
+const (
+	rcodeSuccess  = 0
+	rcodeNXDomain = 3
+)
+
+var rcodeNames = map[int]string{
+	1: "FORMERR",
+	2: "SERVFAIL",
+	3: "NXDOMAIN",
+	4: "NOTIMP",
+	5: "REFUSED",
+}
+
+// A dnsAnswer is a resource record in the answer to a query.  Data is in
+// the form returned by answerData.
+type dnsAnswer struct {
+	Name string
+	Type uint16
+	TTL  uint32
+	Data string
+}
+
+// A dnsResponse is the response of a server to a query.
+type dnsResponse struct {
+	Rcode         int
+	Authoritative bool
+	Answers       []dnsAnswer
+}
+
+// dnsQuery asks server, a host with an optional port, for the records of
+// the given type of name, without recursion.  The query is sent by UDP,
+// and retried by TCP if the answer is truncated.
+func dnsQuery(server, name string, qtype uint16) (resp dnsResponse, err error) {
+
+	if _, _, e := net.SplitHostPort(server); e != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	id := uint16(rand.Intn(1 << 16))
+	query, err := dnsMessage(id, name, qtype)
+	if err != nil {
+		return
+	}
+
+	msg, err := dnsExchangeUDP(server, id, query)
+	if err != nil {
+		return
+	}
+	if binary.BigEndian.Uint16(msg[2:])&0x0200 != 0 {
+		msg, err = dnsExchangeTCP(server, id, query)
+		if err != nil {
+			return
+		}
+	}
+
+	return dnsParse(msg)
+}
+
+// dnsMessage returns a query for the records of type qtype of name.
+func dnsMessage(id uint16, name string, qtype uint16) (msg []byte, err error) {
+
+	msg = make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[4:], 1) // one question
+
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if label == "" || len(label) > 63 {
+				err = fmt.Errorf("invalid name %q", name)
+				return
+			}
+			msg = append(msg, byte(len(label)))
+			msg = append(msg, label...)
+		}
+	}
+	msg = append(msg, 0)
+	msg = append(msg, byte(qtype>>8), byte(qtype), 0, 1) // class IN
+	return
+}
+
+func dnsExchangeUDP(server string, id uint16, query []byte) (msg []byte, err error) {
+
+	conn, err := net.DialTimeout("udp", server, dnsTimeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dnsTimeout))
+
+	_, err = conn.Write(query)
+	if err != nil {
+		return
+	}
+
+	buf := make([]byte, 65535)
+	for {
+		var n int
+		n, err = conn.Read(buf)
+		if err != nil {
+			return
+		}
+		// ignore stray responses to other queries
+		if n >= 12 && binary.BigEndian.Uint16(buf) == id {
+			msg = buf[:n]
+			return
+		}
+	}
+}
+
+func dnsExchangeTCP(server string, id uint16, query []byte) (msg []byte, err error) {
+
+	conn, err := net.DialTimeout("tcp", server, dnsTimeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(dnsTimeout))
+
+	b := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(b, uint16(len(query)))
+	_, err = conn.Write(append(b, query...))
+	if err != nil {
+		return
+	}
+
+	_, err = io.ReadFull(conn, b)
+	if err != nil {
+		return
+	}
+	msg = make([]byte, binary.BigEndian.Uint16(b))
+	_, err = io.ReadFull(conn, msg)
+	if err != nil {
+		return
+	}
+	if len(msg) < 12 || binary.BigEndian.Uint16(msg) != id {
+		err = errors.New("mismatched DNS response")
+	}
+	return
+}
+
+var errDNSFormat = errors.New("malformed DNS response")
+
+// dnsParse parses the answers of a response.
+func dnsParse(msg []byte) (resp dnsResponse, err error) {
+
+	if len(msg) < 12 {
+		err = errDNSFormat
+		return
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	if flags&0x8000 == 0 {
+		err = errDNSFormat
+		return
+	}
+	resp.Rcode = int(flags & 0x000f)
+	resp.Authoritative = flags&0x0400 != 0
+
+	qdcount := int(binary.BigEndian.Uint16(msg[4:]))
+	ancount := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := 12
+	for i := 0; i < qdcount; i++ {
+		_, off, err = dnsName(msg, off)
+		if err != nil {
+			return
+		}
+		off += 4
+	}
+
+	for i := 0; i < ancount; i++ {
+		var a dnsAnswer
+		a.Name, off, err = dnsName(msg, off)
+		if err != nil {
+			return
+		}
+		if off+10 > len(msg) {
+			err = errDNSFormat
+			return
+		}
+		a.Type = binary.BigEndian.Uint16(msg[off:])
+		a.TTL = binary.BigEndian.Uint32(msg[off+4:])
+		rdlen := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+rdlen > len(msg) {
+			err = errDNSFormat
+			return
+		}
+		a.Data, err = dnsRData(msg, off, rdlen, a.Type)
+		if err != nil {
+			return
+		}
+		off += rdlen
+		resp.Answers = append(resp.Answers, a)
+	}
+	return
+}
+
+// dnsName reads the possibly compressed name at off, returning it in
+// lower case with a trailing dot, and the offset following it.
+func dnsName(msg []byte, off int) (name string, next int, err error) {
+
+	var labels []string
+	next = -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			err = errDNSFormat
+			return
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			name = strings.ToLower(strings.Join(labels, ".")) + "."
+			return
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 64 {
+				err = errDNSFormat
+				return
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+n > len(msg) {
+				err = errDNSFormat
+				return
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+// dnsRData returns the data of a record in the form of answerData, or
+// in hex for types which are not understood.
+func dnsRData(msg []byte, off, rdlen int, rtype uint16) (data string, err error) {
+
+	rdata := msg[off : off+rdlen]
+	u16 := func(i int) string { return strconv.Itoa(int(binary.BigEndian.Uint16(rdata[i:]))) }
+
+	switch rtype {
+	case dnsTypes["A"], dnsTypes["AAAA"]:
+		if len(rdata) != net.IPv4len && len(rdata) != net.IPv6len {
+			err = errDNSFormat
+			return
+		}
+		data = net.IP(rdata).String()
+	case dnsTypes["NS"], dnsTypes["CNAME"], dnsTypes["PTR"]:
+		data, _, err = dnsName(msg, off)
+	case dnsTypes["MX"]:
+		if rdlen < 3 {
+			err = errDNSFormat
+			return
+		}
+		var target string
+		target, _, err = dnsName(msg, off+2)
+		data = u16(0) + " " + target
+	case dnsTypes["SRV"]:
+		if rdlen < 7 {
+			err = errDNSFormat
+			return
+		}
+		var target string
+		target, _, err = dnsName(msg, off+6)
+		data = u16(0) + " " + u16(2) + " " + u16(4) + " " + target
+	case dnsTypes["TXT"], dnsTypes["SPF"]:
+		var strs []string
+		for i := 0; i < len(rdata); {
+			n := int(rdata[i])
+			if i+1+n > len(rdata) {
+				err = errDNSFormat
+				return
+			}
+			strs = append(strs, string(rdata[i+1:i+1+n]))
+			i += 1 + n
+		}
+		data = composeTXT(strs)
+	default:
+		data = fmt.Sprintf("%x", rdata)
+	}
+	return
+}
+
+// answerData returns the data of r in the form it is answered by a
+// nameserver: addresses in canonical form, names fully qualified in
+// lower case, and TXT strings split and quoted as by composeTXT.
+func answerData(domain string, r dnsme.Record) string {
+
+	f := strings.Fields(r.Data)
+
+	switch r.Type {
+	case "A", "AAAA":
+		if ip := net.ParseIP(r.Data); ip != nil {
+			return ip.String()
+		}
+	case "NS", "CNAME", "PTR":
+		return absoluteName(r.Data, domain)
+	case "MX":
+		if len(f) == 2 {
+			return f[0] + " " + absoluteName(f[1], domain)
+		}
+	case "SRV":
+		if len(f) == 4 {
+			return strings.Join(f[:3], " ") + " " + absoluteName(f[3], domain)
+		}
+	case "TXT", "SPF":
+		return composeTXT(splitData(r).TXT)
+	}
+	return r.Data
+}
+
+// absoluteName returns name, which is relative to domain unless it ends
+// with a dot, as a fully qualified name in lower case.  An empty name or
+// "@" is the domain itself.
+func absoluteName(name, domain string) string {
+	switch {
+	case name == "" || name == "@":
+		name = domain + "."
+	case !strings.HasSuffix(name, "."):
+		name += "." + domain + "."
+	}
+	return strings.ToLower(name)
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// A testDNS is a nameserver answering queries, by UDP and TCP, from the
+// records set on it.
+type testDNS struct {
+	Addr string
+
+	mu      sync.Mutex
+	records map[string][]dnsAnswer
+	rcode   int
+	// truncate sets the TC bit on answers by UDP, so that queries are
+	// retried by TCP.
+	truncate bool
+}
+
+// newTestDNS starts a nameserver on a local port.
+func newTestDNS(t *testing.T) *testDNS {
+	t.Helper()
+
+	var (
+		pc  net.PacketConn
+		l   net.Listener
+		err error
+	)
+	// the TCP port must match the UDP one
+	for i := 0; i < 10; i++ {
+		pc, err = net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err = net.Listen("tcp", pc.LocalAddr().String())
+		if err == nil {
+			break
+		}
+		pc.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close(); l.Close() })
+
+	s := &testDNS{Addr: pc.LocalAddr().String(), records: make(map[string][]dnsAnswer)}
+	go s.serveUDP(pc)
+	go s.serveTCP(l)
+	return s
+}
+
+// set sets the records of fqdn with the type, with data in the form of
+// answerData.
+func (s *testDNS) set(fqdn, rtype string, ttl uint32, data ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := strings.ToLower(fqdn) + " " + rtype
+	s.records[key] = nil
+	for _, d := range data {
+		s.records[key] = append(s.records[key], dnsAnswer{Name: strings.ToLower(fqdn), Type: dnsTypes[rtype], TTL: ttl, Data: d})
+	}
+}
+
+func (s *testDNS) serveUDP(pc net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n], true); resp != nil {
+			pc.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *testDNS) serveTCP(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(conn, b); err == nil {
+			query := make([]byte, binary.BigEndian.Uint16(b))
+			if _, err := io.ReadFull(conn, query); err == nil {
+				if resp := s.answer(query, false); resp != nil {
+					binary.BigEndian.PutUint16(b, uint16(len(resp)))
+					conn.Write(append(b, resp...))
+				}
+			}
+		}
+		conn.Close()
+	}
+}
+
+// answer returns the response to a query.
+func (s *testDNS) answer(query []byte, udp bool) []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name, off, err := dnsName(query, 12)
+	if err != nil || off+4 > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[off:])
+
+	var answers []dnsAnswer
+	exists := false
+	for key, records := range s.records {
+		if strings.HasPrefix(key, name+" ") {
+			exists = true
+		}
+		for _, a := range records {
+			if a.Name == name && a.Type == qtype {
+				answers = append(answers, a)
+			}
+		}
+	}
+
+	flags := uint16(0x8400) | uint16(s.rcode)
+	switch {
+	case s.rcode != rcodeSuccess:
+		answers = nil
+	case !exists:
+		flags |= rcodeNXDomain
+	case udp && s.truncate:
+		flags |= 0x0200
+		answers = nil
+	}
+
+	msg := make([]byte, 12, 512)
+	copy(msg, query[:2])
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	binary.BigEndian.PutUint16(msg[6:], uint16(len(answers)))
+	msg = append(msg, query[12:off+4]...)
+
+	for _, a := range answers {
+		msg = appendName(msg, a.Name)
+		rdata := encodeRData(a)
+		msg = append(msg, byte(a.Type>>8), byte(a.Type), 0, 1)
+		msg = binary.BigEndian.AppendUint32(msg, a.TTL)
+		msg = binary.BigEndian.AppendUint16(msg, uint16(len(rdata)))
+		msg = append(msg, rdata...)
+	}
+	return msg
+}
+
+func appendName(b []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label != "" {
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0)
+}
+
+// encodeRData returns the wire form of the data of a.
+func encodeRData(a dnsAnswer) (b []byte) {
+	f := strings.Fields(a.Data)
+	u16 := func(s string) []byte {
+		n, _ := strconv.Atoi(s)
+		return binary.BigEndian.AppendUint16(nil, uint16(n))
+	}
+
+	switch a.Type {
+	case dnsTypes["A"]:
+		return net.ParseIP(a.Data).To4()
+	case dnsTypes["AAAA"]:
+		return net.ParseIP(a.Data).To16()
+	case dnsTypes["NS"], dnsTypes["CNAME"], dnsTypes["PTR"]:
+		return appendName(nil, a.Data)
+	case dnsTypes["MX"]:
+		return appendName(u16(f[0]), f[1])
+	case dnsTypes["SRV"]:
+		return appendName(append(append(u16(f[0]), u16(f[1])...), u16(f[2])...), f[3])
+	case dnsTypes["TXT"], dnsTypes["SPF"]:
+		for _, t := range splitData(dnsme.Record{Type: "TXT", Data: a.Data}).TXT {
+			b = append(b, byte(len(t)))
+			b = append(b, t...)
+		}
+	}
+	return
+}
+
+func TestDNSQuery(t *testing.T) {
+	s := newTestDNS(t)
+	long := strings.Repeat("a", 300)
+	s.set("www.example.com.", "A", 300, "192.0.2.1", "192.0.2.2")
+	s.set("www.example.com.", "AAAA", 300, "2001:db8::1")
+	s.set("example.com.", "MX", 3600, "10 mail.example.com.")
+	s.set("_sip._tcp.example.com.", "SRV", 60, "10 20 5060 sip.example.net.")
+	s.set("ftp.example.com.", "CNAME", 60, "www.example.com.")
+	s.set("txt.example.com.", "TXT", 60, composeTXT([]string{long}))
+
+	for _, tt := range []struct {
+		name, rtype string
+		want        []string
+	}{
+		{"www.example.com", "A", []string{"192.0.2.1", "192.0.2.2"}},
+		{"WWW.Example.COM.", "AAAA", []string{"2001:db8::1"}},
+		{"example.com", "MX", []string{"10 mail.example.com."}},
+		{"_sip._tcp.example.com", "SRV", []string{"10 20 5060 sip.example.net."}},
+		{"ftp.example.com", "CNAME", []string{"www.example.com."}},
+		{"txt.example.com", "TXT", []string{`"` + long[:255] + `" "` + long[255:] + `"`}},
+		{"www.example.com", "TXT", nil},
+	} {
+		resp, err := dnsQuery(s.Addr, tt.name, dnsTypes[tt.rtype])
+		if err != nil {
+			t.Errorf("%s %s: %v", tt.name, tt.rtype, err)
+			continue
+		}
+		got := answerSet(answeredData(resp, strings.TrimSuffix(tt.name, ".")+".", dnsTypes[tt.rtype]))
+		if want := answerSet(tt.want); got != want || resp.Rcode != rcodeSuccess || !resp.Authoritative {
+			t.Errorf("%s %s: %s, rcode %d, want %s", tt.name, tt.rtype, got, resp.Rcode, want)
+		}
+	}
+
+	resp, err := dnsQuery(s.Addr, "nowhere.example.com", dnsTypes["A"])
+	if err != nil || resp.Rcode != rcodeNXDomain {
+		t.Errorf("nowhere.example.com: %+v, %v; want NXDOMAIN", resp, err)
+	}
+
+	// a truncated answer is retried by TCP
+	s.mu.Lock()
+	s.truncate = true
+	s.mu.Unlock()
+	resp, err = dnsQuery(s.Addr, "www.example.com", dnsTypes["A"])
+	if err != nil || len(resp.Answers) != 2 {
+		t.Errorf("truncated answer: %+v, %v; want the answers by TCP", resp, err)
+	}
+
+	if _, err := dnsQuery(s.Addr, "bad..name", dnsTypes["A"]); err == nil {
+		t.Error("query of an invalid name succeeded")
+	}
+}
+
+func TestDNSParse(t *testing.T) {
+	// an answer with the names compressed
+	msg := []byte{
+		0, 1, 0x84, 0, 0, 1, 0, 2, 0, 0, 0, 0,
+		// question, www.example.com MX at offset 12
+		3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 15, 0, 1,
+		// pointer to the question name, MX 10 mail.<example.com>
+		0xc0, 12, 0, 15, 0, 1, 0, 0, 0, 60, 0, 9, 0, 10, 4, 'm', 'a', 'i', 'l', 0xc0, 16,
+		// pointer to the question name, MX 20 <example.com>
+		0xc0, 12, 0, 15, 0, 1, 0, 0, 0, 60, 0, 4, 0, 20, 0xc0, 16,
+	}
+	resp, err := dnsParse(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := answerSet(answeredData(resp, "www.example.com.", dnsTypes["MX"]))
+	if want := "[10 mail.example.com., 20 example.com.]"; got != want {
+		t.Errorf("answers = %s, want %s", got, want)
+	}
+
+	for _, bad := range [][]byte{
+		msg[:11],
+		msg[:len(msg)-1],
+		// a query, not a response
+		append([]byte{0, 1, 0x04}, msg[3:]...),
+		// a pointer loop
+		{0, 1, 0x84, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0xc0, 12},
+	} {
+		if _, err := dnsParse(bad); err == nil {
+			t.Errorf("dnsParse(%x) succeeded", bad)
+		}
+	}
+}
+
+func TestAnswerData(t *testing.T) {
+	for _, tt := range []struct {
+		typ, data, want string
+	}{
+		{"A", "192.0.2.1", "192.0.2.1"},
+		{"AAAA", "2001:DB8:0::1", "2001:db8::1"},
+		{"CNAME", "www", "www.example.com."},
+		{"CNAME", "Other.Example.NET.", "other.example.net."},
+		{"CNAME", "@", "example.com."},
+		{"MX", "10 mail", "10 mail.example.com."},
+		{"SRV", "10 20 5060 sip.example.net.", "10 20 5060 sip.example.net."},
+		{"TXT", "v=spf1 -all", "v=spf1 -all"},
+		{"TXT", `"one" "two"`, `"one" "two"`},
+	} {
+		if got := answerData("example.com", dnsme.Record{Type: tt.typ, Data: tt.data}); got != tt.want {
+			t.Errorf("answerData of %s %q = %q, want %q", tt.typ, tt.data, got, tt.want)
+		}
+	}
+}
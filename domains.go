@@ -6,6 +6,8 @@ import (
 	"flag"
 	"os"
 	"strings"
+
+	"github.com/jswank/dnsme/dnsme"
 )
 
 var listDomains = &Command{
@@ -17,7 +19,7 @@ var listDomains = &Command{
 
 func runListDomains(cmd *Command, args []string) (err error) {
 
-	domains, err := getDomainList()
+	domains, err := client.Domains()
 	if err != nil {
 		return
 	}
@@ -29,7 +31,7 @@ func runListDomains(cmd *Command, args []string) (err error) {
 		}
 	case "json":
 		{
-			b, _ := json.Marshal(domains.List)
+			b, _ := json.Marshal(domains)
 			os.Stdout.Write(b)
 		}
 	}
@@ -55,7 +57,7 @@ func runInfoDomain(cmd *Command, args []string) (err error) {
 
 	domain := args[0]
 
-	info, err := getDomainInfo(domain)
+	info, err := client.Domain(domain)
 	if err != nil {
 		return
 	}
@@ -81,10 +83,17 @@ func runInfoDomain(cmd *Command, args []string) (err error) {
 }
 
 var delDomain = &Command{
-	Run:       runDeleteDomain,
-	UsageLine: "delete-domain <domain>",
-	Short:     "deletes a domain",
-	Long:      "'delete-domain' removes a domain.",
+	Run:         runDeleteDomain,
+	CustomFlags: flagDryRun,
+	UsageLine:   "delete-domain [-dry-run] <domain>",
+	Short:       "deletes a domain",
+	Long: `
+'delete-domain' removes a domain.
+
+-dry-run shows the domain and records that would be deleted, without
+deleting them.
+
+`,
 }
 
 func runDeleteDomain(cmd *Command, args []string) (err error) {
@@ -96,7 +105,22 @@ func runDeleteDomain(cmd *Command, args []string) (err error) {
 
 	domain := args[0]
 
-	err = deleteDomain(domain)
+	if dryRun(cmd) {
+		var records []dnsme.Record
+		records, err = client.Records(domain, nil)
+		if err != nil {
+			return
+		}
+		var changes []recordChange
+		for _, r := range records {
+			changes = append(changes, recordChange{Op: opDelete, Domain: domain, Record: r})
+		}
+		changes = append(changes, recordChange{Op: opDeleteDomain, Domain: domain})
+		outputChanges(os.Stdout, changes)
+		return
+	}
+
+	err = client.DeleteDomain(domain)
 	if err != nil {
 		return
 	}
@@ -131,9 +155,10 @@ func runAddDomain(cmd *Command, args []string) (err error) {
 
 	if len(args) == 0 {
 		err = errors.New("domain not specified")
+		return
 	}
 
-	domain := &apiDomain{}
+	domain := &dnsme.Domain{}
 	domain.Name = args[0]
 	if cmd.Flag.Lookup("ns").Value.String() != "" {
 		for _, ns := range strings.Split(cmd.Flag.Lookup("ns").Value.String(), ",") {
@@ -144,7 +169,7 @@ func runAddDomain(cmd *Command, args []string) (err error) {
 		domain.GtdEnabled = true
 	}
 
-	info, err := addDomain(*domain)
+	info, err := client.AddDomain(*domain)
 	if err != nil {
 		return
 	}
@@ -2,51 +2,99 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
-	//	"os"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
 )
 
 type exportDomain struct {
-	Domain  apiDomain   `json:"domain"`
-	Records []apiRecord `json:"records"`
+	Domain  dnsme.Domain   `json:"domain"`
+	Records []dnsme.Record `json:"records"`
 }
 
 var exportData = &Command{
-	Run: runExport,
-	//	CustomFlags: flagsExport,
-	UsageLine: "export [<domain>]",
-	Short:     "export domain info & records",
-	Long:      "'export' returns all domain information suitable for importing",
+	Run:         runExport,
+	CustomFlags: flagsExport,
+	UsageLine: `export [-format <json | zone>] [-dir <directory>] [-parallel <n>]
+    [<domain>...]`,
+	Short: "export domain info & records",
+	Long: `
+'export' returns all domain information suitable for importing.
+
+-format selects the export format:
+    json: a single JSON document containing every domain (default)
+    zone: an RFC 1035 master ("BIND") zone file for each domain
+
+Zone files include the SOA and apex NS records managed by DNS Made Easy.
+Records outside the DEFAULT Global Traffic Director location are
+annotated with a "; gtd=<location>" comment.  HTTPRED records are
+written as comments, as are MX and SRV records whose data has the
+wrong number of fields and records of types the exporter does not
+support, e.g. CAA, each of the latter with a warning.
+
+-dir writes each zone file to db.<domain> in the given directory instead
+of standard output.
+
+-parallel fetches up to n domains at once.  Requests still share the
+API rate limit, and the output is the same as a sequential export.
+Default value is 1.
+
+`,
+}
+
+func flagsExport(f *flag.FlagSet) {
+	f.String("format", "json", "")
+	f.String("dir", "", "")
+	flagParallel(f)
 }
 
 func runExport(cmd *Command, args []string) (err error) {
 
-	var domains apiDomainList
+	format := cmd.Flag.Lookup("format").Value.String()
+	dir := cmd.Flag.Lookup("dir").Value.String()
+
+	switch format {
+	case "json", "zone":
+	default:
+		err = fmt.Errorf("unknown export format %q", format)
+		return
+	}
+	if dir != "" && format != "zone" {
+		err = errors.New("-dir requires -format zone")
+		return
+	}
+
+	n, err := parallelism(cmd)
+	if err != nil {
+		return
+	}
+
+	var domains []string
 
 	if len(args) > 0 {
-		domains.List = args[0:]
+		domains = args[0:]
 	} else {
-		domains, err = getDomainList()
+		domains, err = client.Domains()
 		if err != nil {
 			return
 		}
-		sort.Strings(domains.List)
+		sort.Strings(domains)
 	}
 
-	var export_domains []exportDomain
+	export_domains, err := fetchDomains(n, domains)
+	if err != nil {
+		return
+	}
 
-	for _, domain := range domains.List {
-		var d exportDomain
-		d.Domain, err = getDomainInfo(domain)
-		if err != nil {
-			return
-		}
-		d.Records, err = getDomainRecords(domain, nil)
-		if err != nil {
-			return
-		}
-		export_domains = append(export_domains, d)
+	if format == "zone" {
+		err = exportZones(export_domains, dir)
+		return
 	}
 
 	b, err := json.Marshal(export_domains)
@@ -59,3 +107,62 @@ func runExport(cmd *Command, args []string) (err error) {
 	return
 
 }
+
+// fetchDomains returns the information and records of each of domains,
+// fetching up to n domains at once.
+func fetchDomains(n int, domains []string) (export_domains []exportDomain, err error) {
+
+	export_domains = make([]exportDomain, len(domains))
+	errs := make([]error, len(domains))
+
+	forEach(n, len(domains), func(i int) {
+		d := &export_domains[i]
+		d.Domain, errs[i] = client.Domain(domains[i])
+		if errs[i] != nil {
+			return
+		}
+		d.Records, errs[i] = client.Records(domains[i], nil)
+	})
+
+	for _, err = range errs {
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// exportZones writes a zone file for each domain, either to standard
+// output or to dir.
+func exportZones(domains []exportDomain, dir string) (err error) {
+
+	now := time.Now()
+
+	for i, d := range domains {
+		var warnings []string
+		if dir == "" {
+			if i > 0 {
+				fmt.Println()
+			}
+			warnings, err = writeZone(os.Stdout, d, now)
+		} else {
+			var f *os.File
+			f, err = os.Create(filepath.Join(dir, "db."+d.Domain.Name))
+			if err != nil {
+				return
+			}
+			warnings, err = writeZone(f, d, now)
+			if e := f.Close(); err == nil {
+				err = e
+			}
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
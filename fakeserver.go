@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+var fakeServer = &Command{
+	Run:         runFakeServer,
+	CustomFlags: flagsFakeServer,
+	Offline:     true,
+	UsageLine: `fake-server [-addr <address>] [-file <export file>]
+    [-limit <requests>] [-window <duration>]`,
+	Short: "run a local fake DNS Made Easy API",
+	Long: `
+'fake-server' runs an in-memory implementation of the V1.2 and V2.0
+APIs, useful for testing scripts without touching a real account.  Point
+dnsme at it with:
+
+    DNSME_API_URL=http://localhost:8080/V1.2
+
+or http://localhost:8080/V2.0 for the V2.0 API.
+
+-addr is the address to listen on.  Default value is "localhost:8080".
+
+-file is an export file (see 'dnsme help export') whose domains and
+records are loaded at startup.  Record IDs are reassigned.
+
+-limit is the number of requests allowed per -window, after which
+requests are rejected as rate limited.  Default values are 150 requests
+per 5m, as in production; a limit of 0 disables rate limiting.
+
+Requests must be signed with the key pair in DNSME_API_KEY and
+DNSME_SECRET_KEY, or those given with -key and -secret.  Dynamic DNS
+updates (see 'dnsme help ddns') are served at
+http://localhost:8080/servlet/updateip, with any username.
+
+`,
+}
+
+func flagsFakeServer(f *flag.FlagSet) {
+	f.String("addr", "localhost:8080", "")
+	f.String("file", "", "")
+	f.String("limit", strconv.Itoa(dnsmetest.DefaultRequestLimit), "")
+	f.String("window", dnsmetest.DefaultWindow.String(), "")
+	f.String("key", os.Getenv("DNSME_API_KEY"), "")
+	f.String("secret", os.Getenv("DNSME_SECRET_KEY"), "")
+}
+
+func runFakeServer(cmd *Command, args []string) (err error) {
+
+	s := dnsmetest.NewServer(cmd.Flag.Lookup("key").Value.String(), cmd.Flag.Lookup("secret").Value.String())
+
+	s.RequestLimit, err = strconv.Atoi(cmd.Flag.Lookup("limit").Value.String())
+	if err != nil {
+		return
+	}
+	s.Window, err = time.ParseDuration(cmd.Flag.Lookup("window").Value.String())
+	if err != nil {
+		return
+	}
+
+	if file := cmd.Flag.Lookup("file").Value.String(); file != "" {
+		var r *os.File
+		r, err = os.Open(file)
+		if err != nil {
+			return
+		}
+		defer r.Close()
+
+		var domains []exportDomain
+		err = json.NewDecoder(r).Decode(&domains)
+		if err != nil {
+			return
+		}
+		for _, d := range domains {
+			s.AddDomain(d.Domain)
+			for _, record := range d.Records {
+				s.AddRecord(d.Domain.Name, record)
+			}
+		}
+	}
+
+	addr := cmd.Flag.Lookup("addr").Value.String()
+	fmt.Fprintf(os.Stderr, "serving fake API at http://%s/V1.2 and http://%s/V2.0\n", addr, addr)
+	err = http.ListenAndServe(addr, s)
+
+	return
+}
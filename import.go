@@ -2,26 +2,57 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+
+	"github.com/jswank/dnsme/dnsme"
 )
 
 var importData = &Command{
 	Run:         runImport,
 	CustomFlags: flagsImport,
-	UsageLine:   "import [-file <export file>]",
-	Short:       "import domain info & records",
-	Long: `'import' imports JSON-encoded information into DNS Made Easy
+	UsageLine: `import [-file <export file>]
+    [-format zone -domain <domain>] [-parallel <n>] [-dry-run]`,
+	Short: "import domain info & records",
+	Long: `
+'import' imports JSON-encoded information into DNS Made Easy
 
 If no export file is specified, then standard input is used.
-	
+
+-format selects the format of the file:
+    json: the output of 'dnsme export' (default)
+    zone: an RFC 1035 master ("BIND") zone file
+
+A zone file is imported into the domain given by -domain, which is
+created if it does not exist.  $ORIGIN, $TTL and $INCLUDE directives are
+supported.  The SOA and apex NS records are managed by DNS Made Easy and
+are skipped.  Records of types DNS Made Easy does not support, or outside
+the domain, are reported and skipped.
+
+Every record is checked for a valid name, TTL and data for its type
+before anything is imported.  Invalid records are reported and skipped;
+the data of types such as CAA cannot be checked, and is imported with a
+warning.
+
+-parallel adds up to n records at once.  Requests still share the API
+rate limit.  Default value is 1.
+
+-dry-run shows the domains and records that would be created, without
+creating them.
+
 `,
 }
 
 func flagsImport(f *flag.FlagSet) {
 	f.String("file", "-", "Import file")
+	f.String("format", "json", "")
+	f.String("domain", "", "")
+	flagParallel(f)
+	flagDryRun(f)
 }
 
 func getReader(input string) (reader io.Reader, err error) {
@@ -41,41 +72,113 @@ func runImport(cmd *Command, args []string) (err error) {
 
 	var import_domains []exportDomain
 
+	n, err := parallelism(cmd)
+	if err != nil {
+		return
+	}
+
+	file := cmd.Flag.Lookup("file").Value.String()
+
 	// open file
-	r, err := getReader(cmd.Flag.Lookup("file").Value.String())
+	r, err := getReader(file)
 	if err != nil {
 		return
 	}
 
 	// parse it
-	d := json.NewDecoder(r)
-	err = d.Decode(&import_domains)
-	if err != nil {
+	switch format := cmd.Flag.Lookup("format").Value.String(); format {
+	case "json":
+		d := json.NewDecoder(r)
+		err = d.Decode(&import_domains)
+		if err != nil {
+			return
+		}
+	case "zone":
+		domain := strings.ToLower(cmd.Flag.Lookup("domain").Value.String())
+		if domain == "" {
+			err = errors.New("-domain is required with -format zone")
+			return
+		}
+
+		var d exportDomain
+		var warnings []string
+		d.Domain.Name = domain
+		d.Records, warnings, err = parseZone(r, file, domain)
+		if err != nil {
+			return
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+		}
+		import_domains = append(import_domains, d)
+	default:
+		err = fmt.Errorf("unknown import format %q", format)
 		return
 	}
 
+	// invalid records are reported and left out
+	import_domains, failed := validateRecords(os.Stderr, import_domains)
+
+	dry := dryRun(cmd)
+
+	var planned []recordChange
+
 	for _, d := range import_domains {
+		var changes []recordChange
+
 		// get domain info
 		// if it does not exist, create it
-		_, err = getDomainInfo(d.Domain.Name)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: %s\n", err)
-			_, e := addDomain(d.Domain)
+		_, err = client.Domain(d.Domain.Name)
+		if err == dnsme.ErrNotFound {
+			info := d.Domain
+			changes = append(changes, recordChange{Op: opCreateDomain, Domain: d.Domain.Name, Info: &info})
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %s\n", d.Domain.Name, err)
+			failed++
+			continue
+		}
+
+		for _, record := range d.Records {
+			record.ID = 0
+			changes = append(changes, recordChange{Op: opCreate, Domain: d.Domain.Name, Record: record})
+		}
+
+		if dry {
+			planned = append(planned, changes...)
+			continue
+		}
+
+		// the domain must exist before its records are added
+		if len(changes) > 0 && changes[0].Op == opCreateDomain {
+			e := applyChanges(changes[:1], nil)
 			if e != nil {
-				fmt.Fprintf(os.Stderr, "couldn't create domain %s: , %s", d.Domain.Name, e)
+				fmt.Fprintf(os.Stderr, "error: %s\n", e)
+				failed++
 				continue
 			}
+			changes = changes[1:]
 		}
 
-		for _, record := range d.Records {
-			record.ID = 0
-			_, err = addDomainRecord(d.Domain.Name, record)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "error adding record to domain %s: %+v, %s", d.Domain.Name, record, err)
+		errs := make([]error, len(changes))
+		forEach(n, len(changes), func(i int) {
+			errs[i] = applyChanges(changes[i:i+1], nil)
+		})
+		for _, e := range errs {
+			if e != nil {
+				fmt.Fprintf(os.Stderr, "error: %s\n", e)
+				failed++
 			}
 		}
 	}
 
+	err = nil
+	if dry {
+		outputChanges(os.Stdout, planned)
+	}
+	if failed > 0 {
+		err = fmt.Errorf("import failed: %d errors", failed)
+	}
+
 	return
 
 }
@@ -6,24 +6,18 @@ import (
 	"io"
 	"os"
 	"strings"
-)
-
-const (
-	// Production Values
-	API_URL = "http://api.dnsmadeeasy.com/V1.2"
+	"time"
 
-	// Development Values
-	//API_URL = "http://api.sandbox.dnsmadeeasy.com/V1.2"
+	"github.com/jswank/dnsme/dnsme"
 )
 
 var (
-	api_url    string
-	api_key    string
-	secret_key string
+	client *dnsme.Client
 
-	outputType        string
-	debug             bool
-	requestsRemaining int
+	outputType string
+	apiVersion string
+	maxWait    time.Duration
+	debug      bool
 )
 
 var commands = []*Command{
@@ -39,9 +33,23 @@ var commands = []*Command{
 	record,
 	addRecord,
 	updateRecord,
+	upsertRecord,
 	deleteRecord,
+	deleteRecords,
+	waitRecords,
+	verify,
+	ddns,
+	serveDDNS,
+	acme,
 	importData,
 	exportData,
+	syncData,
+	planData,
+	applyPlan,
+	snapshot,
+	audit,
+	saveCredentials,
+	fakeServer,
 	/*
 		addRecord,
 		search, */
@@ -70,6 +78,11 @@ type Command struct {
 	// CustomFlags indicates that the command will do its own
 	// flag parsing.
 	CustomFlags func(cmd *flag.FlagSet)
+
+	// Offline indicates that the command does not use the API, or sets
+	// up the client itself when it does, so no API credentials are
+	// required to run it.
+	Offline bool
 }
 
 // Name returns the command's name: the first word in the usage line.
@@ -108,23 +121,6 @@ func main() {
 		return
 	}
 
-	api_url = os.Getenv("DNSME_API_URL")
-	if api_url == "" {
-		api_url = API_URL
-	}
-
-	api_key = os.Getenv("DNSME_API_KEY")
-	if api_key == "" {
-		fmt.Fprint(os.Stderr, "DNSME_API_KEY environment variable is not set\n")
-		os.Exit(1)
-	}
-
-	secret_key = os.Getenv("DNSME_SECRET_KEY")
-	if secret_key == "" {
-		fmt.Fprint(os.Stderr, "DNSME_SECRET_KEY environment variable is not set\n")
-		os.Exit(1)
-	}
-
 	for _, cmd := range commands {
 		if cmd.Name() == args[0] && cmd.Run != nil {
 			addGlobalFlags(&cmd.Flag)
@@ -137,7 +133,22 @@ func main() {
 			cmd.Flag.Parse(args[1:])
 			args = cmd.Flag.Args()
 			//			}
-			err := cmd.Run(cmd, args)
+			p, err := loadProfile()
+			if err == nil {
+				err = applyProfile(p, cmd)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				os.Exit(1)
+			}
+			if !cmd.Offline {
+				err := newClient(p)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s\n", err)
+					os.Exit(1)
+				}
+			}
+			err = cmd.Run(cmd, args)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "%s\n", err)
 				os.Exit(1)
@@ -151,9 +162,74 @@ func main() {
 
 }
 
+// newClient configures the API client from the environment, falling
+// back to the profile p and its source of credentials.
+func newClient(p *profile) (err error) {
+
+	switch apiVersion {
+	case "", dnsme.V1, dnsme.V2:
+	default:
+		err = fmt.Errorf("unsupported API version %q", apiVersion)
+		return
+	}
+
+	api_url := os.Getenv("DNSME_API_URL")
+	if api_url == "" {
+		api_url = p.URL
+	}
+	if api_url == "" {
+		api_url = dnsme.DefaultURL
+		if apiVersion == dnsme.V2 {
+			api_url = dnsme.DefaultV2URL
+		}
+	}
+
+	api_key := os.Getenv("DNSME_API_KEY")
+	secret_key := os.Getenv("DNSME_SECRET_KEY")
+	if api_key == "" || secret_key == "" {
+		var creds credentials
+		creds, err = p.credentials()
+		if err != nil {
+			return
+		}
+		if api_key == "" {
+			api_key = creds.APIKey
+		}
+		if secret_key == "" {
+			secret_key = creds.SecretKey
+		}
+	}
+
+	if api_key == "" {
+		err = fmt.Errorf("DNSME_API_KEY environment variable is not set and profile %s has no API key", p.Name)
+		return
+	}
+	if secret_key == "" {
+		err = fmt.Errorf("DNSME_SECRET_KEY environment variable is not set and profile %s has no secret key", p.Name)
+		return
+	}
+
+	client = dnsme.NewClient(api_url, api_key, secret_key)
+	if apiVersion != "" {
+		client.Version = apiVersion
+	}
+	client.MaxWait = maxWait
+	client.Log = os.Stderr
+	client.Audit = auditLogger(p)
+	if debug {
+		client.Debug = os.Stderr
+	}
+
+	return
+}
+
 func addGlobalFlags(fs *flag.FlagSet) {
 	fs.StringVar(&outputType, "o", "std", "Output type (std, json, csv)")
+	fs.StringVar(&apiVersion, "api", "", "API version (1.2, 2.0)")
+	fs.DurationVar(&maxWait, "max-wait", dnsme.DefaultMaxWait, "Maximum wait for rate limits and retries")
 	fs.BoolVar(&debug, "d", false, "Debug output")
+	fs.StringVar(&profileName, "profile", "", "Config file profile")
+	fs.StringVar(&auditLog, "audit-log", "", "Audit log file, or off")
 }
 
 func printUsage(w io.Writer) {
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+// testAPI starts a fake API server for the given API version, and points
+// the client at it.  The config file is in a new temporary directory.
+func testAPI(t *testing.T, version string) *dnsmetest.Server {
+	t.Helper()
+
+	s := dnsmetest.NewServer("key", "secret")
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	client = dnsme.NewClient(ts.URL+"/V"+version, "key", "secret")
+	t.Setenv("DNSME_CONFIG", filepath.Join(t.TempDir(), "config"))
+	t.Setenv("DNSME_PROFILE", "")
+	return s
+}
+
+// run runs a command as main does, with args starting with the command
+// name, and returns what it wrote to stdout and stderr.
+func run(t *testing.T, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+
+	var cmd *Command
+	for _, c := range commands {
+		if c.Name() == args[0] {
+			// a fresh copy, as the flags of a command are parsed once
+			cmd = &Command{Run: c.Run, UsageLine: c.UsageLine, CustomFlags: c.CustomFlags, Offline: c.Offline}
+		}
+	}
+	if cmd == nil {
+		t.Fatalf("unknown command %s", args[0])
+	}
+
+	cmd.Flag.Init(cmd.Name(), flag.ContinueOnError)
+	cmd.Flag.SetOutput(io.Discard)
+	addGlobalFlags(&cmd.Flag)
+	if cmd.CustomFlags != nil {
+		cmd.CustomFlags(&cmd.Flag)
+	}
+	err = cmd.Flag.Parse(args[1:])
+	if err != nil {
+		return
+	}
+	p, err := loadProfile()
+	if err == nil {
+		err = applyProfile(p, cmd)
+	}
+	if err != nil {
+		return
+	}
+
+	// as in a new process, -dry-run of an earlier command does not apply
+	client.ReadOnly = false
+	client.Audit = auditLogger(p)
+
+	outFile, errFile := tempFile(t), tempFile(t)
+	saved := [2]*os.File{os.Stdout, os.Stderr}
+	os.Stdout, os.Stderr = outFile, errFile
+	defer func() {
+		os.Stdout, os.Stderr = saved[0], saved[1]
+		b, _ := os.ReadFile(outFile.Name())
+		stdout = string(b)
+		b, _ = os.ReadFile(errFile.Name())
+		stderr = string(b)
+	}()
+
+	err = cmd.Run(cmd, cmd.Flag.Args())
+	return
+}
+
+func tempFile(t *testing.T) *os.File {
+	t.Helper()
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// mustRun runs a command, failing the test if it fails, and returns its
+// standard output.
+func mustRun(t *testing.T, args ...string) string {
+	t.Helper()
+	stdout, stderr, err := run(t, args...)
+	if err != nil {
+		t.Fatalf("dnsme %s: %v\n%s", strings.Join(args, " "), err, stderr)
+	}
+	return stdout
+}
+
+// writeFile writes data to a new file in a temporary directory,
+// returning its name.
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// forVersions runs f as a subtest against a fake server for each API
+// version.
+func forVersions(t *testing.T, f func(t *testing.T, s *dnsmetest.Server)) {
+	for _, v := range []string{dnsme.V1, dnsme.V2} {
+		t.Run(v, func(t *testing.T) {
+			f(t, testAPI(t, v))
+		})
+	}
+}
+
+// recordsOf returns the name, type and data of the records of domain
+// held by s, one per line.
+func recordsOf(s *dnsmetest.Server, domain string) string {
+	var lines []string
+	for _, r := range s.Records(domain) {
+		lines = append(lines, strings.TrimSpace(r.Name+" "+r.Type+" "+r.Data))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sortedRecordsOf is recordsOf in sorted order, for records which are
+// created in no particular order.
+func sortedRecordsOf(s *dnsmetest.Server, domain string) string {
+	lines := strings.Split(recordsOf(s, domain), "\n")
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func TestDomainCommands(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		mustRun(t, "add-domain", "example.com")
+		mustRun(t, "add-domain", "example.org")
+
+		if out := mustRun(t, "domains"); out != "example.com\nexample.org\n" {
+			t.Errorf("domains = %q", out)
+		}
+
+		out := mustRun(t, "domain", "example.com")
+		if !strings.Contains(out, "Nameserver: ns0.dnsmadeeasy.com") {
+			t.Errorf("domain = %q, want its nameservers", out)
+		}
+
+		var info dnsme.Domain
+		if err := json.Unmarshal([]byte(mustRun(t, "domain", "-o", "json", "example.org")), &info); err != nil || info.Name != "example.org" {
+			t.Errorf("domain -o json = %+v, %v", info, err)
+		}
+
+		mustRun(t, "delete-domain", "example.org")
+		if out := mustRun(t, "domains"); out != "example.com\n" {
+			t.Errorf("domains after delete-domain = %q", out)
+		}
+
+		if _, _, err := run(t, "domain", "example.org"); err != dnsme.ErrNotFound {
+			t.Errorf("domain of a deleted domain: err = %v, want ErrNotFound", err)
+		}
+		if _, _, err := run(t, "add-domain"); err == nil {
+			t.Error("add-domain without a domain succeeded")
+		}
+	})
+}
+
+func TestSecondaryCommands(t *testing.T) {
+	testAPI(t, dnsme.V1)
+
+	mustRun(t, "add-secondary", "-ip", "192.0.2.53,192.0.2.54", "example.net")
+	if out := mustRun(t, "secondaries"); out != "example.net\n" {
+		t.Errorf("secondaries = %q", out)
+	}
+	if out := mustRun(t, "secondary", "example.net"); out != "IP: 192.0.2.53\nIP: 192.0.2.54\n" {
+		t.Errorf("secondary = %q", out)
+	}
+	mustRun(t, "delete-secondary", "example.net")
+	if out := mustRun(t, "secondaries"); out != "" {
+		t.Errorf("secondaries after delete-secondary = %q", out)
+	}
+
+	testAPI(t, dnsme.V2)
+	if _, _, err := run(t, "secondaries"); err != dnsme.ErrUnsupported {
+		t.Errorf("secondaries with V2: err = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestRecordCommands(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+		var added dnsme.Record
+		out := mustRun(t, "add-record", "-o", "json", "-name", "www", "-type", "A", "-data", "192.0.2.1", "-ttl", "300", "example.com")
+		if err := json.Unmarshal([]byte(out), &added); err != nil || added.ID == 0 {
+			t.Fatalf("add-record -o json = %q, %v", out, err)
+		}
+		mustRun(t, "add-record", "-name", "", "-type", "MX", "-data", "10 mail.example.com.", "example.com")
+		mustRun(t, "add-record", "-name", "ftp", "-type", "CNAME", "-data", "example.com.", "example.com")
+
+		if got := recordsOf(s, "example.com"); got != "www A 192.0.2.1\nMX 10 mail.example.com.\nftp CNAME example.com." {
+			t.Errorf("records after add-record:\n%s", got)
+		}
+
+		out = mustRun(t, "records", "example.com")
+		for _, want := range []string{"www ", "192.0.2.1", "@ ", "10 mail.example.com.", "ftp", "CNAME example.com."} {
+			if !strings.Contains(out, want) {
+				t.Errorf("records output lacks %q:\n%s", want, out)
+			}
+		}
+
+		out = mustRun(t, "records", "-type", "MX", "-o", "csv", "example.com")
+		if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 1 || !strings.HasPrefix(lines[0], ",3600,MX,10 mail.example.com.,") {
+			t.Errorf("records -type MX -o csv = %q", out)
+		}
+
+		id := strconv.Itoa(added.ID)
+		out = mustRun(t, "record", "-id", id, "example.com")
+		if !strings.Contains(out, "192.0.2.1") {
+			t.Errorf("record -id %s = %q", id, out)
+		}
+
+		mustRun(t, "update-record", "-id", id, "-name", "www", "-type", "A", "-data", "192.0.2.2", "-ttl", "600", "example.com")
+		r := s.Records("example.com")[0]
+		if r.Data != "192.0.2.2" || r.TTL != 600 {
+			t.Errorf("record after update-record = %+v", r)
+		}
+
+		mustRun(t, "delete-record", "-id", id, "example.com")
+		if got := recordsOf(s, "example.com"); got != "MX 10 mail.example.com.\nftp CNAME example.com." {
+			t.Errorf("records after delete-record:\n%s", got)
+		}
+
+		if _, _, err := run(t, "record", "-id", id, "example.com"); err != dnsme.ErrNotFound {
+			t.Errorf("record of a deleted record: err = %v, want ErrNotFound", err)
+		}
+		if _, _, err := run(t, "add-record", "-name", "x", "-type", "A", "example.com"); err == nil {
+			t.Error("add-record without data succeeded")
+		}
+	})
+}
+
+func TestExportImport(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+		s.AddRecord("example.com", dnsme.Record{Name: "", Type: "MX", Data: "10 mail.example.com.", TTL: 3600, GtdLocation: "DEFAULT"})
+		s.AddRecord("example.com", dnsme.Record{Name: "ftp", Type: "CNAME", Data: "example.com.", TTL: 3600, GtdLocation: "DEFAULT"})
+
+		exported := mustRun(t, "export", "example.com")
+		var domains []exportDomain
+		if err := json.Unmarshal([]byte(exported), &domains); err != nil || len(domains) != 1 || len(domains[0].Records) != 3 {
+			t.Fatalf("export = %q, %v", exported, err)
+		}
+		want := recordsOf(s, "example.com")
+
+		// import into a new account
+		s = testAPI(t, client.Version)
+		mustRun(t, "import", "-file", writeFile(t, "export.json", exported))
+		if got := recordsOf(s, "example.com"); got != want {
+			t.Errorf("records after import:\n%s\nwant:\n%s", got, want)
+		}
+	})
+}
+
+func TestMissingDomain(t *testing.T) {
+	testAPI(t, dnsme.V1)
+	for _, name := range []string{"domain", "delete-domain", "secondary", "delete-secondary", "records", "record", "add-record", "update-record", "delete-record", "add-domain", "add-secondary"} {
+		if _, _, err := run(t, name); err == nil || err.Error() != "domain not specified" {
+			t.Errorf("%s without a domain: err = %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// flagParallel adds the -parallel flag to a command.
+func flagParallel(f *flag.FlagSet) {
+	f.String("parallel", "1", "")
+}
+
+// parallelism returns the value of the -parallel flag.
+func parallelism(cmd *Command) (n int, err error) {
+	s := cmd.Flag.Lookup("parallel").Value.String()
+	n, err = strconv.Atoi(s)
+	if err != nil || n < 1 {
+		err = fmt.Errorf("invalid -parallel %q", s)
+	}
+	return
+}
+
+// forEach calls fn for every index in [0, count), running at most n
+// calls at a time.  All calls share the client, and so its rate limit.
+func forEach(n, count int, fn func(i int)) {
+
+	if n < 1 {
+		n = 1
+	}
+
+	var wg sync.WaitGroup
+	next := make(chan int)
+
+	for w := 0; w < n && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
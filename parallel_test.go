@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+func TestForEach(t *testing.T) {
+	for _, n := range []int{0, 1, 4, 100} {
+		var mu sync.Mutex
+		running, most := 0, 0
+		done := make([]bool, 20)
+
+		forEach(n, len(done), func(i int) {
+			mu.Lock()
+			running++
+			if running > most {
+				most = running
+			}
+			mu.Unlock()
+
+			done[i] = true
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+
+		for i, ok := range done {
+			if !ok {
+				t.Errorf("forEach(%d): %d not done", n, i)
+			}
+		}
+		if most > n && most > 1 {
+			t.Errorf("forEach(%d): %d calls at once", n, most)
+		}
+	}
+}
+
+func TestParallelism(t *testing.T) {
+	testAPI(t, dnsme.V1)
+	for _, v := range []string{"0", "-1", "x"} {
+		if _, _, err := run(t, "export", "-parallel", v); err == nil {
+			t.Errorf("export -parallel %s succeeded", v)
+		}
+	}
+}
+
+func TestParallelExportImport(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		for i := 0; i < 10; i++ {
+			domain := fmt.Sprintf("example%d.com", i)
+			for j := 0; j < 5; j++ {
+				s.AddRecord(domain, dnsme.Record{Name: fmt.Sprintf("host%d", j), Type: "A", Data: fmt.Sprintf("192.0.2.%d", j), TTL: 300, GtdLocation: "DEFAULT"})
+			}
+		}
+
+		exported := mustRun(t, "export", "-parallel", "4")
+		if sequential := mustRun(t, "export"); exported != sequential {
+			t.Errorf("export -parallel 4 differs from export:\n%s\n%s", exported, sequential)
+		}
+
+		var domains []exportDomain
+		if err := json.Unmarshal([]byte(exported), &domains); err != nil || len(domains) != 10 {
+			t.Fatalf("export -parallel 4 = %q, %v", exported, err)
+		}
+		for i, d := range domains {
+			if d.Domain.Name != fmt.Sprintf("example%d.com", i) || len(d.Records) != 5 {
+				t.Errorf("domain %d = %s with %d records", i, d.Domain.Name, len(d.Records))
+			}
+		}
+
+		// records are added concurrently, so in no particular order
+		want := sortedRecordsOf(s, "example3.com")
+		s = testAPI(t, client.Version)
+		mustRun(t, "import", "-parallel", "4", "-file", writeFile(t, "export.json", exported))
+		for i := 0; i < 10; i++ {
+			if got := len(s.Records(fmt.Sprintf("example%d.com", i))); got != 5 {
+				t.Errorf("example%d.com has %d records after import -parallel 4, want 5", i, got)
+			}
+		}
+		if got := sortedRecordsOf(s, "example3.com"); got != want {
+			t.Errorf("example3.com after import -parallel 4:\n%s\nwant:\n%s", got, want)
+		}
+	})
+}
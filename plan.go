@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// A planFile is a saved change set, written by 'plan -out'.
+// Fingerprints holds, for each domain, the fingerprint of the records
+// the changes were computed against (see recordsFingerprint).
+type planFile struct {
+	Created      time.Time         `json:"created"`
+	Fingerprints map[string]string `json:"fingerprints"`
+	Changes      []recordChange    `json:"changes"`
+}
+
+var planData = &Command{
+	Run:         runPlan,
+	CustomFlags: flagsPlan,
+	UsageLine:   "plan [-file <export file>] [-out <plan file>] [<domain>...]",
+	Short:       "show the changes sync would make",
+	Long: `
+'plan' compares the domains in an export file with the live records and
+shows the changes 'sync' would make, without making them.
+
+Changes are shown one per line in the style of the 'records' output,
+prefixed with "+" for records to be created, "-" for records to be
+deleted and "~" for records to be updated.  Use "-o json" or "-o csv"
+for machine-readable output.
+
+-out saves the plan to a file instead of printing it.  The plan records
+the state of each domain it was computed against, and can be applied
+with 'dnsme apply' as long as that state has not changed.
+
+If domains are given, only those domains from the file are planned.
+
+If no export file is specified, then standard input is used.
+
+`,
+}
+
+func flagsPlan(f *flag.FlagSet) {
+	f.String("file", "-", "")
+	f.String("out", "", "")
+}
+
+func runPlan(cmd *Command, args []string) (err error) {
+
+	client.ReadOnly = true
+
+	r, err := getReader(cmd.Flag.Lookup("file").Value.String())
+	if err != nil {
+		return
+	}
+
+	var desired []exportDomain
+	err = json.NewDecoder(r).Decode(&desired)
+	if err != nil {
+		return
+	}
+
+	desired, err = selectDomains(desired, args)
+	if err != nil {
+		return
+	}
+
+	desired, skipped := validDomains(os.Stderr, desired)
+
+	var changes []recordChange
+	fingerprints := make(map[string]string)
+	for _, d := range desired {
+		var c []recordChange
+		c, fingerprints[d.Domain.Name], err = domainChanges(d)
+		if err != nil {
+			return
+		}
+		changes = append(changes, c...)
+	}
+
+	if out := cmd.Flag.Lookup("out").Value.String(); out != "" {
+		err = writePlan(out, planFile{Created: time.Now().UTC(), Fingerprints: fingerprints, Changes: changes})
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "plan with %d changes saved to %s\n", len(changes), out)
+	} else {
+		outputChanges(os.Stdout, changes)
+	}
+
+	if skipped > 0 {
+		err = fmt.Errorf("%d domains skipped for invalid records", skipped)
+	}
+	return
+}
+
+func writePlan(name string, p planFile) (err error) {
+
+	if p.Changes == nil {
+		p.Changes = []recordChange{}
+	}
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return
+	}
+	_, err = f.Write(append(b, '\n'))
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return
+}
+
+func readPlan(name string) (p planFile, err error) {
+
+	r, err := getReader(name)
+	if err != nil {
+		return
+	}
+
+	err = json.NewDecoder(r).Decode(&p)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", name, err)
+	}
+	return
+}
+
+// recordsFingerprint returns a digest of the records of a domain which
+// changes whenever any record is added, removed or modified.  absent
+// indicates that the domain does not exist.
+func recordsFingerprint(records []dnsme.Record, absent bool) string {
+
+	if absent {
+		return "absent"
+	}
+
+	sorted := make([]dnsme.Record, len(records))
+	copy(sorted, records)
+	sort.Sort(byRecordID(sorted))
+
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, r := range sorted {
+		r.Error = nil
+		enc.Encode(r)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
+
+// liveFingerprint returns the fingerprint of the live records of domain.
+func liveFingerprint(domain string) (fingerprint string, err error) {
+
+	_, err = client.Domain(domain)
+	if err == dnsme.ErrNotFound {
+		return recordsFingerprint(nil, true), nil
+	}
+	if err != nil {
+		return
+	}
+
+	records, err := client.Records(domain, nil)
+	if err != nil {
+		return
+	}
+	fingerprint = recordsFingerprint(records, false)
+	return
+}
+
+type byRecordID []dnsme.Record
+
+func (r byRecordID) Len() int           { return len(r) }
+func (r byRecordID) Less(i, j int) bool { return r[i].ID < r[j].ID }
+func (r byRecordID) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+var applyPlan = &Command{
+	Run:       runApply,
+	UsageLine: "apply <plan file>",
+	Short:     "apply a plan saved by plan -out",
+	Long: `
+'apply' makes the changes in a plan file saved by 'dnsme plan -out'.
+
+Before anything is changed, the live records of every domain in the
+plan are compared with the records the plan was computed against.  If
+any domain has changed since the plan was made, nothing is applied and
+the plan must be made again.
+
+Changes are shown as they are applied, in the style of 'dnsme plan'.
+
+`,
+}
+
+func runApply(cmd *Command, args []string) (err error) {
+
+	if len(args) == 0 {
+		err = errors.New("plan file not specified")
+		return
+	}
+
+	p, err := readPlan(args[0])
+	if err != nil {
+		return
+	}
+
+	// every domain changed must have been fingerprinted
+	for _, c := range p.Changes {
+		if _, ok := p.Fingerprints[c.Domain]; !ok {
+			err = fmt.Errorf("plan has no fingerprint for domain %s", c.Domain)
+			return
+		}
+	}
+
+	var domains, stale []string
+	for domain := range p.Fingerprints {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	for _, domain := range domains {
+		var fingerprint string
+		fingerprint, err = liveFingerprint(domain)
+		if err != nil {
+			return
+		}
+		if fingerprint != p.Fingerprints[domain] {
+			stale = append(stale, domain)
+		}
+	}
+	if len(stale) > 0 {
+		err = fmt.Errorf("plan is stale: %s changed since %s; run plan again",
+			strings.Join(stale, ", "), p.Created.Format(time.RFC1123))
+		return
+	}
+
+	var applied []recordChange
+	err = applyChanges(p.Changes, func(c recordChange) {
+		applied = append(applied, c)
+		if outputType != "json" {
+			printChange(os.Stdout, c)
+		}
+	})
+
+	if outputType == "json" {
+		b, _ := json.Marshal(applied)
+		os.Stdout.Write(b)
+	}
+
+	return
+}
+
+// flagDryRun adds the -dry-run flag to a command.
+func flagDryRun(f *flag.FlagSet) {
+	f.Bool("dry-run", false, "")
+}
+
+// dryRun reports whether the -dry-run flag is set.  If it is, the client
+// is made read-only so that nothing can be changed.
+func dryRun(cmd *Command) bool {
+	f := cmd.Flag.Lookup("dry-run")
+	if f == nil || f.Value.String() != "true" {
+		return false
+	}
+	client.ReadOnly = true
+	return true
+}
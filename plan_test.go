@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+func TestPlan(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+		s.AddRecord("example.com", dnsme.Record{Name: "old", Type: "A", Data: "192.0.2.2", TTL: 300, GtdLocation: "DEFAULT"})
+		before := recordsOf(s, "example.com")
+
+		file := exportFile(t, exportDomain{Domain: dnsme.Domain{Name: "example.com"}, Records: []dnsme.Record{
+			{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 600},
+			{Name: "new", Type: "A", Data: "192.0.2.3", TTL: 300},
+		}})
+
+		out := mustRun(t, "plan", "-file", file)
+		for _, want := range []string{"- example.com: old", "~ example.com: www", "; was ttl=300", "+ example.com: new", "1 to create, 1 to update, 1 to delete."} {
+			if !strings.Contains(out, want) {
+				t.Errorf("plan output lacks %q:\n%s", want, out)
+			}
+		}
+
+		var changes []recordChange
+		if err := json.Unmarshal([]byte(mustRun(t, "plan", "-o", "json", "-file", file)), &changes); err != nil || len(changes) != 3 {
+			t.Errorf("plan -o json = %+v, %v", changes, err)
+		}
+
+		out = mustRun(t, "plan", "-o", "csv", "-file", file)
+		if !strings.HasPrefix(out, "delete,example.com,old,") {
+			t.Errorf("plan -o csv:\n%s", out)
+		}
+
+		if got := recordsOf(s, "example.com"); got != before {
+			t.Errorf("records changed by plan:\n%s", got)
+		}
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+		before := recordsOf(s, "example.com")
+
+		for _, tt := range []struct {
+			args []string
+			want string
+		}{
+			{[]string{"add-record", "-dry-run", "-name", "ftp", "-type", "A", "-data", "192.0.2.2", "example.com"}, "+ example.com: ftp"},
+			{[]string{"update-record", "-dry-run", "-name", "www", "-type", "A", "-ttl", "60", "example.com"}, "~ example.com: www"},
+			{[]string{"delete-record", "-dry-run", "-name", "www", "-type", "A", "example.com"}, "- example.com: www"},
+			{[]string{"delete-domain", "-dry-run", "example.com"}, "- example.com: domain"},
+			{[]string{"import", "-dry-run", "-file", exportFile(t, exportDomain{Domain: dnsme.Domain{Name: "example.org"}, Records: []dnsme.Record{{Name: "www", Type: "A", Data: "192.0.2.3", TTL: 300}}})}, "+ example.org: www"},
+		} {
+			out := mustRun(t, tt.args...)
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("%s: output lacks %q:\n%s", strings.Join(tt.args, " "), tt.want, out)
+			}
+		}
+
+		if got := recordsOf(s, "example.com"); got != before {
+			t.Errorf("records changed by -dry-run:\n%s", got)
+		}
+		if out := mustRun(t, "domains"); out != "example.com\n" {
+			t.Errorf("domains after -dry-run = %q", out)
+		}
+	})
+}
+
+func TestApply(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+
+		file := exportFile(t,
+			exportDomain{Domain: dnsme.Domain{Name: "example.com"}, Records: []dnsme.Record{{Name: "new", Type: "A", Data: "192.0.2.3", TTL: 300}}},
+			exportDomain{Domain: dnsme.Domain{Name: "example.org"}, Records: []dnsme.Record{{Name: "www", Type: "A", Data: "192.0.2.4", TTL: 300}}},
+		)
+		plan := writeFile(t, "change.plan", "")
+
+		mustRun(t, "plan", "-file", file, "-out", plan)
+		p, err := readPlan(plan)
+		if err != nil || len(p.Changes) != 4 || p.Fingerprints["example.org"] != "absent" {
+			t.Fatalf("plan file = %+v, %v", p, err)
+		}
+
+		out := mustRun(t, "apply", plan)
+		if !strings.Contains(out, "+ example.org: domain") || !strings.Contains(out, "- example.com: www") {
+			t.Errorf("apply output:\n%s", out)
+		}
+		if got := recordsOf(s, "example.com"); got != "new A 192.0.2.3" {
+			t.Errorf("example.com after apply:\n%s", got)
+		}
+		if got := recordsOf(s, "example.org"); got != "www A 192.0.2.4" {
+			t.Errorf("example.org after apply:\n%s", got)
+		}
+
+		// the domains have changed since the plan was made
+		if _, _, err := run(t, "apply", plan); err == nil || !strings.Contains(err.Error(), "plan is stale: example.com, example.org changed") {
+			t.Errorf("apply of a stale plan: err = %v", err)
+		}
+	})
+}
+
+func TestApplyStale(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+
+		file := exportFile(t, exportDomain{Domain: dnsme.Domain{Name: "example.com"}, Records: []dnsme.Record{{Name: "new", Type: "A", Data: "192.0.2.3", TTL: 300}}})
+		plan := writeFile(t, "change.plan", "")
+		mustRun(t, "plan", "-file", file, "-out", plan)
+
+		s.AddRecord("example.com", dnsme.Record{Name: "ftp", Type: "A", Data: "192.0.2.2", TTL: 300, GtdLocation: "DEFAULT"})
+		if _, _, err := run(t, "apply", plan); err == nil || !strings.Contains(err.Error(), "plan is stale") {
+			t.Errorf("apply after a record was added: err = %v", err)
+		}
+		if got := recordsOf(s, "example.com"); got != "www A 192.0.2.1\nftp A 192.0.2.2" {
+			t.Errorf("records changed by a stale apply:\n%s", got)
+		}
+
+		if _, _, err := run(t, "apply"); err == nil {
+			t.Error("apply without a plan file succeeded")
+		}
+	})
+}
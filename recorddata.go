@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// maxTXTString is the longest character string a TXT record may hold;
+// longer text is split over several strings.
+const maxTXTString = 255
+
+// stringList is a flag which may be repeated, collecting each value.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, " ") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// flagsRecordData adds the flags from which composeData builds the data
+// of MX, SRV and TXT records.
+func flagsRecordData(f *flag.FlagSet) {
+	f.String("priority", "", "")
+	f.String("weight", "", "")
+	f.String("port", "", "")
+	f.String("target", "", "")
+	f.Var(&stringList{}, "txt", "")
+}
+
+// composeData sets the data of rec from -priority, -weight, -port and
+// -target for MX and SRV records, or from -txt for TXT records.  These
+// cannot be combined with -data.
+func composeData(cmd *Command, rec *dnsme.Record) (err error) {
+
+	value := func(name string) string { return cmd.Flag.Lookup(name).Value.String() }
+	txt := *cmd.Flag.Lookup("txt").Value.(*stringList)
+
+	var given []string
+	for _, name := range []string{"priority", "weight", "port", "target"} {
+		if value(name) != "" {
+			given = append(given, "-"+name)
+		}
+	}
+	if len(txt) > 0 {
+		given = append(given, "-txt")
+	}
+	if len(given) == 0 {
+		return
+	}
+	if rec.Data != "" {
+		err = fmt.Errorf("-data cannot be combined with %s", strings.Join(given, ", "))
+		return
+	}
+
+	var want []string
+	switch rec.Type {
+	case "MX":
+		want = []string{"priority", "target"}
+	case "SRV":
+		want = []string{"priority", "weight", "port", "target"}
+	case "TXT", "SPF":
+		if len(given) > 1 || given[0] != "-txt" {
+			err = fmt.Errorf("%s records only take -txt", rec.Type)
+			return
+		}
+		rec.Data = composeTXT(txt)
+		return
+	case "":
+		err = fmt.Errorf("-type is required with %s", strings.Join(given, ", "))
+		return
+	default:
+		err = fmt.Errorf("%s cannot be used with %s records", strings.Join(given, ", "), rec.Type)
+		return
+	}
+
+	if len(txt) > 0 {
+		err = fmt.Errorf("-txt cannot be used with %s records", rec.Type)
+		return
+	}
+
+	var f []string
+	for _, name := range want {
+		v := value(name)
+		if v == "" {
+			err = fmt.Errorf("%s records require %s", rec.Type, "-"+strings.Join(want, ", -"))
+			return
+		}
+		f = append(f, v)
+	}
+	if len(given) > len(want) {
+		err = errors.New("-weight and -port are only used with SRV records")
+		return
+	}
+	rec.Data = strings.Join(f, " ")
+	return
+}
+
+// composeTXT joins text into TXT record data, splitting it into
+// character strings of at most 255 bytes.  A single string is plain
+// text; several are quoted, as in a master file.
+func composeTXT(text []string) string {
+
+	var strs []string
+	for _, t := range text {
+		b := []byte(t)
+		for len(b) > maxTXTString {
+			strs = append(strs, string(b[:maxTXTString]))
+			b = b[maxTXTString:]
+		}
+		strs = append(strs, string(b))
+	}
+
+	if len(strs) == 1 {
+		return strs[0]
+	}
+
+	var quoted []string
+	for _, s := range strs {
+		quoted = append(quoted, zoneQuote([]byte(s)))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// recordFields are the parts of the data of MX, SRV and TXT records.
+type recordFields struct {
+	Priority string
+	Weight   string
+	Port     string
+	Target   string
+	TXT      []string
+}
+
+// splitData breaks the data of r into its parts.  Data that does not
+// have the form expected for the record type is left whole.
+func splitData(r dnsme.Record) (fields recordFields) {
+
+	f := strings.Fields(r.Data)
+
+	switch r.Type {
+	case "MX":
+		if len(f) == 2 {
+			fields.Priority, fields.Target = f[0], f[1]
+		}
+	case "SRV":
+		if len(f) == 4 {
+			fields.Priority, fields.Weight, fields.Port, fields.Target = f[0], f[1], f[2], f[3]
+		}
+	case "TXT", "SPF":
+		fields.TXT = []string{r.Data}
+		if strings.HasPrefix(r.Data, `"`) {
+			lines, err := zoneLines([]byte(r.Data))
+			if err != nil || len(lines) != 1 {
+				break
+			}
+			fields.TXT = nil
+			for _, t := range lines[0].tokens {
+				fields.TXT = append(fields.TXT, t.text)
+			}
+		}
+	}
+	return
+}
+
+// String describes the fields as a comment in the 'records' output.
+func (f recordFields) String() string {
+	var s []string
+	for _, field := range []struct{ name, value string }{
+		{"priority", f.Priority}, {"weight", f.Weight}, {"port", f.Port}, {"target", f.Target},
+	} {
+		if field.value != "" {
+			s = append(s, field.name+"="+field.value)
+		}
+	}
+	for _, t := range f.TXT {
+		s = append(s, "txt="+strconv.Quote(t))
+	}
+	if len(s) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(s, ", ")
+}
+
+// csv returns the fields as CSV columns: priority, weight, port, target
+// and the text of a TXT record.
+func (f recordFields) csv() []string {
+	return []string{f.Priority, f.Weight, f.Port, f.Target, strings.Join(f.TXT, "")}
+}
+
+// A splitRecord is a record displayed with its data broken into parts
+// by -split.
+type splitRecord struct {
+	dnsme.Record
+	Fields recordFields
+}
+
+var splitRecordTemplate = strings.TrimSuffix(recordTemplate, "\n") + "{{.Fields}}\n"
+
+// flagSplit adds the -split flag to a command.
+func flagSplit(f *flag.FlagSet) {
+	f.Bool("split", false, "")
+}
+
+func split(cmd *Command) bool {
+	f := cmd.Flag.Lookup("split")
+	return f != nil && f.Value.String() == "true"
+}
+
+// printRecord writes r in the std output format, followed by the parts
+// of its data if -split is set.
+func printRecord(cmd *Command, w io.Writer, r dnsme.Record) {
+	if split(cmd) {
+		tmpl(w, splitRecordTemplate, splitRecord{r, splitData(r)})
+		return
+	}
+	tmpl(w, recordTemplate, r)
+}
+
+// recordColumns returns the CSV columns of r, followed by the parts of
+// its data if -split is set.
+func recordColumns(cmd *Command, r dnsme.Record) []string {
+	columns := recordCSV(r)
+	if split(cmd) {
+		columns = append(columns, splitData(r).csv()...)
+	}
+	return columns
+}
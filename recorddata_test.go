@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+func TestComposeTXT(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	for _, tt := range []struct {
+		text []string
+		want string
+	}{
+		{[]string{"v=spf1 -all"}, "v=spf1 -all"},
+		{[]string{"one", "two"}, `"one" "two"`},
+		{[]string{`say "hi"`, "x"}, `"say \"hi\"" "x"`},
+		{[]string{long}, `"` + long[:255] + `" "` + long[255:] + `"`},
+	} {
+		if got := composeTXT(tt.text); got != tt.want {
+			t.Errorf("composeTXT(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSplitData(t *testing.T) {
+	for _, tt := range []struct {
+		r    dnsme.Record
+		want string
+	}{
+		{dnsme.Record{Type: "MX", Data: "10 mail.example.com."}, ", priority=10, target=mail.example.com."},
+		{dnsme.Record{Type: "SRV", Data: "10 20 5060 sip.example.com."}, ", priority=10, weight=20, port=5060, target=sip.example.com."},
+		{dnsme.Record{Type: "TXT", Data: "v=spf1 -all"}, `, txt="v=spf1 -all"`},
+		{dnsme.Record{Type: "TXT", Data: `"one" "two"`}, `, txt="one", txt="two"`},
+		{dnsme.Record{Type: "MX", Data: "mail.example.com."}, ""},
+		{dnsme.Record{Type: "A", Data: "192.0.2.1"}, ""},
+	} {
+		if got := splitData(tt.r).String(); got != tt.want {
+			t.Errorf("splitData(%s %q) = %q, want %q", tt.r.Type, tt.r.Data, got, tt.want)
+		}
+	}
+
+	if got := splitData(dnsme.Record{Type: "SRV", Data: "10 20 5060 sip."}).csv(); strings.Join(got, ",") != "10,20,5060,sip.," {
+		t.Errorf("csv of an SRV record = %q", got)
+	}
+}
+
+func TestRecordDataFlags(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddDomain(dnsme.Domain{Name: "example.com"})
+		long := strings.Repeat("a", 300)
+
+		mustRun(t, "add-record", "-name", "", "-type", "MX", "-priority", "10", "-target", "mail.example.com.", "example.com")
+		mustRun(t, "add-record", "-name", "_sip._tcp", "-type", "SRV", "-priority", "10", "-weight", "20", "-port", "5060", "-target", "sip.example.com.", "example.com")
+		mustRun(t, "add-record", "-name", "txt", "-type", "TXT", "-txt", long, "-txt", "b", "example.com")
+
+		want := "MX 10 mail.example.com.\n_sip._tcp SRV 10 20 5060 sip.example.com.\ntxt TXT \"" + long[:255] + "\" \"" + long[255:] + "\" \"b\""
+		if got := recordsOf(s, "example.com"); got != want {
+			t.Errorf("records after add-record:\n%s\nwant:\n%s", got, want)
+		}
+
+		// only the port changes
+		mustRun(t, "update-record", "-name", "_sip._tcp", "-type", "SRV", "-priority", "10", "-weight", "20", "-port", "5061", "-target", "sip.example.com.", "example.com")
+		if r := s.Records("example.com")[1]; r.Data != "10 20 5061 sip.example.com." {
+			t.Errorf("SRV record after update-record = %q", r.Data)
+		}
+
+		out := mustRun(t, "records", "-split", "-type", "SRV", "example.com")
+		if !strings.Contains(out, "priority=10, weight=20, port=5061, target=sip.example.com.") {
+			t.Errorf("records -split:\n%s", out)
+		}
+		out = mustRun(t, "records", "-split", "-o", "csv", "-type", "MX", "example.com")
+		if !strings.HasSuffix(strings.TrimSpace(out), ",10,,,mail.example.com.,") {
+			t.Errorf("records -split -o csv:\n%s", out)
+		}
+
+		for _, args := range [][]string{
+			{"-type", "MX", "-data", "10 mail.example.com.", "-priority", "10"},
+			{"-type", "MX", "-priority", "10"},
+			{"-type", "MX", "-priority", "10", "-weight", "0", "-target", "mail."},
+			{"-type", "TXT", "-priority", "10"},
+			{"-type", "A", "-txt", "x"},
+			{"-txt", "x"},
+		} {
+			args = append(append([]string{"add-record", "-name", "bad"}, args...), "example.com")
+			if _, _, err := run(t, args...); err == nil {
+				t.Errorf("%s succeeded", strings.Join(args, " "))
+			}
+		}
+	})
+}
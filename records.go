@@ -5,15 +5,20 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"net/url"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+
+	"github.com/jswank/dnsme/dnsme"
 )
 
 var records = &Command{
 	Run:         runRecords,
 	CustomFlags: flagsRecords,
-	UsageLine:   "records [filter flags] <domain>",
+	UsageLine:   "records [filter flags] [-split] <domain>",
 	Short:       "return records in a domain",
 	Long: `
 'records' returns a list of all record objects for the specified domain.
@@ -33,16 +38,84 @@ record type.
 
 -valueContains <text> an exact match of the record value
 
+-nameRegexp <regexp> a regular expression match of the record name
+
+-valueRegexp <regexp> a regular expression match of the record value
+
+-split shows the parts of the data of MX, SRV and TXT records
+separately: the priority, weight, port and target, and the text of each
+TXT string.  With "-o csv", these are added as the columns priority,
+weight, port, target and txt, after the HTTPRED columns.
+
 `,
 }
 
 func flagsRecords(f *flag.FlagSet) {
-	f.String("gtdLocation", "", "")
-	f.String("type", "", "")
-	f.String("name", "", "")
-	f.String("nameContains", "", "")
-	f.String("value", "", "")
-	f.String("valueContains", "", "")
+	flagsFilter(f)
+	flagSplit(f)
+}
+
+// filterParams are the filter flags passed to the API.
+var filterParams = []string{"gtdLocation", "type", "name", "nameContains", "value", "valueContains"}
+
+// flagsFilter adds the filter flags read by filterRecords.
+func flagsFilter(f *flag.FlagSet) {
+	for _, param := range filterParams {
+		f.String(param, "", "")
+	}
+	f.String("nameRegexp", "", "")
+	f.String("valueRegexp", "", "")
+}
+
+// filterRecords returns the records of domain matching the filter
+// flags.  The regular expressions are applied to the records returned
+// by the API.  Only filter flags given on the command line with a value
+// apply, and filtered reports whether any did.
+func filterRecords(cmd *Command, domain string) (records []dnsme.Record, filtered bool, err error) {
+
+	given := givenFlags(cmd)
+
+	values := url.Values{}
+	for _, param := range filterParams {
+		if v := cmd.Flag.Lookup(param).Value.String(); given(param) && v != "" {
+			values.Set(param, v)
+		}
+	}
+
+	nameRe, err := regexpFlag(cmd, given, "nameRegexp")
+	if err != nil {
+		return
+	}
+	valueRe, err := regexpFlag(cmd, given, "valueRegexp")
+	if err != nil {
+		return
+	}
+	filtered = len(values) > 0 || nameRe != nil || valueRe != nil
+
+	all, err := client.Records(domain, values)
+	if err != nil {
+		return
+	}
+	for _, r := range all {
+		if nameRe != nil && !nameRe.MatchString(r.Name) || valueRe != nil && !valueRe.MatchString(r.Data) {
+			continue
+		}
+		records = append(records, r)
+	}
+	return
+}
+
+// regexpFlag compiles the regular expression given by a flag, if any.
+func regexpFlag(cmd *Command, given func(name string) bool, name string) (re *regexp.Regexp, err error) {
+	expr := cmd.Flag.Lookup(name).Value.String()
+	if !given(name) || expr == "" {
+		return
+	}
+	re, err = regexp.Compile(expr)
+	if err != nil {
+		err = fmt.Errorf("invalid -%s: %s", name, err)
+	}
+	return
 }
 
 func runRecords(cmd *Command, args []string) (err error) {
@@ -54,14 +127,7 @@ func runRecords(cmd *Command, args []string) (err error) {
 
 	domain := args[0]
 
-	values := &url.Values{}
-	for _, param := range []string{"gtdLocation", "type", "name", "nameContains", "value", "valueContains"} {
-		if cmd.Flag.Lookup(param).Value.String() != "" {
-			values.Set(param, cmd.Flag.Lookup(param).Value.String())
-		}
-	}
-
-	records, err := getDomainRecords(domain, values)
+	records, _, err := filterRecords(cmd, domain)
 	if err != nil {
 		return
 	}
@@ -73,11 +139,191 @@ func runRecords(cmd *Command, args []string) (err error) {
 		}
 	*/
 
+	outputRecords(cmd, records)
+	return
+
+}
+
+// recordID returns the value of the -id flag.
+func recordID(cmd *Command) (id int, err error) {
+
+	s := cmd.Flag.Lookup("id").Value.String()
+	if s == "" {
+		err = errors.New("record id not specified")
+		return
+	}
+
+	id, err = strconv.Atoi(s)
+	if err != nil {
+		err = fmt.Errorf("invalid record id %q", s)
+		return
+	}
+
+	return
+}
+
+// recordTTL returns the TTL given by -ttl.
+func recordTTL(cmd *Command) (ttl int, err error) {
+
+	s := cmd.Flag.Lookup("ttl").Value.String()
+	ttl, err = strconv.Atoi(s)
+	if err != nil {
+		err = fmt.Errorf("invalid -ttl %q", s)
+	}
+	return
+}
+
+// A recordSelector chooses records by their fields, as an alternative
+// to -id.  Fields which are not set match any record.
+type recordSelector struct {
+	Name        *string
+	Type        string
+	Data        string
+	GtdLocation string
+}
+
+// flagsSelect adds the -id and selector flags to a command.
+func flagsSelect(f *flag.FlagSet) {
+	f.String("id", "", "")
+	f.String("name", "", "")
+	f.String("type", "", "")
+	f.String("data", "", "")
+	f.String("gtdLocation", "", "")
+	f.Bool("all", false, "")
+}
+
+// selector returns the selector given by the -name, -type, -data and
+// -gtdLocation flags.  Only flags given on the command line select
+// records, not defaults.
+func selector(cmd *Command) (sel recordSelector) {
+	given := givenFlags(cmd)
+	value := func(name string) string { return cmd.Flag.Lookup(name).Value.String() }
+
+	if given("name") {
+		name := value("name")
+		sel.Name = &name
+	}
+	if given("type") {
+		sel.Type = value("type")
+	}
+	if given("data") {
+		sel.Data = value("data")
+	}
+	if given("gtdLocation") {
+		sel.GtdLocation = value("gtdLocation")
+	}
+	return
+}
+
+func (s recordSelector) empty() bool {
+	return s.Name == nil && s.Type == "" && s.Data == "" && s.GtdLocation == ""
+}
+
+func (s recordSelector) match(r dnsme.Record) bool {
+	gtd := r.GtdLocation
+	if gtd == "" {
+		gtd = "DEFAULT"
+	}
+	return (s.Name == nil || strings.EqualFold(*s.Name, r.Name)) &&
+		(s.Type == "" || s.Type == r.Type) &&
+		(s.Data == "" || s.Data == r.Data) &&
+		(s.GtdLocation == "" || s.GtdLocation == gtd)
+}
+
+func (s recordSelector) String() string {
+	var f []string
+	if s.Name != nil {
+		f = append(f, fmt.Sprintf("name %q", *s.Name))
+	}
+	if s.Type != "" {
+		f = append(f, "type "+s.Type)
+	}
+	if s.Data != "" {
+		f = append(f, fmt.Sprintf("data %q", s.Data))
+	}
+	if s.GtdLocation != "" {
+		f = append(f, "gtdLocation "+s.GtdLocation)
+	}
+	return strings.Join(f, ", ")
+}
+
+// selectRecords returns the records of domain chosen by -id, or else by
+// sel.  Unless -all is given, sel must match exactly one record.  With
+// -id, the record is only fetched if fetch is set; otherwise just its
+// ID is returned.
+func selectRecords(cmd *Command, domain string, sel recordSelector, fetch bool) (selected []dnsme.Record, err error) {
+
+	if cmd.Flag.Lookup("id").Value.String() != "" {
+		if !sel.empty() {
+			err = errors.New("-id cannot be combined with record selectors")
+			return
+		}
+		var r dnsme.Record
+		r.ID, err = recordID(cmd)
+		if err != nil {
+			return
+		}
+		if fetch {
+			r, err = client.Record(domain, r.ID)
+			if err != nil {
+				return
+			}
+		}
+		selected = append(selected, r)
+		return
+	}
+
+	if sel.empty() {
+		err = errors.New("record id or selector (-name, -type, -data, -gtdLocation) not specified")
+		return
+	}
+
+	selected, err = matchRecords(domain, sel)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case len(selected) == 0:
+		err = fmt.Errorf("no records in %s match %s", domain, sel)
+	case len(selected) > 1 && cmd.Flag.Lookup("all").Value.String() != "true":
+		var ids []string
+		for _, r := range selected {
+			ids = append(ids, strconv.Itoa(r.ID))
+		}
+		err = fmt.Errorf("%d records in %s match %s (ids %s); use -all to select them all",
+			len(selected), domain, sel, strings.Join(ids, ", "))
+		selected = nil
+	}
+	return
+}
+
+// matchRecords returns the records of domain matched by sel.
+func matchRecords(domain string, sel recordSelector) (matched []dnsme.Record, err error) {
+
+	var filter url.Values
+	if sel.Type != "" {
+		filter = url.Values{"type": {sel.Type}}
+	}
+	records, err := client.Records(domain, filter)
+	if err != nil {
+		return
+	}
+	for _, r := range records {
+		if sel.match(r) {
+			matched = append(matched, r)
+		}
+	}
+	return
+}
+
+// outputRecords writes records in the selected output type.
+func outputRecords(cmd *Command, records []dnsme.Record) {
 	switch outputType {
 	default:
 		{
 			for _, record := range records {
-				tmpl(os.Stdout, recordTemplate, record)
+				printRecord(cmd, os.Stdout, record)
 			}
 		}
 	case "json":
@@ -89,27 +335,49 @@ func runRecords(cmd *Command, args []string) (err error) {
 		{
 			var rs [][]string
 			for _, record := range records {
-				r := []string{record.Name, strconv.Itoa(record.TTL), record.Type, record.Data, strconv.Itoa(record.ID), record.GtdLocation}
+				r := recordColumns(cmd, record)
 				rs = append(rs, r)
 			}
 			w := csv.NewWriter(os.Stdout)
 			w.WriteAll(rs)
 		}
 	}
-	return
-
 }
 
 var record = &Command{
 	Run:         runRecord,
 	CustomFlags: flagsRecord,
-	UsageLine:   "record -id <record id> <domain>",
-	Short:       "returns a specific record id from a domain",
-	Long:        "'record' returns a domain record.",
+	UsageLine: `record (-id <record id> | <selector flags> [-all]) [-split]
+    <domain>`,
+	Short: "returns a specific record id from a domain",
+	Long: `
+'record' returns a domain record.
+
+The record is given either by -id, its unique record identifier, or by
+one or more selector flags:
+
+-name <record name> is the record name.  An empty value indicates the
+base domain.
+
+-type is the record type.
+
+-data is the record data.
+
+-gtdLocation is the Global Traffic Director location.
+
+It is an error if the selector flags match no records, or more than one
+record unless -all is given, in which case all matching records are
+returned.
+
+-split shows the parts of the data of MX, SRV and TXT records
+separately; see 'dnsme help records'.
+
+`,
 }
 
 func flagsRecord(f *flag.FlagSet) {
-	f.String("id", "", "")
+	flagsSelect(f)
+	flagSplit(f)
 }
 
 func runRecord(cmd *Command, args []string) (err error) {
@@ -121,20 +389,20 @@ func runRecord(cmd *Command, args []string) (err error) {
 
 	domain := args[0]
 
-	id := cmd.Flag.Lookup("id").Value.String()
-	if id == "" {
-		err = errors.New("record id not specified")
+	selected, err := selectRecords(cmd, domain, selector(cmd), true)
+	if err != nil {
 		return
 	}
 
-	record, err := getDomainRecord(id, domain)
-	if err != nil {
+	if cmd.Flag.Lookup("all").Value.String() == "true" {
+		outputRecords(cmd, selected)
 		return
 	}
+	record := selected[0]
 
 	switch outputType {
 	default:
-		tmpl(os.Stdout, recordTemplate, record)
+		printRecord(cmd, os.Stdout, record)
 	case "json":
 		{
 			b, _ := json.Marshal(record)
@@ -142,7 +410,7 @@ func runRecord(cmd *Command, args []string) (err error) {
 		}
 	case "csv":
 		{
-			r := []string{record.Name, strconv.Itoa(record.TTL), record.Type, record.Data, strconv.Itoa(record.ID), record.GtdLocation}
+			r := recordColumns(cmd, record)
 			w := csv.NewWriter(os.Stdout)
 			w.Write(r)
 			w.Flush()
@@ -156,13 +424,30 @@ func runRecord(cmd *Command, args []string) (err error) {
 var deleteRecord = &Command{
 	Run:         runDeleteRecord,
 	CustomFlags: flagsDeleteRecord,
-	UsageLine:   "delete-record -id <record id> <domain>",
-	Short:       "delete a record from the domain",
-	Long:        "'delete-record' deleted a record from the domain.",
+	UsageLine: `delete-record [-dry-run] (-id <record id> | <selector flags> [-all])
+    [-wait <duration>] <domain>`,
+	Short: "delete a record from the domain",
+	Long: `
+'delete-record' deleted a record from the domain.
+
+The record is given either by -id or by selector flags, as for 'dnsme
+record'.  If the selector flags match more than one record, nothing is
+deleted unless -all is given, in which case all matching records are
+deleted.
+
+-dry-run shows the change that would be made, without making it.
+
+-wait waits, up to the given time, e.g. "2m", until the change is served
+by the nameservers of the domain, or those given by -nameserver; see
+'dnsme help wait'.
+
+`,
 }
 
 func flagsDeleteRecord(f *flag.FlagSet) {
-	f.String("id", "", "record id")
+	flagsSelect(f)
+	flagDryRun(f)
+	flagsWait(f)
 }
 
 func runDeleteRecord(cmd *Command, args []string) (err error) {
@@ -173,14 +458,33 @@ func runDeleteRecord(cmd *Command, args []string) (err error) {
 	}
 
 	domain := args[0]
-	id := cmd.Flag.Lookup("id").Value.String()
-	if id == "" {
-		err = errors.New("record id not specified")
+	dry := dryRun(cmd)
+	wait := givenFlags(cmd)("wait")
+
+	// the records are only fetched if they are shown or waited for
+	selected, err := selectRecords(cmd, domain, selector(cmd), dry || wait)
+	if err != nil {
+		return
+	}
+
+	var changes []recordChange
+	for _, r := range selected {
+		changes = append(changes, recordChange{Op: opDelete, Domain: domain, Record: r})
+	}
+
+	if dry {
+		outputChanges(os.Stdout, changes)
 		return
 	}
 
-	err = deleteDomainRecord(id, domain)
+	for _, r := range selected {
+		err = removeRecord(domain, r)
+		if err != nil {
+			return
+		}
+	}
 
+	err = waitForChanges(cmd, changes)
 	return
 }
 
@@ -189,13 +493,24 @@ var updateRecord = &Command{
 	CustomFlags: flagsUpdateRecord,
 	UsageLine: `update-record -id <record id> -name <name> -data <record data>
     [-ttl <ttl>] [-type <record type>] [-gtdLocation <gtdLocation>] 
-    [-password <password>] <domain>`,
+    [-password <password>] [MX, SRV, TXT or HTTPRED flags] [-dry-run]
+    [-wait <duration>] <domain>
+       dnsme update-record -name <name> -type <record type>
+    [-match-data <data>] [-match-gtdLocation <gtdLocation>] [-all]
+    [flags to change] [-dry-run] [-wait <duration>] <domain>`,
 	Short: "update an existing record",
 	Long: `
 'update-record' updates an existing record object in the specified
 domain.
  
--id is the unique record identifier.
+-id is the unique record identifier.  The record is replaced by the
+record described by the flags.
+
+Without -id, the record is selected by -name and -type, and optionally
+-match-data and -match-gtdLocation, its current data and location.  Only
+the fields given by flags are changed: the others keep their current
+values.  It is an error if no records match, or more than one unless
+-all is given, in which case all matching records are updated.
 
 -name <record name> is the record name. An empty value indicates that
 the base domain is used.
@@ -209,29 +524,83 @@ the base domain is used.
     PTR: <target name>
     SRV: <priority> <weight> <port> <target name>
     TXT: <text value>
+    HTTPRED: <destination URL>
 
 -ttl is the amount of time in seconds a record will be cached before
 being refreshed.  Default value is "3600" (one hour).
 
 -type (optional) is the record type. Values: A, AAAA, CNAME, MX, NS,
-PTR, SRV, TXT
+PTR, SRV, TXT, HTTPRED
 
 -gtdLocation (optional) is the Global Traffic Director location. Values:
 DEFAULT, US_EAST, US_WEST, EUROPE
 
 -password is the password required for dynamic DNS updates
 
+Rather than -data, MX and SRV records may be given as:
+
+-priority, -weight (SRV only), -port (SRV only) and -target, which are
+combined into the data, e.g. "-priority 10 -weight 0 -port 5060 -target
+sip.example.com." for "10 0 5060 sip.example.com.".
+
+TXT records may be given as:
+
+-txt <text>, which may be repeated for several strings.  Text longer
+than 255 bytes is split into several strings automatically.
+
+HTTPRED records take the following flags; the destination URL must be
+an absolute http or https URL:
+
+-redirectType is "301" (the default), "302" or "hidden", for a
+redirect hidden in a frame.
+
+-title, -keywords and -description set the page title and meta tags of
+the frame of a hidden redirect.
+
+-hardLink redirects to the destination URL exactly, rather than
+appending the path of the request to it.
+
+The record is checked for a valid name, TTL and data for its type
+before it is sent.  The data of types such as CAA cannot be checked, and
+is sent with a warning.
+
+-dry-run shows the change that would be made, without making it.
+
+-wait waits, up to the given time, e.g. "2m", until the change is served
+by the nameservers of the domain, or those given by -nameserver; see
+'dnsme help wait'.
+
 `,
 }
 
 func flagsUpdateRecord(f *flag.FlagSet) {
 	f.String("id", "", "")
+	f.String("match-data", "", "")
+	f.String("match-gtdLocation", "", "")
+	f.Bool("all", false, "")
+	flagsAddRecord(f)
+}
+
+func flagsAddRecord(f *flag.FlagSet) {
 	f.String("name", "", "")
 	f.String("type", "", "")
 	f.String("data", "", "")
 	f.String("ttl", "3600", "")
 	f.String("gtdLocation", "DEFAULT", "")
 	f.String("password", "", "")
+	flagsRedirect(f)
+	flagsRecordData(f)
+	flagDryRun(f)
+	flagsWait(f)
+}
+
+// flagsRedirect adds the flags setRedirect reads.
+func flagsRedirect(f *flag.FlagSet) {
+	f.String("redirectType", "", "")
+	f.String("title", "", "")
+	f.String("keywords", "", "")
+	f.String("description", "", "")
+	f.Bool("hardLink", false, "")
 }
 
 func runUpdateRecord(cmd *Command, args []string) (err error) {
@@ -242,31 +611,156 @@ func runUpdateRecord(cmd *Command, args []string) (err error) {
 	}
 
 	domain := args[0]
+	dry := dryRun(cmd)
+
+	var changes []recordChange
+	if cmd.Flag.Lookup("id").Value.String() != "" {
+		var c recordChange
+		c, err = updateByID(cmd, domain)
+		changes = append(changes, c)
+	} else {
+		changes, err = updateBySelector(cmd, domain)
+	}
+	if err != nil {
+		return
+	}
 
-	rec := &apiRecord{}
-	rec.ID, _ = strconv.Atoi(cmd.Flag.Lookup("id").Value.String())
+	if dry {
+		outputChanges(os.Stdout, changes)
+		return
+	}
+
+	for _, c := range changes {
+		err = replaceRecord(c)
+		if err != nil {
+			return
+		}
+	}
+
+	err = waitForChanges(cmd, changes)
+	return
+
+}
+
+// updateByID returns the update of the record given by -id, which is
+// replaced by the record described by the flags.  The existing record
+// is fetched, both for its type, if -type is not given, and to be shown
+// by -dry-run and logged as it was before the change.
+func updateByID(cmd *Command, domain string) (c recordChange, err error) {
+
+	rec := &dnsme.Record{}
+	rec.ID, err = recordID(cmd)
+	if err != nil {
+		return
+	}
+	rec.TTL, err = recordTTL(cmd)
+	if err != nil {
+		return
+	}
 	rec.Name = cmd.Flag.Lookup("name").Value.String()
 	rec.Type = cmd.Flag.Lookup("type").Value.String()
 	rec.Data = cmd.Flag.Lookup("data").Value.String()
-	rec.TTL, _ = strconv.Atoi(cmd.Flag.Lookup("ttl").Value.String())
 	rec.GtdLocation = cmd.Flag.Lookup("gtdLocation").Value.String()
 	rec.Password = cmd.Flag.Lookup("password").Value.String()
 
-	_, err = addDomainRecord(domain, *rec)
+	old, err := client.Record(domain, rec.ID)
 	if err != nil {
 		return
 	}
+	old.Error = nil
+	// the type cannot be changed, so is optional
+	if rec.Type == "" {
+		rec.Type = old.Type
+	}
+	setRedirect(cmd, rec, allFlags)
 
+	err = composeData(cmd, rec)
+	if err != nil {
+		return
+	}
+
+	err = checkRecord(os.Stderr, domain, *rec)
+	if err != nil {
+		return
+	}
+
+	c = recordChange{Op: opUpdate, Domain: domain, Record: *rec, Old: &old}
 	return
+}
+
+// updateBySelector returns the updates of the records selected by -name
+// and -type, and optionally -match-data and -match-gtdLocation.  Only
+// the fields given by flags are changed.
+func updateBySelector(cmd *Command, domain string) (changes []recordChange, err error) {
+
+	given := givenFlags(cmd)
+	value := func(name string) string { return cmd.Flag.Lookup(name).Value.String() }
 
+	if !given("name") || !given("type") {
+		err = errors.New("either -id, or -name and -type, must be given")
+		return
+	}
+
+	name := value("name")
+	sel := recordSelector{
+		Name:        &name,
+		Type:        value("type"),
+		Data:        value("match-data"),
+		GtdLocation: value("match-gtdLocation"),
+	}
+
+	selected, err := selectRecords(cmd, domain, sel, true)
+	if err != nil {
+		return
+	}
+
+	composed := false
+	for _, f := range []string{"priority", "weight", "port", "target", "txt"} {
+		composed = composed || given(f)
+	}
+
+	for _, old := range selected {
+		old.Error = nil
+		rec := old
+		if given("data") || composed {
+			rec.Data = value("data")
+		}
+		if given("ttl") {
+			rec.TTL, err = recordTTL(cmd)
+			if err != nil {
+				return
+			}
+		}
+		if given("gtdLocation") {
+			rec.GtdLocation = value("gtdLocation")
+		}
+		if given("password") {
+			rec.Password = value("password")
+		}
+		setRedirect(cmd, &rec, given)
+
+		err = composeData(cmd, &rec)
+		if err != nil {
+			return
+		}
+
+		err = checkRecord(os.Stderr, domain, rec)
+		if err != nil {
+			return
+		}
+
+		o := old
+		changes = append(changes, recordChange{Op: opUpdate, Domain: domain, Record: rec, Old: &o})
+	}
+	return
 }
 
 var addRecord = &Command{
 	Run:         runAddRecord,
-	CustomFlags: flagsUpdateRecord,
+	CustomFlags: flagsAddRecord,
 	UsageLine: `add-record -name <name> -type <record type> [-ttl <ttl>]
     -data <record data> [-gtdLocation <gtdLocation>] [-password <password>]
-    <domain>`,
+    [MX, SRV, TXT or HTTPRED flags] [-dry-run] [-wait <duration>] <domain>`,
 	Short: "add a new record",
 	Long: `
 'add-record' adds a record object to the specified domain.
@@ -283,18 +777,52 @@ the base domain is used.
     PTR: <target name>
     SRV: <priority> <weight> <port> <target name>
     TXT: <text value>
+    HTTPRED: <destination URL>
 
 -ttl is the amount of time in seconds a record will be cached before
 being refreshed.  Default value is 3600 (one hour).
 
 -type (optional) is the record type. Values: A, AAAA, CNAME, MX, NS,
-PTR, SRV, TXT
+PTR, SRV, TXT, HTTPRED
 
 -gtdLocation is the Global Traffic Director location. Values:
 DEFAULT, US_EAST, US_WEST, EUROPE
 
 -password is the password required for dynamic DNS updates
 
+Rather than -data, MX and SRV records may be given as:
+
+-priority, -weight (SRV only), -port (SRV only) and -target, which are
+combined into the data, e.g. "-priority 10 -weight 0 -port 5060 -target
+sip.example.com." for "10 0 5060 sip.example.com.".
+
+TXT records may be given as:
+
+-txt <text>, which may be repeated for several strings.  Text longer
+than 255 bytes is split into several strings automatically.
+
+HTTPRED records take the following flags; the destination URL must be
+an absolute http or https URL:
+
+-redirectType is "301" (the default), "302" or "hidden", for a
+redirect hidden in a frame.
+
+-title, -keywords and -description set the page title and meta tags of
+the frame of a hidden redirect.
+
+-hardLink redirects to the destination URL exactly, rather than
+appending the path of the request to it.
+
+The record is checked for a valid name, TTL and data for its type
+before it is sent.  The data of types such as CAA cannot be checked, and
+is sent with a warning.
+
+-dry-run shows the change that would be made, without making it.
+
+-wait waits, up to the given time, e.g. "2m", until the change is served
+by the nameservers of the domain, or those given by -nameserver; see
+'dnsme help wait'.
+
 `,
 }
 
@@ -307,30 +835,42 @@ func runAddRecord(cmd *Command, args []string) (err error) {
 
 	domain := args[0]
 
-	rec := &apiRecord{}
+	rec := &dnsme.Record{}
 	rec.Name = cmd.Flag.Lookup("name").Value.String()
 	rec.Type = cmd.Flag.Lookup("type").Value.String()
 	rec.Data = cmd.Flag.Lookup("data").Value.String()
 	rec.TTL, _ = strconv.Atoi(cmd.Flag.Lookup("ttl").Value.String())
 	rec.GtdLocation = cmd.Flag.Lookup("gtdLocation").Value.String()
+	setRedirect(cmd, rec, allFlags)
+
+	err = composeData(cmd, rec)
+	if err != nil {
+		return
+	}
 
 	if rec.Type == "" || rec.Data == "" || rec.TTL == 0 {
 		err = errors.New("missing required parameters")
 		return
 	}
 
-	record, err := addDomainRecord(domain, *rec)
+	err = checkRecord(os.Stderr, domain, *rec)
 	if err != nil {
 		return
 	}
 
-	if record.Data == "" {
-		record.Data = domain + "."
+	if dryRun(cmd) {
+		outputChanges(os.Stdout, []recordChange{{Op: opCreate, Domain: domain, Record: *rec}})
+		return
+	}
+
+	record, err := client.AddRecord(domain, *rec)
+	if err != nil {
+		return
 	}
 
 	switch outputType {
 	default:
-		tmpl(os.Stdout, recordTemplate, record)
+		printRecord(cmd, os.Stdout, record)
 	case "json":
 		{
 			b, _ := json.Marshal(record)
@@ -338,13 +878,78 @@ func runAddRecord(cmd *Command, args []string) (err error) {
 		}
 	case "csv":
 		{
-			r := []string{record.Name, strconv.Itoa(record.TTL), record.Type, record.Data, strconv.Itoa(record.ID), record.GtdLocation}
+			r := recordColumns(cmd, record)
 			w := csv.NewWriter(os.Stdout)
 			w.Write(r)
 			w.Flush()
 		}
 	}
 
+	err = waitForChanges(cmd, []recordChange{{Op: opCreate, Domain: domain, Record: record}})
 	return
 
 }
+
+// redirectTypes maps the short forms accepted by -redirectType to the
+// redirect types of the API.
+var redirectTypes = map[string]string{
+	"301":    dnsme.Redirect301,
+	"302":    dnsme.Redirect302,
+	"hidden": dnsme.RedirectHidden,
+}
+
+// setRedirect sets the HTTPRED fields of rec from the flags for which
+// given reports true.  The redirect type defaults to a permanent (301)
+// redirect.
+func setRedirect(cmd *Command, rec *dnsme.Record, given func(name string) bool) {
+
+	if rec.Type != "HTTPRED" {
+		return
+	}
+
+	value := func(name string) string { return cmd.Flag.Lookup(name).Value.String() }
+
+	if given("redirectType") {
+		rec.RedirectType = value("redirectType")
+		if t, ok := redirectTypes[strings.ToLower(rec.RedirectType)]; ok {
+			rec.RedirectType = t
+		}
+	}
+	if rec.RedirectType == "" {
+		rec.RedirectType = dnsme.Redirect301
+	}
+	if given("title") {
+		rec.Title = value("title")
+	}
+	if given("keywords") {
+		rec.Keywords = value("keywords")
+	}
+	if given("description") {
+		rec.Description = value("description")
+	}
+	if given("hardLink") {
+		rec.HardLink = value("hardLink") == "true"
+	}
+}
+
+// allFlags is used with setRedirect to set every field from the flags.
+func allFlags(name string) bool { return true }
+
+// givenFlags returns a function reporting whether a flag was given on
+// the command line.
+func givenFlags(cmd *Command) func(name string) bool {
+	set := make(map[string]bool)
+	cmd.Flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return func(name string) bool { return set[name] }
+}
+
+// recordCSV returns the fields of a record for CSV output.  The HTTPRED
+// fields are empty for other types of record.
+func recordCSV(r dnsme.Record) []string {
+	hardLink := ""
+	if r.Type == "HTTPRED" {
+		hardLink = strconv.FormatBool(r.HardLink)
+	}
+	return []string{r.Name, strconv.Itoa(r.TTL), r.Type, r.Data, strconv.Itoa(r.ID), r.GtdLocation,
+		r.RedirectType, r.Title, r.Keywords, r.Description, hardLink}
+}
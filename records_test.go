@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+func TestRecordTemplate(t *testing.T) {
+	for _, tt := range []struct {
+		r    dnsme.Record
+		want string
+	}{
+		{dnsme.Record{ID: 1, Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"},
+			"www 300 A 192.0.2.1 ; id=1 , gtd=DEFAULT"},
+		{dnsme.Record{ID: 2, Type: "CNAME", TTL: 300, GtdLocation: "DEFAULT"},
+			"@ 300 CNAME @ ; id=2 , gtd=DEFAULT"},
+		{dnsme.Record{ID: 3, Name: "go", Type: "HTTPRED", Data: "https://example.org/", TTL: 300, GtdLocation: "DEFAULT", RedirectType: "301"},
+			`go 300 HTTPRED https://example.org/ ; id=3 , gtd=DEFAULT, redirect="301"`},
+		{dnsme.Record{ID: 4, Name: "go", Type: "HTTPRED", Data: "https://example.org/", TTL: 300, GtdLocation: "DEFAULT",
+			RedirectType: "Hidden Frame Masked", HardLink: true, Title: "Example", Keywords: "a, b", Description: "An example"},
+			`go 300 HTTPRED https://example.org/ ; id=4 , gtd=DEFAULT, redirect="Hidden Frame Masked", hardLink, title="Example", keywords="a, b", description="An example"`},
+	} {
+		var b strings.Builder
+		tmpl(&b, recordTemplate, tt.r)
+		if got := strings.Join(strings.Fields(b.String()), " "); got != tt.want {
+			t.Errorf("record %d = %q, want %q", tt.r.ID, got, tt.want)
+		}
+	}
+}
+
+func TestRecordHelp(t *testing.T) {
+	for _, cmd := range []*Command{addRecord, updateRecord} {
+		i := strings.Index(cmd.Long, "Values: ")
+		if i < 0 {
+			t.Errorf("%s help does not list the record types", cmd.Name())
+			continue
+		}
+		types := strings.Fields(strings.NewReplacer(",", " ").Replace(cmd.Long[i+len("Values: ") : i+strings.Index(cmd.Long[i:], "\n\n")]))
+		seen := make(map[string]bool)
+		for _, typ := range types {
+			if seen[typ] {
+				t.Errorf("%s help lists %s twice", cmd.Name(), typ)
+			}
+			seen[typ] = true
+		}
+		if !seen["HTTPRED"] {
+			t.Errorf("%s help does not list HTTPRED: %v", cmd.Name(), types)
+		}
+	}
+}
+
+func TestRedirectRecords(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+		mustRun(t, "add-record", "-name", "go", "-type", "HTTPRED", "-data", "https://example.org/", "example.com")
+		mustRun(t, "add-record", "-name", "frame", "-type", "HTTPRED", "-data", "https://example.org/",
+			"-redirectType", "hidden", "-title", "Example", "-hardLink", "example.com")
+
+		records := s.Records("example.com")
+		if len(records) != 2 || records[0].RedirectType != dnsme.Redirect301 ||
+			records[1].RedirectType != dnsme.RedirectHidden || records[1].Title != "Example" || !records[1].HardLink {
+			t.Fatalf("records after add-record = %+v", records)
+		}
+
+		out := mustRun(t, "records", "example.com")
+		if !strings.Contains(out, `redirect="Hidden Frame Masked", hardLink, title="Example"`) {
+			t.Errorf("records output lacks the redirect settings:\n%s", out)
+		}
+
+		// fields not given keep their values
+		mustRun(t, "update-record", "-name", "frame", "-type", "HTTPRED", "-title", "Other", "example.com")
+		if r := s.Records("example.com")[1]; r.Title != "Other" || r.RedirectType != dnsme.RedirectHidden || !r.HardLink {
+			t.Errorf("record after update-record = %+v", r)
+		}
+
+		if _, _, err := run(t, "add-record", "-name", "bad", "-type", "HTTPRED", "-data", "example.org", "example.com"); err == nil {
+			t.Error("add-record of a redirect to a relative URL succeeded")
+		}
+	})
+}
+
+func TestSelector(t *testing.T) {
+	cmd := &Command{UsageLine: "record"}
+	flagsSelect(&cmd.Flag)
+	if err := cmd.Flag.Parse([]string{"-name", "", "-type", "A"}); err != nil {
+		t.Fatal(err)
+	}
+	// a default which was not given does not select records
+	cmd.Flag.Lookup("gtdLocation").Value.Set("DEFAULT")
+	cmd.Flag.Lookup("data").Value.Set("192.0.2.1")
+
+	sel := selector(cmd)
+	if sel.Name == nil || *sel.Name != "" || sel.Type != "A" || sel.Data != "" || sel.GtdLocation != "" {
+		t.Errorf("selector = %s", sel)
+	}
+	if !sel.match(dnsme.Record{Name: "", Type: "A", Data: "192.0.2.2", GtdLocation: "EUROPE"}) {
+		t.Errorf("selector %s does not match an apex A record", sel)
+	}
+	if sel.match(dnsme.Record{Name: "www", Type: "A"}) {
+		t.Errorf("selector %s matches www", sel)
+	}
+}
+
+func TestSelectRecords(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.2", TTL: 300, GtdLocation: "EUROPE"})
+		s.AddRecord("example.com", dnsme.Record{Name: "ftp", Type: "A", Data: "192.0.2.3", TTL: 300, GtdLocation: "DEFAULT"})
+
+		if out := mustRun(t, "record", "-name", "WWW", "-gtdLocation", "EUROPE", "example.com"); !strings.Contains(out, "192.0.2.2") {
+			t.Errorf("record -name WWW -gtdLocation EUROPE = %q", out)
+		}
+
+		_, _, err := run(t, "record", "-name", "www", "-type", "A", "example.com")
+		if err == nil || !strings.Contains(err.Error(), "2 records in example.com match name \"www\", type A") || !strings.Contains(err.Error(), "-all") {
+			t.Errorf("record matching two records: err = %v", err)
+		}
+		if out := mustRun(t, "record", "-name", "www", "-all", "example.com"); strings.Count(out, "www") != 2 {
+			t.Errorf("record -all = %q", out)
+		}
+		if _, _, err := run(t, "record", "-name", "mail", "example.com"); err == nil || !strings.Contains(err.Error(), "no records in example.com match") {
+			t.Errorf("record matching no records: err = %v", err)
+		}
+		if _, _, err := run(t, "record", "example.com"); err == nil || !strings.Contains(err.Error(), "not specified") {
+			t.Errorf("record without -id or selector: err = %v", err)
+		}
+		if _, _, err := run(t, "record", "-id", "1", "-name", "www", "example.com"); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+			t.Errorf("record with -id and -name: err = %v", err)
+		}
+
+		mustRun(t, "update-record", "-name", "www", "-type", "A", "-match-gtdLocation", "EUROPE", "-ttl", "60", "example.com")
+		if r := s.Records("example.com"); r[0].TTL != 300 || r[1].TTL != 60 || r[1].Data != "192.0.2.2" {
+			t.Errorf("records after update-record -match-gtdLocation = %+v", r)
+		}
+		if _, _, err := run(t, "update-record", "-name", "www", "-ttl", "60", "example.com"); err == nil {
+			t.Error("update-record with -name but no -type succeeded")
+		}
+
+		mustRun(t, "delete-record", "-name", "www", "-all", "example.com")
+		if got := recordsOf(s, "example.com"); got != "ftp A 192.0.2.3" {
+			t.Errorf("records after delete-record -all:\n%s", got)
+		}
+	})
+}
@@ -6,6 +6,8 @@ import (
 	"flag"
 	"os"
 	"strings"
+
+	"github.com/jswank/dnsme/dnsme"
 )
 
 var listSecondaries = &Command{
@@ -17,7 +19,7 @@ var listSecondaries = &Command{
 
 func runListSecondaries(cmd *Command, args []string) (err error) {
 
-	domains, err := getSecondaryList()
+	domains, err := client.Secondaries()
 	if err != nil {
 		return
 	}
@@ -29,7 +31,7 @@ func runListSecondaries(cmd *Command, args []string) (err error) {
 		}
 	case "json":
 		{
-			b, _ := json.Marshal(domains.List)
+			b, _ := json.Marshal(domains)
 			os.Stdout.Write(b)
 		}
 	}
@@ -55,7 +57,7 @@ func runInfoSecondary(cmd *Command, args []string) (err error) {
 
 	domain := args[0]
 
-	info, err := getSecondary(domain)
+	info, err := client.Secondary(domain)
 	if err != nil {
 		return
 	}
@@ -96,7 +98,7 @@ func runDeleteSecondary(cmd *Command, args []string) (err error) {
 
 	domain := args[0]
 
-	err = deleteSecondary(domain)
+	err = client.DeleteSecondary(domain)
 	if err != nil {
 		return
 	}
@@ -134,9 +136,10 @@ func runAddSecondary(cmd *Command, args []string) (err error) {
 
 	if len(args) == 0 {
 		err = errors.New("domain not specified")
+		return
 	}
 
-	secondary := &apiSecondary{}
+	secondary := &dnsme.Secondary{}
 	secondary.Name = args[0]
 	if cmd.Flag.Lookup("ip").Value.String() != "" {
 		for _, ns := range strings.Split(cmd.Flag.Lookup("ip").Value.String(), ",") {
@@ -144,7 +147,7 @@ func runAddSecondary(cmd *Command, args []string) (err error) {
 		}
 	}
 
-	info, err := addSecondary(*secondary)
+	info, err := client.AddSecondary(*secondary)
 	if err != nil {
 		return
 	}
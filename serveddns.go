@@ -0,0 +1,407 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// maxDDNSHosts is the most hostnames accepted in one update request.
+const maxDDNSHosts = 20
+
+// ddnsRecheck is how long the address last set for a hostname is
+// trusted before the record is checked again through the API, in case
+// it was changed by other means.
+const ddnsRecheck = 10 * time.Minute
+
+var serveDDNS = &Command{
+	Run:         runServeDDNS,
+	CustomFlags: flagsServeDDNS,
+	UsageLine: `serve-ddns [-listen <address>] [-hosts <file>]
+    [-tls-cert <file> -tls-key <file>]`,
+	Short: "serve DynDNS2 updates for routers and other clients",
+	Long: `
+'serve-ddns' runs an HTTP server speaking the DynDNS2 update protocol
+used by routers, NAS boxes and other dynamic DNS clients:
+
+    GET /nic/update?hostname=<fqdn>[,<fqdn>...]&myip=<address>
+
+Clients authenticate with HTTP basic authentication, with the username
+and password of one of the hosts served, before any hostname is looked
+at.  Each hostname is mapped to an A or AAAA record, which is created
+or updated to point at myip, or at the address of the client if myip is
+not given.  IPv4 addresses set A records and IPv6 addresses AAAA
+records.
+
+The response has a line for each hostname, as in DynDNS2:
+
+    good <address>    the record was updated
+    nochg <address>   the record already had the address
+    badauth           the username or password is wrong
+    nohost            the hostname is not served for this username
+    notfqdn           the hostname is not a fully qualified name
+    dnserr            the record could not be updated
+    911               the request could not be handled
+
+The hosts served are read from -hosts, by default the file ddns-hosts in
+the directory of the config file.  Like the config file it is made up of
+sections, one for each hostname:
+
+    [home.example.com]
+    username = home
+    password = secret
+    domain = example.com
+    ttl = 300
+
+domain is the domain holding the record; by default it is the longest
+of the account's domains which the hostname ends with.  The record name
+is the rest of the hostname.  ttl is the TTL of new records, 300 by
+default.  The file holds passwords, so it must not be readable by other
+users.
+
+-listen is the address to listen on, ":8245" by default.  -tls-cert and
+-tls-key serve HTTPS using the given certificate and key files.
+
+The address last set for each hostname is remembered, and answered
+with nochg without an API request; after 10 minutes, the record is
+checked again.
+
+Each update is logged to stderr.
+
+`,
+}
+
+func flagsServeDDNS(f *flag.FlagSet) {
+	f.String("listen", ":8245", "")
+	f.String("hosts", "", "")
+	f.String("tls-cert", "", "")
+	f.String("tls-key", "", "")
+}
+
+// A ddnsHost is a hostname which may be updated through serve-ddns.
+type ddnsHost struct {
+	FQDN     string
+	Domain   string
+	Name     string
+	Username string
+	Password string
+	TTL      int
+}
+
+// A ddnsServer handles DynDNS2 update requests.
+type ddnsServer struct {
+	hosts map[string]*ddnsHost
+
+	// mu serializes updates, and guards last, the address last set for
+	// each hostname and record type.
+	mu   sync.Mutex
+	last map[string]ddnsAddress
+
+	// recheck is how long an entry of last is trusted.
+	recheck time.Duration
+}
+
+// ddnsAddress is an address set for a hostname, and when.
+type ddnsAddress struct {
+	addr string
+	set  time.Time
+}
+
+func runServeDDNS(cmd *Command, args []string) (err error) {
+
+	value := func(name string) string { return cmd.Flag.Lookup(name).Value.String() }
+
+	file := expandHome(value("hosts"))
+	if file == "" {
+		file = filepath.Join(filepath.Dir(configPath()), "ddns-hosts")
+	}
+
+	hosts, err := readDDNSHosts(file)
+	if err != nil {
+		return
+	}
+
+	s := &ddnsServer{hosts: make(map[string]*ddnsHost), last: make(map[string]ddnsAddress), recheck: ddnsRecheck}
+	for _, h := range hosts {
+		s.hosts[h.FQDN] = h
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nic/update", s.update)
+
+	srv := &http.Server{
+		Addr:         value("listen"),
+		Handler:      mux,
+		ReadTimeout:  30 * time.Second,
+		WriteTimeout: 5 * time.Minute,
+	}
+
+	fmt.Fprintf(os.Stderr, "serving %d hosts on %s\n", len(hosts), srv.Addr)
+
+	cert, key := value("tls-cert"), value("tls-key")
+	switch {
+	case cert != "" && key != "":
+		err = srv.ListenAndServeTLS(expandHome(cert), expandHome(key))
+	case cert != "" || key != "":
+		err = errors.New("-tls-cert and -tls-key must be given together")
+	default:
+		err = srv.ListenAndServe()
+	}
+	return
+}
+
+// readDDNSHosts reads the hosts served by serve-ddns, finding the domain
+// of each host that does not name one.
+func readDDNSHosts(file string) (hosts []*ddnsHost, err error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	if fi, e := f.Stat(); e == nil && fi.Mode().Perm()&0077 != 0 {
+		err = fmt.Errorf("%s holds passwords and must not be accessible by other users (chmod 600 %s)", file, file)
+		return
+	}
+
+	sections, err := readSections(f, file, "host")
+	if err != nil {
+		return
+	}
+
+	var domains []string
+	for _, sec := range sections {
+		h := &ddnsHost{FQDN: canonicalHost(sec.Name), TTL: 300}
+
+		for _, k := range sec.Keys {
+			switch k.Key {
+			case "domain":
+				h.Domain = canonicalHost(k.Value)
+			case "username":
+				h.Username = k.Value
+			case "password":
+				h.Password = k.Value
+			case "ttl":
+				h.TTL, err = strconv.Atoi(k.Value)
+				if err != nil || h.TTL < 1 || h.TTL > dnsme.MaxTTL {
+					err = fmt.Errorf("%s:%d: invalid ttl %q", file, k.Lineno, k.Value)
+					return
+				}
+			default:
+				err = fmt.Errorf("%s:%d: unknown key %s", file, k.Lineno, k.Key)
+				return
+			}
+		}
+
+		if h.Username == "" || h.Password == "" {
+			err = fmt.Errorf("%s:%d: host %s needs a username and password", file, sec.Lineno, sec.Name)
+			return
+		}
+
+		if h.Domain == "" {
+			if domains == nil {
+				domains, err = client.Domains()
+				if err != nil {
+					return
+				}
+			}
+			h.Domain = zoneFor(h.FQDN, domains)
+			if h.Domain == "" {
+				err = fmt.Errorf("%s:%d: no domain in the account holds %s", file, sec.Lineno, sec.Name)
+				return
+			}
+		}
+
+		switch {
+		case h.FQDN == h.Domain:
+		case strings.HasSuffix(h.FQDN, "."+h.Domain):
+			h.Name = strings.TrimSuffix(h.FQDN, "."+h.Domain)
+		default:
+			err = fmt.Errorf("%s:%d: %s is not in the domain %s", file, sec.Lineno, sec.Name, h.Domain)
+			return
+		}
+
+		hosts = append(hosts, h)
+	}
+	return
+}
+
+// canonicalHost returns name in lower case without a trailing dot.
+func canonicalHost(name string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+}
+
+// zoneFor returns the longest of domains which fqdn is in, or "" if
+// there is none.
+func zoneFor(fqdn string, domains []string) (zone string) {
+	fqdn = canonicalHost(fqdn)
+	for _, d := range domains {
+		d = canonicalHost(d)
+		if (fqdn == d || strings.HasSuffix(fqdn, "."+d)) && len(d) > len(zone) {
+			zone = d
+		}
+	}
+	return
+}
+
+// update handles a DynDNS2 update request.
+func (s *ddnsServer) update(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if r.Method != "GET" && r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintln(w, "911")
+		return
+	}
+
+	// nothing about the hostnames is revealed to unknown clients
+	user, pass, ok := r.BasicAuth()
+	if !ok || !s.authorized(user, pass) {
+		s.badauth(w)
+		return
+	}
+
+	names := strings.Split(r.FormValue("hostname"), ",")
+	if len(names) > maxDDNSHosts {
+		fmt.Fprintln(w, "numhost")
+		return
+	}
+
+	ip := net.ParseIP(r.FormValue("myip"))
+	if ip == nil {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err == nil {
+			ip = net.ParseIP(host)
+		}
+	}
+	if ip == nil {
+		fmt.Fprintln(w, "911")
+		return
+	}
+
+	// check every hostname before updating any
+	var hosts []*ddnsHost
+	for _, name := range names {
+		name = canonicalHost(name)
+		if !strings.Contains(name, ".") {
+			fmt.Fprintln(w, "notfqdn")
+			return
+		}
+		// the hosts of other users are not distinguished from
+		// hosts which are not served
+		h := s.hosts[name]
+		if h == nil || !h.matches(user, pass) {
+			fmt.Fprintln(w, "nohost")
+			return
+		}
+		hosts = append(hosts, h)
+	}
+
+	for _, h := range hosts {
+		fmt.Fprintln(w, s.set(h, ip))
+	}
+}
+
+// authorized reports whether user and pass are the credentials of any
+// host served.  Every host is compared, so that the time taken does not
+// reveal which.
+func (s *ddnsServer) authorized(user, pass string) bool {
+	ok := false
+	for _, h := range s.hosts {
+		if h.matches(user, pass) {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// matches reports whether user and pass are the credentials of h.
+func (h *ddnsHost) matches(user, pass string) bool {
+	u := subtle.ConstantTimeCompare([]byte(user), []byte(h.Username))
+	p := subtle.ConstantTimeCompare([]byte(pass), []byte(h.Password))
+	return u&p == 1
+}
+
+func (s *ddnsServer) badauth(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="dnsme"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprintln(w, "badauth")
+}
+
+// set points the record for h at ip, returning the DynDNS2 response for
+// the host.
+func (s *ddnsServer) set(h *ddnsHost, ip net.IP) string {
+
+	rtype := "AAAA"
+	if ip.To4() != nil {
+		rtype = "A"
+	}
+	addr := ip.String()
+	key := h.FQDN + " " + rtype
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last, ok := s.last[key]; ok && last.addr == addr && time.Since(last.set) < s.recheck {
+		return "nochg " + addr
+	}
+	delete(s.last, key)
+
+	name := h.Name
+	existing, err := matchRecords(h.Domain, recordSelector{Name: &name, Type: rtype, GtdLocation: "DEFAULT"})
+	if err != nil {
+		s.logf("%s %s: %s", h.FQDN, rtype, err)
+		return "dnserr"
+	}
+
+	var c recordChange
+	switch len(existing) {
+	case 0:
+		r := dnsme.Record{Name: h.Name, Type: rtype, Data: addr, TTL: h.TTL, GtdLocation: "DEFAULT"}
+		c = recordChange{Op: opCreate, Domain: h.Domain, Record: r}
+	case 1:
+		old := existing[0]
+		old.Error = nil
+		if old.Data == addr {
+			s.last[key] = ddnsAddress{addr, time.Now()}
+			return "nochg " + addr
+		}
+		r := old
+		r.Data = addr
+		c = recordChange{Op: opUpdate, Domain: h.Domain, Record: r, Old: &old}
+	default:
+		s.logf("%s %s: %d records exist", h.FQDN, rtype, len(existing))
+		return "dnserr"
+	}
+
+	err = applyChanges([]recordChange{c}, nil)
+	if err != nil {
+		s.logf("%s %s: %s", h.FQDN, rtype, err)
+		return "dnserr"
+	}
+
+	was := ""
+	if c.Old != nil {
+		was = " (was " + c.Old.Data + ")"
+	}
+	s.logf("%s %s set to %s%s", h.FQDN, rtype, addr, was)
+	s.last[key] = ddnsAddress{addr, time.Now()}
+	return "good " + addr
+}
+
+func (s *ddnsServer) logf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
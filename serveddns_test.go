@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+// testDDNSServer returns a server for home.example.com, updated by alice,
+// and office.example.com, updated by bob.
+func testDDNSServer() *ddnsServer {
+	s := &ddnsServer{hosts: make(map[string]*ddnsHost), last: make(map[string]ddnsAddress), recheck: ddnsRecheck}
+	for _, h := range []*ddnsHost{
+		{FQDN: "home.example.com", Domain: "example.com", Name: "home", Username: "alice", Password: "a-secret", TTL: 300},
+		{FQDN: "office.example.com", Domain: "example.com", Name: "office", Username: "bob", Password: "b-secret", TTL: 300},
+	} {
+		s.hosts[h.FQDN] = h
+	}
+	return s
+}
+
+// ddnsUpdate sends an update of hostname to ip with the given credentials,
+// returning the response.
+func ddnsUpdate(s *ddnsServer, user, pass, hostname, ip string) (int, string) {
+	q := url.Values{"hostname": {hostname}, "myip": {ip}}
+	r := httptest.NewRequest("GET", "/nic/update?"+q.Encode(), nil)
+	if user != "" {
+		r.SetBasicAuth(user, pass)
+	}
+	w := httptest.NewRecorder()
+	s.update(w, r)
+	return w.Code, w.Body.String()
+}
+
+func TestServeDDNSAuth(t *testing.T) {
+	testAPI(t, dnsme.V1).AddDomain(dnsme.Domain{Name: "example.com"})
+	s := testDDNSServer()
+
+	for _, tt := range []struct {
+		user, pass, hostname string
+		code                 int
+		want                 string
+	}{
+		// unknown clients learn nothing about the hostnames
+		{"", "", "home.example.com", http.StatusUnauthorized, "badauth\n"},
+		{"alice", "wrong", "home.example.com", http.StatusUnauthorized, "badauth\n"},
+		{"mallory", "x", "nowhere.example.com", http.StatusUnauthorized, "badauth\n"},
+		{"mallory", "x", "nodots", http.StatusUnauthorized, "badauth\n"},
+
+		// the hosts of other users look like hosts not served
+		{"alice", "a-secret", "office.example.com", http.StatusOK, "nohost\n"},
+		{"alice", "a-secret", "nowhere.example.com", http.StatusOK, "nohost\n"},
+		{"alice", "a-secret", "nodots", http.StatusOK, "notfqdn\n"},
+		{"alice", "a-secret", "home.example.com,office.example.com", http.StatusOK, "nohost\n"},
+
+		{"alice", "a-secret", "home.example.com", http.StatusOK, "good 192.0.2.1\n"},
+		{"bob", "b-secret", "Office.Example.com.", http.StatusOK, "good 192.0.2.1\n"},
+	} {
+		code, body := ddnsUpdate(s, tt.user, tt.pass, tt.hostname, "192.0.2.1")
+		if code != tt.code || body != tt.want {
+			t.Errorf("%s:%s updating %s: %d %q, want %d %q", tt.user, tt.pass, tt.hostname, code, body, tt.code, tt.want)
+		}
+	}
+}
+
+func TestServeDDNSUpdate(t *testing.T) {
+	forVersions(t, func(t *testing.T, api *dnsmetest.Server) {
+		api.AddRecord("example.com", dnsme.Record{Name: "home", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+		s := testDDNSServer()
+
+		for _, tt := range []struct{ ip, want string }{
+			{"192.0.2.1", "nochg 192.0.2.1\n"},
+			{"192.0.2.2", "good 192.0.2.2\n"},
+			{"192.0.2.2", "nochg 192.0.2.2\n"},
+			{"2001:db8::1", "good 2001:db8::1\n"},
+		} {
+			if _, body := ddnsUpdate(s, "alice", "a-secret", "home.example.com", tt.ip); body != tt.want {
+				t.Errorf("updating to %s: %q, want %q", tt.ip, body, tt.want)
+			}
+		}
+		if got := recordsOf(api, "example.com"); got != "home A 192.0.2.2\nhome AAAA 2001:db8::1" {
+			t.Errorf("records after updates:\n%s", got)
+		}
+
+		api.AddRecord("example.com", dnsme.Record{Name: "office", Type: "A", Data: "192.0.2.8", TTL: 300, GtdLocation: "DEFAULT"})
+		api.AddRecord("example.com", dnsme.Record{Name: "office", Type: "A", Data: "192.0.2.9", TTL: 300, GtdLocation: "DEFAULT"})
+		if _, body := ddnsUpdate(s, "bob", "b-secret", "office.example.com", "192.0.2.1"); body != "dnserr\n" {
+			t.Errorf("updating a host with two A records: %q, want dnserr", body)
+		}
+	})
+}
+
+func TestServeDDNSRecheck(t *testing.T) {
+	api := testAPI(t, dnsme.V1)
+	id := api.AddRecord("example.com", dnsme.Record{Name: "home", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+	s := testDDNSServer()
+
+	if _, body := ddnsUpdate(s, "alice", "a-secret", "home.example.com", "192.0.2.2"); body != "good 192.0.2.2\n" {
+		t.Fatalf("update: %q", body)
+	}
+
+	// the record is changed by other means
+	if err := client.UpdateRecord("example.com", dnsme.Record{ID: id, Name: "home", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the address remembered is answered until it is rechecked
+	if _, body := ddnsUpdate(s, "alice", "a-secret", "home.example.com", "192.0.2.2"); body != "nochg 192.0.2.2\n" {
+		t.Errorf("update within the recheck time: %q, want nochg", body)
+	}
+
+	s.last["home.example.com A"] = ddnsAddress{"192.0.2.2", time.Now().Add(-s.recheck)}
+	if _, body := ddnsUpdate(s, "alice", "a-secret", "home.example.com", "192.0.2.2"); body != "good 192.0.2.2\n" {
+		t.Errorf("update after the recheck time: %q, want good", body)
+	}
+	if got := recordsOf(api, "example.com"); got != "home A 192.0.2.2" {
+		t.Errorf("records after the recheck:\n%s", got)
+	}
+}
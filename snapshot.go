@@ -0,0 +1,484 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// snapshotTime is the layout of the time in the names of snapshots.
+const snapshotTime = "20060102T150405Z"
+
+var snapshot = &Command{
+	Run:         runSnapshot,
+	CustomFlags: flagsSnapshot,
+	UsageLine: `snapshot create [-keep <n>] [-max-age <duration>] [-parallel <n>]
+    [-dir <directory>] [<domain>...]
+       dnsme snapshot list [-dir <directory>] [<domain>...]
+       dnsme snapshot show [-dir <directory>] <snapshot> [<domain>...]
+       dnsme snapshot restore [-dry-run] [-dir <directory>] <snapshot>
+    [<domain>...]`,
+	Short: "save and restore snapshots of domains",
+	Long: `
+'snapshot' keeps timestamped exports of domains in a local directory,
+e.g. before risky changes, from which the domains can be restored.
+
+'create' saves the domains given, or all domains, as a new snapshot and
+prints its name, the time it was taken, e.g. 20261018T080000Z.  The
+snapshot is an export file, as written by 'dnsme export'.
+
+'list' lists the snapshots, newest first, with the domains in each.  If
+domains are given, only snapshots holding them are listed.
+
+'show' writes the records of the domains in a snapshot, in the style of
+'dnsme records', or the snapshot itself with "-o json".
+
+'restore' makes the domains given, or all the domains in the snapshot,
+exactly as they were when it was taken, as 'dnsme sync' does: records
+added since are deleted, deleted records are created, and changed
+records are updated.  A snapshot of the domains as they are is taken
+first, so that the restore can be undone.  -dry-run shows the changes
+that would be made, without making them.
+
+<snapshot> is the name of a snapshot, a prefix of one unique among the
+snapshots, e.g. "20261018", or "latest" for the newest snapshot which
+holds the domains given.
+
+-dir is the directory holding the snapshots; the default is snapshots
+in the directory of the config file.
+
+-keep and -max-age limit the snapshots kept when one is created.  Older
+snapshots are deleted once each domain in them is in -keep newer
+snapshots, and once they are older than -max-age, e.g. "720h".  Either
+may be set by the "snapshot_keep" and "snapshot_max_age" keys of a
+profile.  By default all snapshots are kept.
+
+-parallel fetches up to n domains at once, as for 'dnsme export'.
+
+`,
+}
+
+func flagsSnapshot(f *flag.FlagSet) {
+	f.String("dir", "", "")
+	f.String("keep", "0", "")
+	f.Duration("max-age", 0, "")
+	flagParallel(f)
+	flagDryRun(f)
+}
+
+// A snapshotInfo describes a saved snapshot.
+type snapshotInfo struct {
+	Name    string         `json:"name"`
+	Created time.Time      `json:"created"`
+	Domains []string       `json:"domains"`
+	Records map[string]int `json:"records"`
+
+	file string
+}
+
+func runSnapshot(cmd *Command, args []string) (err error) {
+
+	if len(args) == 0 {
+		err = errors.New("create, list, show or restore not specified")
+		return
+	}
+
+	// flags may also follow the action
+	action := args[0]
+	err = cmd.Flag.Parse(args[1:])
+	if err != nil {
+		return
+	}
+	args = cmd.Flag.Args()
+
+	dir := expandHome(cmd.Flag.Lookup("dir").Value.String())
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(configPath()), "snapshots")
+	}
+
+	switch action {
+	case "create":
+		var info snapshotInfo
+		info, err = createSnapshot(cmd, dir, args, "")
+		if err != nil {
+			return
+		}
+		fmt.Println(info.Name)
+	case "list":
+		err = listSnapshots(dir, args)
+	case "show":
+		err = showSnapshot(cmd, dir, args)
+	case "restore":
+		err = restoreSnapshot(cmd, dir, args)
+	default:
+		err = fmt.Errorf("unknown action %q; expected create, list, show or restore", action)
+	}
+	return
+}
+
+// createSnapshot saves the domains, or all domains, in a new snapshot
+// in dir, then removes the snapshots no longer to be kept, other than
+// the snapshot named by protect.
+func createSnapshot(cmd *Command, dir string, domains []string, protect string) (info snapshotInfo, err error) {
+
+	keep, err := strconv.Atoi(cmd.Flag.Lookup("keep").Value.String())
+	if err != nil || keep < 0 {
+		err = fmt.Errorf("invalid -keep %q", cmd.Flag.Lookup("keep").Value.String())
+		return
+	}
+	maxAge, _ := time.ParseDuration(cmd.Flag.Lookup("max-age").Value.String())
+
+	n, err := parallelism(cmd)
+	if err != nil {
+		return
+	}
+
+	if len(domains) == 0 {
+		domains, err = client.Domains()
+		if err != nil {
+			return
+		}
+		sort.Strings(domains)
+	}
+
+	data, err := fetchDomains(n, domains)
+	if err != nil {
+		return
+	}
+
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return
+	}
+
+	// snapshots taken in the same second are numbered
+	now := time.Now().UTC()
+	info.Name = now.Format(snapshotTime)
+	for i := 2; ; i++ {
+		var f *os.File
+		f, err = os.OpenFile(filepath.Join(dir, info.Name+".json"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			info.Name = now.Format(snapshotTime) + "-" + strconv.Itoa(i)
+			continue
+		}
+		if err != nil {
+			return
+		}
+		_, err = f.Write(append(b, '\n'))
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			return
+		}
+		break
+	}
+
+	err = pruneSnapshots(dir, keep, maxAge, info.Name, protect)
+	return
+}
+
+// pruneSnapshots removes the snapshots in dir, other than those named by
+// protect, which are older than maxAge, or whose domains are each in
+// keep newer snapshots.  Zero keep or maxAge does not limit them.
+func pruneSnapshots(dir string, keep int, maxAge time.Duration, protect ...string) (err error) {
+
+	if keep == 0 && maxAge == 0 {
+		return
+	}
+
+	snapshots, err := readSnapshots(dir)
+	if err != nil {
+		return
+	}
+
+	newer := make(map[string]int)
+	for _, s := range snapshots {
+		needed := keep == 0
+		for _, d := range s.Domains {
+			newer[d]++
+			if newer[d] <= keep {
+				needed = true
+			}
+		}
+		if maxAge > 0 && time.Since(s.Created) > maxAge {
+			needed = false
+		}
+		for _, name := range protect {
+			needed = needed || s.Name == name
+		}
+		if needed {
+			continue
+		}
+
+		err = os.Remove(s.file)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "removed snapshot %s\n", s.Name)
+	}
+	return
+}
+
+// readSnapshots returns the snapshots in dir, newest first.
+func readSnapshots(dir string) (snapshots []snapshotInfo, err error) {
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".json")
+		created, e := time.Parse(snapshotTime, strings.SplitN(name, "-", 2)[0])
+		if e != nil {
+			continue
+		}
+
+		var data []exportDomain
+		data, err = readSnapshot(file)
+		if err != nil {
+			return
+		}
+
+		s := snapshotInfo{Name: name, Created: created, Records: make(map[string]int), file: file}
+		for _, d := range data {
+			s.Domains = append(s.Domains, d.Domain.Name)
+			s.Records[d.Domain.Name] = len(d.Records)
+		}
+		snapshots = append(snapshots, s)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		if !snapshots[i].Created.Equal(snapshots[j].Created) {
+			return snapshots[i].Created.After(snapshots[j].Created)
+		}
+		return snapshotSeq(snapshots[i].Name) > snapshotSeq(snapshots[j].Name)
+	})
+	return
+}
+
+// snapshotSeq returns the number of a snapshot among those taken in the
+// same second.
+func snapshotSeq(name string) int {
+	if i := strings.Index(name, "-"); i >= 0 {
+		n, _ := strconv.Atoi(name[i+1:])
+		return n
+	}
+	return 1
+}
+
+func readSnapshot(file string) (data []exportDomain, err error) {
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &data)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", file, err)
+	}
+	return
+}
+
+// findSnapshot returns the snapshot called name, which may be a unique
+// prefix of the name, or "latest" for the newest holding all domains.
+func findSnapshot(dir, name string, domains []string) (info snapshotInfo, err error) {
+
+	snapshots, err := readSnapshots(dir)
+	if err != nil {
+		return
+	}
+
+	var found []snapshotInfo
+	for _, s := range snapshots {
+		switch {
+		case name == "latest":
+			if s.holds(domains) {
+				info = s
+				return
+			}
+		case s.Name == name:
+			info = s
+			return
+		case strings.HasPrefix(s.Name, name):
+			found = append(found, s)
+		}
+	}
+
+	switch {
+	case len(found) == 1:
+		info = found[0]
+	case len(found) > 1:
+		var names []string
+		for _, s := range found {
+			names = append(names, s.Name)
+		}
+		err = fmt.Errorf("%q matches %d snapshots: %s", name, len(found), strings.Join(names, ", "))
+	case name == "latest":
+		err = fmt.Errorf("no snapshot in %s holds %s", dir, strings.Join(domains, ", "))
+	default:
+		err = fmt.Errorf("no snapshot %q in %s", name, dir)
+	}
+	return
+}
+
+// holds reports whether the snapshot holds each of domains.
+func (s snapshotInfo) holds(domains []string) bool {
+	for _, d := range domains {
+		if _, ok := s.Records[d]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func listSnapshots(dir string, domains []string) (err error) {
+
+	snapshots, err := readSnapshots(dir)
+	if err != nil {
+		return
+	}
+
+	listed := []snapshotInfo{}
+	for _, s := range snapshots {
+		if s.holds(domains) {
+			listed = append(listed, s)
+		}
+	}
+
+	if outputType == "json" {
+		b, _ := json.Marshal(listed)
+		os.Stdout.Write(b)
+		return
+	}
+
+	for _, s := range listed {
+		var counts []string
+		for _, d := range s.Domains {
+			counts = append(counts, fmt.Sprintf("%s (%d)", d, s.Records[d]))
+		}
+		fmt.Printf("%-20s %s  %s\n", s.Name, s.Created.Local().Format("2006-01-02 15:04:05"), strings.Join(counts, ", "))
+	}
+	return
+}
+
+// snapshotDomains reads the snapshot named by args[0], returning the
+// domains in it named by the rest of args, or all of them.
+func snapshotDomains(dir string, args []string) (info snapshotInfo, data []exportDomain, err error) {
+
+	if len(args) == 0 {
+		err = errors.New("snapshot not specified")
+		return
+	}
+
+	info, err = findSnapshot(dir, args[0], args[1:])
+	if err != nil {
+		return
+	}
+
+	data, err = readSnapshot(info.file)
+	if err != nil {
+		return
+	}
+
+	data, err = selectDomains(data, args[1:])
+	if err != nil {
+		err = fmt.Errorf("snapshot %s: %s", info.Name, err)
+	}
+	return
+}
+
+func showSnapshot(cmd *Command, dir string, args []string) (err error) {
+
+	_, data, err := snapshotDomains(dir, args)
+	if err != nil {
+		return
+	}
+
+	if outputType == "json" {
+		b, _ := json.Marshal(data)
+		os.Stdout.Write(b)
+		return
+	}
+
+	for i, d := range data {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("; %s\n", d.Domain.Name)
+		outputRecords(cmd, d.Records)
+	}
+	return
+}
+
+func restoreSnapshot(cmd *Command, dir string, args []string) (err error) {
+
+	info, data, err := snapshotDomains(dir, args)
+	if err != nil {
+		return
+	}
+
+	data, skipped := validDomains(os.Stderr, data)
+
+	// the existing domains are saved before they are changed
+	var changes []recordChange
+	var existing []string
+	for _, d := range data {
+		var c []recordChange
+		c, _, err = domainChanges(d)
+		if err != nil {
+			return
+		}
+		changes = append(changes, c...)
+		if len(c) > 0 && c[0].Op != opCreateDomain {
+			existing = append(existing, d.Domain.Name)
+		}
+	}
+
+	if dryRun(cmd) {
+		outputChanges(os.Stdout, changes)
+		return
+	}
+
+	if len(existing) > 0 {
+		var before snapshotInfo
+		before, err = createSnapshot(cmd, dir, existing, info.Name)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "saved the domains as they were in snapshot %s\n", before.Name)
+	}
+
+	applied := []recordChange{}
+	err = applyChanges(changes, func(c recordChange) {
+		applied = append(applied, c)
+		if outputType != "json" {
+			printChange(os.Stdout, c)
+		}
+	})
+
+	if outputType == "json" {
+		b, _ := json.Marshal(applied)
+		os.Stdout.Write(b)
+	} else if err == nil && len(applied) == 0 {
+		fmt.Println("No changes.")
+	}
+
+	if err == nil && skipped > 0 {
+		err = fmt.Errorf("%d domains of snapshot %s skipped for invalid records", skipped, info.Name)
+	}
+	return
+}
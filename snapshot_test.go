@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+// writeSnapshot writes a snapshot called name to dir, holding the domains
+// with one record each.
+func writeSnapshot(t *testing.T, dir, name string, domains ...string) {
+	t.Helper()
+	data := []exportDomain{}
+	for _, d := range domains {
+		data = append(data, exportDomain{
+			Domain:  dnsme.Domain{Name: d},
+			Records: []dnsme.Record{{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"}},
+		})
+	}
+	b, _ := json.Marshal(data)
+	if err := os.WriteFile(filepath.Join(dir, name+".json"), b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// snapshotNames returns the names of the snapshots in dir, newest first.
+func snapshotNames(t *testing.T, dir string) string {
+	t.Helper()
+	snapshots, err := readSnapshots(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range snapshots {
+		names = append(names, s.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestSnapshot(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		www := s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+		s.AddRecord("example.com", dnsme.Record{Name: "", Type: "MX", Data: "10 mail.example.com.", TTL: 3600, GtdLocation: "DEFAULT"})
+		s.AddRecord("example.org", dnsme.Record{Name: "ftp", Type: "CNAME", Data: "example.org.", TTL: 3600, GtdLocation: "DEFAULT"})
+		want := sortedRecordsOf(s, "example.com")
+
+		name := strings.TrimSpace(mustRun(t, "snapshot", "create"))
+		dir := filepath.Join(filepath.Dir(os.Getenv("DNSME_CONFIG")), "snapshots")
+		if _, err := os.Stat(filepath.Join(dir, name+".json")); err != nil {
+			t.Fatalf("snapshot create: %v", err)
+		}
+
+		out := mustRun(t, "snapshot", "list")
+		if !strings.HasPrefix(out, name) || !strings.HasSuffix(out, "example.com (2), example.org (1)\n") {
+			t.Errorf("snapshot list = %q", out)
+		}
+
+		out = mustRun(t, "snapshot", "show", name, "example.com")
+		if !strings.HasPrefix(out, "; example.com\n") || !strings.Contains(out, "192.0.2.1") || strings.Contains(out, "ftp") {
+			t.Errorf("snapshot show = %q", out)
+		}
+		var shown []exportDomain
+		if err := json.Unmarshal([]byte(mustRun(t, "snapshot", "show", "-o", "json", "latest")), &shown); err != nil || len(shown) != 2 {
+			t.Errorf("snapshot show -o json = %+v, %v", shown, err)
+		}
+
+		// change the domains
+		if err := client.UpdateRecord("example.com", dnsme.Record{ID: www, Name: "www", Type: "A", Data: "192.0.2.1", TTL: 600, GtdLocation: "DEFAULT"}); err != nil {
+			t.Fatal(err)
+		}
+		s.AddRecord("example.com", dnsme.Record{Name: "new", Type: "A", Data: "192.0.2.3", TTL: 300, GtdLocation: "DEFAULT"})
+		mustRun(t, "delete-domain", "example.org")
+		changed := sortedRecordsOf(s, "example.com")
+
+		out = mustRun(t, "snapshot", "restore", "-dry-run", name)
+		if !strings.Contains(out, "1 to create, 1 to update, 1 to delete, 1 domains to create") {
+			t.Errorf("snapshot restore -dry-run = %q", out)
+		}
+		if sortedRecordsOf(s, "example.com") != changed || snapshotNames(t, dir) != name {
+			t.Error("snapshot restore -dry-run made changes")
+		}
+
+		_, stderr, err := run(t, "snapshot", "restore", "latest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sortedRecordsOf(s, "example.com"); got != want {
+			t.Errorf("records after restore:\n%s\nwant:\n%s", got, want)
+		}
+		if r := s.Records("example.com")[0]; r.TTL != 300 {
+			t.Errorf("record after restore = %+v, want TTL 300", r)
+		}
+		if got := recordsOf(s, "example.org"); got != "ftp CNAME example.org." {
+			t.Errorf("records of the deleted domain after restore:\n%s", got)
+		}
+
+		// the domains were saved first, so the restore can be undone
+		if !strings.Contains(stderr, "saved the domains as they were in snapshot") {
+			t.Errorf("restore stderr = %q", stderr)
+		}
+		before := strings.Fields(snapshotNames(t, dir))[0]
+		if before == name {
+			t.Fatal("no snapshot was taken before the restore")
+		}
+		mustRun(t, "snapshot", "restore", before)
+		if got := sortedRecordsOf(s, "example.com"); got != changed {
+			t.Errorf("records after undoing the restore:\n%s\nwant:\n%s", got, changed)
+		}
+
+		// only the domains given are restored
+		mustRun(t, "snapshot", "restore", name, "example.com")
+		if got := sortedRecordsOf(s, "example.com"); got != want {
+			t.Errorf("records after restoring example.com:\n%s", got)
+		}
+		if _, _, err := run(t, "snapshot", "restore", name, "example.net"); err == nil {
+			t.Error("restoring a domain not in the snapshot succeeded")
+		}
+	})
+}
+
+func TestFindSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	writeSnapshot(t, dir, "20261017T080000Z", "example.com", "example.org")
+	writeSnapshot(t, dir, "20261018T080000Z", "example.com")
+	writeSnapshot(t, dir, "20261018T080000Z-2", "example.com")
+	writeSnapshot(t, dir, "20261018T090000Z-10", "example.com")
+	writeSnapshot(t, dir, "20261018T090000Z-9", "example.com")
+	// not a snapshot
+	writeSnapshot(t, dir, "backup", "example.com")
+
+	if got, want := snapshotNames(t, dir), "20261018T090000Z-10 20261018T090000Z-9 20261018T080000Z-2 20261018T080000Z 20261017T080000Z"; got != want {
+		t.Errorf("snapshots = %s, want %s", got, want)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		domains []string
+		want    string
+	}{
+		{"latest", nil, "20261018T090000Z-10"},
+		{"latest", []string{"example.org"}, "20261017T080000Z"},
+		{"20261017", nil, "20261017T080000Z"},
+		{"20261018T080000Z", nil, "20261018T080000Z"},
+		{"20261018T080000Z-", nil, "20261018T080000Z-2"},
+	} {
+		info, err := findSnapshot(dir, tt.name, tt.domains)
+		if err != nil || info.Name != tt.want {
+			t.Errorf("findSnapshot(%q, %q) = %s, %v; want %s", tt.name, tt.domains, info.Name, err, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		domains []string
+		err     string
+	}{
+		{"20261018", nil, `"20261018" matches 4 snapshots`},
+		{"2025", nil, `no snapshot "2025"`},
+		{"latest", []string{"example.net"}, "no snapshot in " + dir + " holds example.net"},
+	} {
+		if _, err := findSnapshot(dir, tt.name, tt.domains); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("findSnapshot(%q, %q): err = %v, want %q", tt.name, tt.domains, err, tt.err)
+		}
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	now := time.Now().UTC()
+	day := func(n int) string { return now.AddDate(0, 0, -n).Format(snapshotTime) }
+
+	dir := t.TempDir()
+	writeSnapshot(t, dir, day(4), "example.com", "example.org")
+	writeSnapshot(t, dir, day(3), "example.com")
+	writeSnapshot(t, dir, day(2), "example.com")
+	writeSnapshot(t, dir, day(1), "example.com")
+
+	// the oldest is kept while example.org is in no newer snapshot
+	if err := pruneSnapshots(dir, 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := snapshotNames(t, dir), day(1)+" "+day(2)+" "+day(4); got != want {
+		t.Errorf("snapshots after -keep 2 = %s, want %s", got, want)
+	}
+
+	if err := pruneSnapshots(dir, 0, 36*time.Hour, day(4)); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := snapshotNames(t, dir), day(1)+" "+day(4); got != want {
+		t.Errorf("snapshots after -max-age 36h = %s, want %s", got, want)
+	}
+
+	if err := pruneSnapshots(dir, 0, 0); err != nil || snapshotNames(t, dir) != day(1)+" "+day(4) {
+		t.Errorf("snapshots after pruning without limits = %s, %v", snapshotNames(t, dir), err)
+	}
+}
+
+func TestSnapshotKeep(t *testing.T) {
+	s := testAPI(t, dnsme.V1)
+	s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+	dir := t.TempDir()
+	writeSnapshot(t, dir, "20261017T080000Z", "example.com")
+	writeSnapshot(t, dir, "20261017T090000Z", "example.com")
+
+	// flags may follow the action
+	name := strings.TrimSpace(mustRun(t, "snapshot", "create", "-dir", dir, "-keep", "2"))
+	if got, want := snapshotNames(t, dir), name+" 20261017T090000Z"; got != want {
+		t.Errorf("snapshots after create -keep 2 = %s, want %s", got, want)
+	}
+
+	writeConfig(t, "[default]\nsnapshot_keep = 1\n")
+	name = strings.TrimSpace(mustRun(t, "snapshot", "create", "-dir", dir))
+	if got := snapshotNames(t, dir); got != name {
+		t.Errorf("snapshots after create with snapshot_keep = 1: %s, want %s", got, name)
+	}
+
+	for _, args := range [][]string{
+		{"snapshot"},
+		{"snapshot", "take"},
+		{"snapshot", "create", "-keep", "-1"},
+		{"snapshot", "show", "-dir", dir},
+		{"snapshot", "restore", "-dir", dir, "2025"},
+	} {
+		if _, _, err := run(t, args...); err == nil {
+			t.Errorf("dnsme %s succeeded", strings.Join(args, " "))
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+var syncData = &Command{
+	Run:         runSync,
+	CustomFlags: flagsSync,
+	UsageLine:   "sync [-file <export file>] [<domain>...]",
+	Short:       "make domains match an export file",
+	Long: `
+'sync' makes the records of each domain in an export file (see 'dnsme
+help export') match the file exactly, creating the domain if necessary.
+
+Records are matched on their name, type, data and gtdLocation.  Records
+only in the file are created, records only in DNS Made Easy are deleted,
+and matching records whose TTL, dynamic DNS password or HTTP redirect
+settings differ are updated.  Nothing is changed for domains which
+already match, so sync may be run repeatedly.
+
+Records are checked as by 'dnsme import'.  A domain with invalid records
+is reported and skipped, as the records left out would be deleted; the
+other domains are synced.
+
+If domains are given, only those domains from the file are synced.
+
+If no export file is specified, then standard input is used.
+
+`,
+}
+
+func flagsSync(f *flag.FlagSet) {
+	f.String("file", "-", "")
+}
+
+func runSync(cmd *Command, args []string) (err error) {
+
+	r, err := getReader(cmd.Flag.Lookup("file").Value.String())
+	if err != nil {
+		return
+	}
+
+	var desired []exportDomain
+	err = json.NewDecoder(r).Decode(&desired)
+	if err != nil {
+		return
+	}
+
+	desired, err = selectDomains(desired, args)
+	if err != nil {
+		return
+	}
+
+	desired, skipped := validDomains(os.Stderr, desired)
+
+	var applied []recordChange
+	for _, d := range desired {
+		var changes []recordChange
+		changes, _, err = domainChanges(d)
+		if err != nil {
+			return
+		}
+
+		err = applyChanges(changes, func(c recordChange) {
+			applied = append(applied, c)
+			if outputType != "json" {
+				printChange(os.Stdout, c)
+			}
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	if outputType == "json" {
+		b, _ := json.Marshal(applied)
+		os.Stdout.Write(b)
+	}
+
+	if skipped > 0 {
+		err = fmt.Errorf("%d domains skipped for invalid records", skipped)
+	}
+	return
+}
+
+// selectDomains returns the domains named in names, or all domains if
+// no names are given.
+func selectDomains(domains []exportDomain, names []string) (selected []exportDomain, err error) {
+
+	if len(names) == 0 {
+		selected = domains
+		return
+	}
+
+	for _, name := range names {
+		found := false
+		for _, d := range domains {
+			if d.Domain.Name == name {
+				selected = append(selected, d)
+				found = true
+			}
+		}
+		if !found {
+			err = fmt.Errorf("domain %s not found in file", name)
+			return
+		}
+	}
+	return
+}
+
+// domainChanges compares the desired state of a domain with its live
+// records.  A domain which does not exist yet is to be created.  The
+// fingerprint identifies the live records the changes were computed
+// against.
+func domainChanges(d exportDomain) (changes []recordChange, fingerprint string, err error) {
+
+	name := d.Domain.Name
+	if name == "" {
+		err = errors.New("domain has no name")
+		return
+	}
+
+	var current []dnsme.Record
+	absent := false
+
+	_, err = client.Domain(name)
+	switch err {
+	case nil:
+		current, err = client.Records(name, nil)
+		if err != nil {
+			return
+		}
+	case dnsme.ErrNotFound:
+		info := d.Domain
+		changes = append(changes, recordChange{Op: opCreateDomain, Domain: name, Info: &info})
+		absent = true
+		err = nil
+	default:
+		return
+	}
+
+	fingerprint = recordsFingerprint(current, absent)
+	changes = append(changes, diffRecords(name, current, d.Records)...)
+	return
+}
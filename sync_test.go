@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+func TestDiffRecords(t *testing.T) {
+	current := []dnsme.Record{
+		{ID: 1, Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"},
+		{ID: 2, Name: "old", Type: "A", Data: "192.0.2.2", TTL: 300, GtdLocation: "DEFAULT"},
+		{ID: 3, Name: "", Type: "MX", Data: "10 mail.example.com.", TTL: 3600, GtdLocation: "DEFAULT"},
+		{ID: 4, Name: "dup", Type: "A", Data: "192.0.2.4", TTL: 300, GtdLocation: "DEFAULT"},
+		{ID: 5, Name: "dup", Type: "A", Data: "192.0.2.4", TTL: 300, GtdLocation: "DEFAULT"},
+	}
+	desired := []dnsme.Record{
+		{Name: "WWW", Type: "A", Data: "192.0.2.1", TTL: 300},
+		{Name: "", Type: "MX", Data: "10 mail.example.com.", TTL: 600, GtdLocation: "DEFAULT"},
+		{Name: "new", Type: "A", Data: "192.0.2.3", TTL: 300},
+		{Name: "dup", Type: "A", Data: "192.0.2.4", TTL: 300, GtdLocation: "DEFAULT"},
+	}
+
+	var got []string
+	for _, c := range diffRecords("example.com", current, desired) {
+		got = append(got, fmt.Sprintf("%s %d %s %d", c.Op, c.Record.ID, c.Record.Name, c.Record.TTL))
+		if c.Op == opUpdate && (c.Old == nil || c.Old.TTL != 3600) {
+			t.Errorf("update of %+v: old = %+v, want the record with TTL 3600", c.Record, c.Old)
+		}
+	}
+	want := []string{
+		"delete 2 old 300",
+		"delete 5 dup 300",
+		"update 3  600",
+		"create 0 new 300",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if changes := diffRecords("example.com", current, current); len(changes) != 0 {
+		t.Errorf("changes between equal record sets: %v", changes)
+	}
+}
+
+// exportFile writes domains to an export file, returning its name.
+func exportFile(t *testing.T, domains ...exportDomain) string {
+	t.Helper()
+	b, err := json.Marshal(domains)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, "export.json", string(b))
+}
+
+func TestSync(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+		s.AddRecord("example.com", dnsme.Record{Name: "old", Type: "A", Data: "192.0.2.2", TTL: 300, GtdLocation: "DEFAULT"})
+
+		file := exportFile(t,
+			exportDomain{Domain: dnsme.Domain{Name: "example.com"}, Records: []dnsme.Record{
+				{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 600},
+				{Name: "new", Type: "A", Data: "192.0.2.3", TTL: 300},
+			}},
+			exportDomain{Domain: dnsme.Domain{Name: "example.org"}, Records: []dnsme.Record{
+				{Name: "www", Type: "CNAME", Data: "example.org.", TTL: 300},
+			}},
+		)
+
+		out := mustRun(t, "sync", "-file", file)
+		for _, want := range []string{"+ example.org: domain", "- example.com: old", "~ example.com: www", "+ example.com: new", "+ example.org: www"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("sync output lacks %q:\n%s", want, out)
+			}
+		}
+		if got := recordsOf(s, "example.com"); got != "www A 192.0.2.1\nnew A 192.0.2.3" {
+			t.Errorf("example.com after sync:\n%s", got)
+		}
+		if s.Records("example.com")[0].TTL != 600 {
+			t.Errorf("TTL of www after sync = %d, want 600", s.Records("example.com")[0].TTL)
+		}
+		if got := recordsOf(s, "example.org"); got != "www CNAME example.org." {
+			t.Errorf("example.org after sync:\n%s", got)
+		}
+
+		// a second sync changes nothing
+		if out := mustRun(t, "sync", "-file", file); out != "" {
+			t.Errorf("second sync:\n%s", out)
+		}
+
+		if _, _, err := run(t, "sync", "-file", file, "example.net"); err == nil {
+			t.Error("sync of a domain not in the file succeeded")
+		}
+	})
+}
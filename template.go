@@ -23,12 +23,17 @@ order to use it, an API key pair must be configured for your account:
 this can be trivially created by visiting your account information page
 at https://cp.dnsmadeeasy.com/account/info.
 
-The following environment variables should be set:
+The following environment variables should be set, unless a config
+file profile is used (see -profile below):
 
     DNSME_API_URL = http://api.dnsmadeeasy.com/V1.2
     DNSME_API_KEY = API key
     DNSME_SECRET_KEY = Secret key
 
+Both the V1.2 and V2.0 APIs are supported; the version is taken from the
+end of DNSME_API_URL, e.g. https://api.dnsmadeeasy.com/V2.0.  Secondary
+domains are only available with V1.2.
+
 Available commands are:
 {{range .}}{{if .Runnable}}
     {{.Name | printf "%-16s"}} {{.Short}}{{end}}{{end}}
@@ -40,9 +45,58 @@ Global flags:
 The -d flag can be used to print raw HTTP requests and responses to
 stderr.
 
+The -api flag selects the API version, "1.2" or "2.0", overriding the
+version in DNSME_API_URL.  If DNSME_API_URL is not set, the production
+URL for that version is used.
+
+Requests are paced to stay within the API rate limit, and are retried
+after network and server errors.  The -max-wait flag sets the longest a
+single request may be held back or retried before giving up, e.g. "30s"
+or "10m".  Default value is "5m".  Delays are reported on stderr.
+
 The flag "-o" specifies the output type.  Available output types are
 "csv", "json", or the default text-based "std".
 
+Every change made through the API is appended to an audit log, by
+default audit.log in the directory of the config file; see 'dnsme help
+audit'.  The -audit-log flag names another file, or turns the log off
+with "off".
+
+The -profile flag selects a profile from the config file, by default
+~/.config/dnsme/config (or $DNSME_CONFIG).  DNSME_PROFILE may be set
+instead; otherwise the profile named "default" is used, if present.
+A profile holds the credentials of an account and default flag values:
+
+    [sandbox]
+    url = https://api.sandbox.dnsmadeeasy.com/V2.0
+    api_key = API key
+    secret_key = Secret key
+    output = json
+    api = 2.0
+    max_wait = 1m
+    ttl = 300
+    gtdLocation = DEFAULT
+
+ttl and gtdLocation are the defaults of the records written by
+add-record, update-record and upsert-record; other commands, which use
+these flags to select records, ignore them.
+
+Flags given on the command line take precedence over the environment
+variables, which take precedence over the profile.
+
+Rather than holding the key pair itself, a profile may name one of:
+
+    credentials_file = <file>
+        a JSON file of the form {"apiKey": "...", "secretKey": "..."},
+        which must not be readable by other users
+    credential_process = <command>
+        a command run with /bin/sh, which writes the key pair to
+        standard output in the same form
+    credential_store = <file>
+        a store encrypted with a passphrase, created with 'dnsme
+        save-credentials'.  The passphrase is read from the
+        terminal.
+
 `
 
 var helpTemplate = `{{if .Runnable}}usage: dnsme {{.UsageLine}}
@@ -51,7 +105,7 @@ var helpTemplate = `{{if .Runnable}}usage: dnsme {{.UsageLine}}
 
 `
 
-var domainListTemplate = `{{range .List}}{{printf "%s\n" .}}{{end}}`
+var domainListTemplate = `{{range .}}{{printf "%s\n" .}}{{end}}`
 
 var domainInfoTemplate = `{{range .NameServers}}{{printf "Nameserver: %s\n" .}}{{end}}{{range .VanityNameServers}}{{printf "Vanity NS: %s\n" .}}{{end}}GTD Enabled: {{.GtdEnabled}}
 `
@@ -62,5 +116,13 @@ var secondaryTemplate = `{{range .IP}}{{printf "IP: %s\n" .}}{{end}}`
 var secondaryTemplateCSV = `{{.Name}},{{range .IP}}{{.}} {{end}}`
 
 // looks like zone file entries
-var recordTemplate = `{{if .Name}}{{printf "%-20s" .Name}}{{else}}{{printf "%-20s" "@"}}{{end}} {{printf "%-6d" .TTL}} {{printf "%-5s" .Type}} {{if .Data}}{{printf "%-32s" .Data}}{{else}}{{printf "%-32s" "@"}}{{end}} ; id={{printf "%-7d" .ID}}, gtd={{.GtdLocation}}
+var recordTemplate = redirectTemplate + `{{if .Name}}{{printf "%-20s" .Name}}{{else}}{{printf "%-20s" "@"}}{{end}} {{printf "%-6d" .TTL}} {{printf "%-5s" .Type}} {{if .Data}}{{printf "%-32s" .Data}}{{else}}{{printf "%-32s" "@"}}{{end}} ; id={{printf "%-7d" .ID}}, gtd={{.GtdLocation}}{{if eq .Type "HTTPRED"}}{{template "redirect" .}}{{end}}
 `
+
+// redirectTemplate defines "redirect", the settings of an HTTPRED record
+// appended to its comment.
+var redirectTemplate = `{{define "redirect"}}, redirect={{printf "%q" .RedirectType}}` +
+	`{{if .HardLink}}, hardLink{{end}}` +
+	`{{if .Title}}, title={{printf "%q" .Title}}{{end}}` +
+	`{{if .Keywords}}, keywords={{printf "%q" .Keywords}}{{end}}` +
+	`{{if .Description}}, description={{printf "%q" .Description}}{{end}}{{end}}`
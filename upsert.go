@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+var upsertRecord = &Command{
+	Run:         runUpsertRecord,
+	CustomFlags: flagsUpsertRecord,
+	UsageLine: `upsert-record -name <name> -type <record type> -data <record data>
+    [-data <record data>... -replace] [-ttl <ttl>] [-gtdLocation <gtdLocation>]
+    [-password <password>] [MX, SRV, TXT or HTTPRED flags] [-dry-run]
+    [-wait <duration>] <domain>`,
+	Short: "create or update a record",
+	Long: `
+'upsert-record' makes a record exist with the given data, whether or not
+there is already a record with its name, type and gtdLocation.
+
+If a record with the name, type and gtdLocation exists, it is updated in
+place: if one of them already has the data it is used, otherwise there
+must be only one.  If there are none, the record is created.
+
+-replace makes the records with the name, type and gtdLocation exactly
+those given, e.g. to set all the addresses of a host:
+
+    dnsme upsert-record -name www -type A -replace \
+        -data 192.0.2.1 -data 192.0.2.2 example.com
+
+Existing records are updated in place where possible; any others are
+deleted.
+
+-ttl is the TTL of the records.  If it is not given, existing records
+keep their TTL, and new records have a TTL of 3600 (one hour).
+
+The other flags are those of 'dnsme add-record'.  Only the flags given
+are changed in existing records.
+
+The changes made are shown in the style of 'dnsme plan', or "No changes."
+if the records were already as given.  With "-o json", the changes are
+written as a JSON array, which is empty if nothing changed.
+
+-dry-run shows the changes that would be made, without making them.
+
+-wait waits, up to the given time, e.g. "2m", until the changes are
+served by the nameservers of the domain, or those given by -nameserver;
+see 'dnsme help wait'.
+
+`,
+}
+
+func flagsUpsertRecord(f *flag.FlagSet) {
+	f.String("name", "", "")
+	f.String("type", "", "")
+	f.Var(&stringList{}, "data", "")
+	f.String("ttl", "3600", "")
+	f.String("gtdLocation", "DEFAULT", "")
+	f.String("password", "", "")
+	f.Bool("replace", false, "")
+	flagsRedirect(f)
+	flagsRecordData(f)
+	flagDryRun(f)
+	flagsWait(f)
+}
+
+func runUpsertRecord(cmd *Command, args []string) (err error) {
+
+	if len(args) == 0 {
+		err = errors.New("domain not specified")
+		return
+	}
+
+	domain := args[0]
+	given := givenFlags(cmd)
+	value := func(name string) string { return cmd.Flag.Lookup(name).Value.String() }
+	replace := value("replace") == "true"
+
+	if !given("name") || value("type") == "" {
+		err = errors.New("-name and -type must be given")
+		return
+	}
+
+	desired, err := upsertRecords(cmd, domain)
+	if err != nil {
+		return
+	}
+
+	name := value("name")
+	existing, err := matchRecords(domain, recordSelector{
+		Name:        &name,
+		Type:        value("type"),
+		GtdLocation: value("gtdLocation"),
+	})
+	if err != nil {
+		return
+	}
+
+	var changes []recordChange
+	if replace {
+		if !given("ttl") && len(existing) > 0 {
+			for i := range desired {
+				desired[i].TTL = existing[0].TTL
+			}
+		}
+		changes = mergeReplacements(diffRecords(domain, existing, desired))
+	} else {
+		var c *recordChange
+		c, err = upsertChange(cmd, domain, existing, desired[0])
+		if err != nil {
+			return
+		}
+		if c != nil {
+			changes = append(changes, *c)
+		}
+	}
+
+	if dryRun(cmd) {
+		outputChanges(os.Stdout, changes)
+		return
+	}
+
+	applied := []recordChange{}
+	err = applyChanges(changes, func(c recordChange) {
+		applied = append(applied, c)
+		if outputType != "json" {
+			printChange(os.Stdout, c)
+		}
+	})
+
+	if outputType == "json" {
+		b, _ := json.Marshal(applied)
+		os.Stdout.Write(b)
+	} else if err == nil && len(applied) == 0 {
+		fmt.Println("No changes.")
+	}
+
+	if err == nil {
+		err = waitForChanges(cmd, applied)
+	}
+	return
+}
+
+// upsertRecords returns the records described by the flags, one for
+// each -data value, for domain.
+func upsertRecords(cmd *Command, domain string) (records []dnsme.Record, err error) {
+
+	data := *cmd.Flag.Lookup("data").Value.(*stringList)
+	if len(data) > 1 && cmd.Flag.Lookup("replace").Value.String() != "true" {
+		err = errors.New("several -data values require -replace")
+		return
+	}
+	if len(data) == 0 {
+		// the data may be given by -priority, -txt etc.
+		data = append(data, "")
+	}
+
+	base := dnsme.Record{
+		Name:        cmd.Flag.Lookup("name").Value.String(),
+		Type:        cmd.Flag.Lookup("type").Value.String(),
+		GtdLocation: cmd.Flag.Lookup("gtdLocation").Value.String(),
+		Password:    cmd.Flag.Lookup("password").Value.String(),
+	}
+	base.TTL, _ = strconv.Atoi(cmd.Flag.Lookup("ttl").Value.String())
+	setRedirect(cmd, &base, allFlags)
+
+	for _, d := range data {
+		r := base
+		r.Data = d
+		err = composeData(cmd, &r)
+		if err != nil {
+			return
+		}
+		err = checkRecord(os.Stderr, domain, r)
+		if err != nil {
+			return
+		}
+		records = append(records, r)
+	}
+	return
+}
+
+// upsertChange returns the change which makes want exist among the
+// existing records with its name, type and location, or nil if it
+// already does.
+func upsertChange(cmd *Command, domain string, existing []dnsme.Record, want dnsme.Record) (c *recordChange, err error) {
+
+	var old *dnsme.Record
+	for i := range existing {
+		if existing[i].Data == want.Data {
+			old = &existing[i]
+			break
+		}
+	}
+
+	switch {
+	case old != nil:
+	case len(existing) == 0:
+		c = &recordChange{Op: opCreate, Domain: domain, Record: want}
+		return
+	case len(existing) == 1:
+		old = &existing[0]
+	default:
+		err = fmt.Errorf("%d %s records named %q exist in %s; use -replace to replace them all",
+			len(existing), want.Type, want.Name, domain)
+		return
+	}
+
+	// only the fields given are changed
+	given := givenFlags(cmd)
+	old.Error = nil
+	r := *old
+	r.Data = want.Data
+	if given("ttl") {
+		r.TTL = want.TTL
+	}
+	if given("password") {
+		r.Password = want.Password
+	}
+	setRedirect(cmd, &r, given)
+
+	if recordDifferences(*old, r) != "unchanged" {
+		c = &recordChange{Op: opUpdate, Domain: domain, Record: r, Old: old}
+	}
+	return
+}
+
+// mergeReplacements turns pairs of deletes and creates among changes
+// into updates, so that records are replaced in place.
+func mergeReplacements(changes []recordChange) (merged []recordChange) {
+
+	var deletes, others []recordChange
+	for _, c := range changes {
+		if c.Op == opDelete {
+			deletes = append(deletes, c)
+		} else {
+			others = append(others, c)
+		}
+	}
+
+	for _, c := range others {
+		if c.Op == opCreate && len(deletes) > 0 {
+			old := deletes[0].Record
+			deletes = deletes[1:]
+			c.Op = opUpdate
+			c.Record.ID = old.ID
+			c.Old = &old
+		}
+		merged = append(merged, c)
+	}
+
+	// remaining deletes first, as in diffRecords
+	return append(deletes, merged...)
+}
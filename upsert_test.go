@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+func TestUpsertRecord(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddDomain(dnsme.Domain{Name: "example.com"})
+
+		out := mustRun(t, "upsert-record", "-name", "www", "-type", "A", "-data", "192.0.2.1", "example.com")
+		if !strings.Contains(out, "+ example.com: www") {
+			t.Errorf("upsert-record of a new record:\n%s", out)
+		}
+		if out := mustRun(t, "upsert-record", "-name", "www", "-type", "A", "-data", "192.0.2.1", "example.com"); out != "No changes.\n" {
+			t.Errorf("upsert-record of an existing record = %q", out)
+		}
+
+		// the record is updated in place, keeping its TTL
+		id := s.Records("example.com")[0].ID
+		out = mustRun(t, "upsert-record", "-name", "www", "-type", "A", "-data", "192.0.2.2", "example.com")
+		if !strings.Contains(out, "~ example.com: www") {
+			t.Errorf("upsert-record of new data:\n%s", out)
+		}
+		if r := s.Records("example.com"); len(r) != 1 || r[0].ID != id || r[0].Data != "192.0.2.2" || r[0].TTL != 3600 {
+			t.Errorf("records after upsert-record = %+v", r)
+		}
+
+		var changes []recordChange
+		out = mustRun(t, "upsert-record", "-o", "json", "-name", "www", "-type", "A", "-replace", "-data", "192.0.2.2", "-data", "192.0.2.3", "-ttl", "60", "example.com")
+		if err := json.Unmarshal([]byte(out), &changes); err != nil || len(changes) != 2 {
+			t.Errorf("upsert-record -replace -o json = %q, %v", out, err)
+		}
+		if got := recordsOf(s, "example.com"); got != "www A 192.0.2.2\nwww A 192.0.2.3" {
+			t.Errorf("records after upsert-record -replace:\n%s", got)
+		}
+
+		mustRun(t, "upsert-record", "-name", "www", "-type", "A", "-replace", "-data", "192.0.2.4", "example.com")
+		if got := recordsOf(s, "example.com"); got != "www A 192.0.2.4" {
+			t.Errorf("records after upsert-record -replace with one address:\n%s", got)
+		}
+
+		if out := mustRun(t, "upsert-record", "-o", "json", "-name", "www", "-type", "A", "-data", "192.0.2.4", "example.com"); out != "[]" {
+			t.Errorf("upsert-record -o json without changes = %q", out)
+		}
+
+		// ambiguous without -replace
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.5", TTL: 300, GtdLocation: "DEFAULT"})
+		if _, _, err := run(t, "upsert-record", "-name", "www", "-type", "A", "-data", "192.0.2.6", "example.com"); err == nil {
+			t.Error("upsert-record with two existing records succeeded")
+		}
+		if _, _, err := run(t, "upsert-record", "-name", "www", "-type", "A", "-data", "192.0.2.6", "-data", "192.0.2.7", "example.com"); err == nil {
+			t.Error("upsert-record with several -data values without -replace succeeded")
+		}
+		if _, _, err := run(t, "upsert-record", "-type", "A", "-data", "192.0.2.6", "example.com"); err == nil {
+			t.Error("upsert-record without -name succeeded")
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var verify = &Command{
+	Run:         runVerify,
+	CustomFlags: flagsVerify,
+	UsageLine:   "verify [-nameserver <address>...] [-parallel <n>] <domain>",
+	Short:       "check the nameservers answer with the domain's records",
+	Long: `
+'verify' checks that the nameservers of a domain answer with the records
+the API holds for it.  Each nameserver is queried for every name and
+type of record in the domain, and the answers are compared with the data
+and TTLs of the records.  The problems found are:
+
+    missing <data>    a record is not answered
+    extra <data>      an answer is not one of the records
+    ttl <data>        the TTL answered is not that of the record
+    error             the query failed, e.g. with REFUSED
+
+Names and types which have no records are not queried, so records served
+under them are not found.
+
+-nameserver gives the address, with an optional port, of a nameserver
+to query instead of those of the domain, as for 'dnsme wait'.
+
+-parallel sets how many queries are made at once; the default is 1.
+
+Only records in the DEFAULT location are checked, as the answers for
+other Global Traffic Director locations depend on where the query comes
+from.  HTTPRED records, which are served as addresses of the redirect
+servers, are not checked.
+
+The problems are listed one per line, or as a JSON array or CSV rows with
+"-o json" or "-o csv".  'verify' exits with a non-zero status if any are
+found, so may be used for monitoring.
+
+`,
+}
+
+func flagsVerify(f *flag.FlagSet) {
+	f.Var(&stringList{}, "nameserver", "")
+	flagParallel(f)
+}
+
+// A discrepancy is a difference between the answer of a nameserver and
+// the records of a domain.
+type discrepancy struct {
+	Server      string `json:"server"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Problem     string `json:"problem"`
+	Data        string `json:"data"`
+	TTL         int    `json:"ttl,omitempty"`
+	ExpectedTTL int    `json:"expectedTtl,omitempty"`
+}
+
+func (d discrepancy) String() string {
+	s := fmt.Sprintf("%s: %s %s: %s", d.Server, strings.TrimSuffix(d.Name, "."), d.Type, d.Problem)
+	switch d.Problem {
+	case "ttl":
+		s += fmt.Sprintf(" %s is %d, not %d", d.Data, d.TTL, d.ExpectedTTL)
+	case "error":
+		s += ": " + d.Data
+	default:
+		s += " " + d.Data
+	}
+	return s
+}
+
+// A verifySet is the data of the records with one name and type, and
+// the TTL of each.
+type verifySet struct {
+	fqdn  string
+	rtype string
+	ttls  map[string]int
+}
+
+func runVerify(cmd *Command, args []string) (err error) {
+
+	if len(args) == 0 {
+		err = errors.New("domain not specified")
+		return
+	}
+
+	domain := args[0]
+
+	n, err := parallelism(cmd)
+	if err != nil {
+		return
+	}
+
+	servers, err := nameservers(cmd, domain)
+	if err != nil {
+		return
+	}
+
+	records, err := client.Records(domain, nil)
+	if err != nil {
+		return
+	}
+
+	byName := make(map[string]*verifySet)
+	for _, r := range records {
+		if dnsTypes[r.Type] == 0 || (r.GtdLocation != "DEFAULT" && r.GtdLocation != "") {
+			continue
+		}
+		fqdn := absoluteName(r.Name, domain)
+		key := fqdn + " " + r.Type
+		if byName[key] == nil {
+			byName[key] = &verifySet{fqdn: fqdn, rtype: r.Type, ttls: make(map[string]int)}
+		}
+		byName[key].ttls[answerData(domain, r)] = r.TTL
+	}
+
+	var sets []*verifySet
+	for _, s := range byName {
+		sets = append(sets, s)
+	}
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].fqdn != sets[j].fqdn {
+			return sets[i].fqdn < sets[j].fqdn
+		}
+		return sets[i].rtype < sets[j].rtype
+	})
+
+	// the problems found by each query, in the order of sets and servers
+	found := make([][]discrepancy, len(sets)*len(servers))
+	forEach(n, len(found), func(i int) {
+		found[i] = verifyAnswers(servers[i%len(servers)], sets[i/len(servers)])
+	})
+
+	problems := []discrepancy{}
+	for _, f := range found {
+		problems = append(problems, f...)
+	}
+
+	switch outputType {
+	default:
+		for _, d := range problems {
+			fmt.Println(d)
+		}
+		if len(problems) == 0 {
+			fmt.Printf("All %d record sets match on %d nameservers.\n", len(sets), len(servers))
+		}
+	case "json":
+		b, _ := json.Marshal(problems)
+		os.Stdout.Write(b)
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		for _, d := range problems {
+			var ttl, expected string
+			if d.Problem == "ttl" {
+				ttl, expected = strconv.Itoa(d.TTL), strconv.Itoa(d.ExpectedTTL)
+			}
+			w.Write([]string{d.Server, d.Name, d.Type, d.Problem, d.Data, ttl, expected})
+		}
+		w.Flush()
+	}
+
+	if len(problems) > 0 {
+		err = fmt.Errorf("%d problems found in %d record sets on %d nameservers", len(problems), len(sets), len(servers))
+	}
+	return
+}
+
+// verifyAnswers queries server for the records of set, and returns the
+// differences between its answer and the records.
+func verifyAnswers(server string, set *verifySet) (problems []discrepancy) {
+
+	add := func(problem, data string, ttl, expected int) {
+		problems = append(problems, discrepancy{server, set.fqdn, set.rtype, problem, data, ttl, expected})
+	}
+
+	resp, err := dnsQuery(server, set.fqdn, dnsTypes[set.rtype])
+	switch {
+	case err != nil:
+		add("error", err.Error(), 0, 0)
+		return
+	case resp.Rcode != rcodeSuccess && resp.Rcode != rcodeNXDomain:
+		add("error", rcodeName(resp.Rcode), 0, 0)
+		return
+	}
+
+	answered := make(map[string]bool)
+	for _, a := range resp.Answers {
+		if a.Type != dnsTypes[set.rtype] || a.Name != set.fqdn || answered[a.Data] {
+			continue
+		}
+		answered[a.Data] = true
+
+		ttl, ok := set.ttls[a.Data]
+		switch {
+		case !ok:
+			add("extra", a.Data, 0, 0)
+		case int(a.TTL) != ttl:
+			add("ttl", a.Data, int(a.TTL), ttl)
+		}
+	}
+
+	var missing []string
+	for data := range set.ttls {
+		if !answered[data] {
+			missing = append(missing, data)
+		}
+	}
+	sort.Strings(missing)
+	for _, data := range missing {
+		add("missing", data, 0, 0)
+	}
+	return
+}
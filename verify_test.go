@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+func TestVerify(t *testing.T) {
+	ns, refused := newTestDNS(t), newTestDNS(t)
+	refused.mu.Lock()
+	refused.rcode = 5
+	refused.mu.Unlock()
+
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddDomain(dnsme.Domain{Name: "example.com", NameServers: []string{ns.Addr}})
+		for _, r := range []dnsme.Record{
+			{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300},
+			{Name: "www", Type: "A", Data: "192.0.2.2", TTL: 300},
+			{Name: "", Type: "MX", Data: "10 mail", TTL: 3600},
+			{Name: "txt", Type: "TXT", Data: "v=spf1 -all", TTL: 60},
+		} {
+			r.GtdLocation = "DEFAULT"
+			s.AddRecord("example.com", r)
+		}
+		// neither is checked
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.9", TTL: 300, GtdLocation: "EUROPE"})
+		s.AddRecord("example.com", dnsme.Record{Name: "go", Type: "HTTPRED", Data: "https://example.org/", TTL: 300, GtdLocation: "DEFAULT", RedirectType: "STANDARD - 302"})
+
+		ns.set("www.example.com.", "A", 300, "192.0.2.2", "192.0.2.1")
+		ns.set("example.com.", "MX", 3600, "10 mail.example.com.")
+		ns.set("txt.example.com.", "TXT", 60, "v=spf1 -all")
+
+		if out := mustRun(t, "verify", "example.com"); out != "All 3 record sets match on 1 nameservers.\n" {
+			t.Errorf("verify of matching answers = %q", out)
+		}
+
+		ns.set("www.example.com.", "A", 300, "192.0.2.1", "192.0.2.3")
+		ns.set("example.com.", "MX", 60, "10 mail.example.com.")
+		t.Cleanup(func() {
+			ns.set("www.example.com.", "A", 300, "192.0.2.2", "192.0.2.1")
+			ns.set("example.com.", "MX", 3600, "10 mail.example.com.")
+		})
+
+		want := strings.NewReplacer("NS", ns.Addr, "BAD", refused.Addr).Replace(`NS: example.com MX: ttl 10 mail.example.com. is 60, not 3600
+BAD: example.com MX: error: REFUSED
+BAD: txt.example.com TXT: error: REFUSED
+NS: www.example.com A: extra 192.0.2.3
+NS: www.example.com A: missing 192.0.2.2
+BAD: www.example.com A: error: REFUSED
+`)
+		for _, parallel := range []string{"1", "4"} {
+			out, _, err := run(t, "verify", "-nameserver", ns.Addr, "-nameserver", refused.Addr, "-parallel", parallel, "example.com")
+			if out != want {
+				t.Errorf("verify -parallel %s:\n%s\nwant:\n%s", parallel, out, want)
+			}
+			if err == nil || err.Error() != "6 problems found in 3 record sets on 2 nameservers" {
+				t.Errorf("verify -parallel %s: err = %v", parallel, err)
+			}
+		}
+
+		out, _, _ := run(t, "verify", "-o", "json", "example.com")
+		var problems []discrepancy
+		if err := json.Unmarshal([]byte(out), &problems); err != nil || len(problems) != 3 {
+			t.Fatalf("verify -o json = %q, %v", out, err)
+		}
+		if want := (discrepancy{ns.Addr, "example.com.", "MX", "ttl", "10 mail.example.com.", 60, 3600}); problems[0] != want {
+			t.Errorf("verify -o json: %+v, want %+v", problems[0], want)
+		}
+
+		out, _, _ = run(t, "verify", "-o", "csv", "example.com")
+		if !strings.HasPrefix(out, ns.Addr+",example.com.,MX,ttl,10 mail.example.com.,60,3600\n") {
+			t.Errorf("verify -o csv = %q", out)
+		}
+	})
+}
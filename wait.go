@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// waitInterval is the time between queries while waiting for a change.
+var waitInterval = 2 * time.Second
+
+var waitRecords = &Command{
+	Run:         runWait,
+	CustomFlags: flagsWaitCommand,
+	UsageLine: `wait -name <name> -type <record type> [-data <record data>...]
+    [-nameserver <address>...] [-timeout <duration>] <domain>`,
+	Short: "wait until the nameservers answer with a record",
+	Long: `
+'wait' waits until a record is served by the nameservers of the domain,
+as listed by 'dnsme domain', e.g. after it is added:
+
+    dnsme wait -name www -type A -data 192.0.2.1 example.com
+
+The nameservers are queried for the records with -name and -type until
+each of them answers with exactly the data given by -data, which may be
+repeated for several records.  If -data is not given, the nameservers
+must answer with the data of the records of the name and type in the
+DEFAULT location, so 'wait' also waits for deleted records to go away.
+
+-nameserver gives the address, with an optional port, of a nameserver
+to query instead, e.g. "127.0.0.1:5353" for a local test server.  It
+may be repeated, and may be set by the "nameserver" key of a profile.
+
+-timeout is how long to wait, e.g. "2m"; the default is 5m.  It is an
+error if a nameserver has not answered with the data by then.
+
+The state of each nameserver is reported on stderr as it changes.
+
+HTTPRED records are served as the addresses of redirect servers, so
+cannot be waited for.
+
+The commands which change records, such as 'add-record', take a -wait
+flag giving the time to wait, as here, for their changes to be served.
+
+`,
+}
+
+func flagsWaitCommand(f *flag.FlagSet) {
+	f.String("name", "", "")
+	f.String("type", "", "")
+	f.Var(&stringList{}, "data", "")
+	f.Var(&stringList{}, "nameserver", "")
+	f.Duration("timeout", 5*time.Minute, "")
+}
+
+// flagsWait adds the flags read by waitForChanges.
+func flagsWait(f *flag.FlagSet) {
+	f.Duration("wait", 0, "")
+	f.Var(&stringList{}, "nameserver", "")
+}
+
+func runWait(cmd *Command, args []string) (err error) {
+
+	if len(args) == 0 {
+		err = errors.New("domain not specified")
+		return
+	}
+
+	domain := args[0]
+	value := func(name string) string { return cmd.Flag.Lookup(name).Value.String() }
+
+	if !givenFlags(cmd)("name") || value("type") == "" {
+		err = errors.New("-name and -type must be given")
+		return
+	}
+
+	name, rtype := value("name"), value("type")
+	timeout, _ := time.ParseDuration(value("timeout"))
+
+	servers, err := nameservers(cmd, domain)
+	if err != nil {
+		return
+	}
+
+	var want []string
+	data := *cmd.Flag.Lookup("data").Value.(*stringList)
+	if len(data) > 0 {
+		for _, d := range data {
+			want = append(want, answerData(domain, dnsme.Record{Type: rtype, Data: d}))
+		}
+	} else {
+		want, err = servedData(domain, name, rtype)
+		if err != nil {
+			return
+		}
+	}
+
+	return waitAnswers(os.Stderr, servers, absoluteName(name, domain), rtype, want, timeout)
+}
+
+// waitForChanges waits, for the time given by -wait, until the records
+// with the names and types changed are served as they now are by the
+// API.  It does nothing if -wait was not given.
+func waitForChanges(cmd *Command, changes []recordChange) (err error) {
+
+	timeout, _ := time.ParseDuration(cmd.Flag.Lookup("wait").Value.String())
+	if timeout <= 0 || len(changes) == 0 {
+		return
+	}
+	deadline := time.Now().Add(timeout)
+
+	type rrset struct{ domain, name, rtype string }
+	seen := make(map[rrset]bool)
+	servers := make(map[string][]string)
+
+	var sets []rrset
+	for _, c := range changes {
+		sets = append(sets, rrset{c.Domain, c.Record.Name, c.Record.Type})
+		if c.Old != nil {
+			sets = append(sets, rrset{c.Domain, c.Old.Name, c.Old.Type})
+		}
+	}
+
+	for _, set := range sets {
+		if seen[set] || dnsTypes[set.rtype] == 0 {
+			continue
+		}
+		seen[set] = true
+
+		if servers[set.domain] == nil {
+			servers[set.domain], err = nameservers(cmd, set.domain)
+			if err != nil {
+				return
+			}
+		}
+
+		var want []string
+		want, err = servedData(set.domain, set.name, set.rtype)
+		if err != nil {
+			return
+		}
+
+		err = waitAnswers(os.Stderr, servers[set.domain], absoluteName(set.name, set.domain), set.rtype, want, time.Until(deadline))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// nameservers returns the nameservers to query for domain: those given
+// by -nameserver, or else those of the domain.
+func nameservers(cmd *Command, domain string) (servers []string, err error) {
+
+	servers = *cmd.Flag.Lookup("nameserver").Value.(*stringList)
+	if len(servers) > 0 {
+		return
+	}
+
+	info, err := client.Domain(domain)
+	if err != nil {
+		return
+	}
+	servers = info.NameServers
+	if len(servers) == 0 {
+		err = fmt.Errorf("no nameservers are listed for %s; use -nameserver", domain)
+	}
+	return
+}
+
+// servedData returns the data the nameservers should answer for the
+// records of domain with the name and type, according to the API.
+// Records in other locations than DEFAULT are ignored.
+func servedData(domain, name, rtype string) (data []string, err error) {
+
+	records, err := matchRecords(domain, recordSelector{Name: &name, Type: rtype, GtdLocation: "DEFAULT"})
+	if err != nil {
+		return
+	}
+	for _, r := range records {
+		data = append(data, answerData(domain, r))
+	}
+	return
+}
+
+// waitAnswers queries each of servers for the records of fqdn with the
+// type until all of them answer with exactly the data in want, or the
+// timeout passes.  The state of each server is written to w when it
+// changes.
+func waitAnswers(w io.Writer, servers []string, fqdn, rtype string, want []string, timeout time.Duration) (err error) {
+
+	qtype := dnsTypes[rtype]
+	if qtype == 0 {
+		err = fmt.Errorf("cannot query %s records", rtype)
+		return
+	}
+
+	wanted := answerSet(want)
+	deadline := time.Now().Add(timeout)
+	state := make(map[string]string)
+	done := make(map[string]bool)
+
+	for {
+		for _, s := range servers {
+			if done[s] {
+				continue
+			}
+
+			var now string
+			resp, e := dnsQuery(s, fqdn, qtype)
+			switch {
+			case e != nil:
+				now = "error: " + e.Error()
+			case resp.Rcode != rcodeSuccess && resp.Rcode != rcodeNXDomain:
+				now = "error: " + rcodeName(resp.Rcode)
+			default:
+				got := answerSet(answeredData(resp, fqdn, qtype))
+				if got == wanted {
+					done[s] = true
+					now = "ok"
+				} else {
+					now = "waiting, answered " + got
+				}
+			}
+
+			if now != state[s] {
+				fmt.Fprintf(w, "%s %s %s: %s\n", s, strings.TrimSuffix(fqdn, "."), rtype, now)
+				state[s] = now
+			}
+		}
+
+		if len(done) == len(servers) {
+			return
+		}
+		if time.Now().Add(waitInterval).After(deadline) {
+			err = fmt.Errorf("%d of %d nameservers do not answer %s %s with %s after %s",
+				len(servers)-len(done), len(servers), strings.TrimSuffix(fqdn, "."), rtype, wanted, timeout.Round(time.Second))
+			return
+		}
+		time.Sleep(waitInterval)
+	}
+}
+
+// answeredData returns the data of the answers for the name and type.
+func answeredData(resp dnsResponse, fqdn string, qtype uint16) (data []string) {
+	for _, a := range resp.Answers {
+		if a.Type == qtype && a.Name == strings.ToLower(fqdn) {
+			data = append(data, a.Data)
+		}
+	}
+	return
+}
+
+// answerSet describes a set of record data, in a form which may be
+// compared.
+func answerSet(data []string) string {
+	if len(data) == 0 {
+		return "nothing"
+	}
+	s := append([]string(nil), data...)
+	sort.Strings(s)
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+func rcodeName(rcode int) string {
+	if name, ok := rcodeNames[rcode]; ok {
+		return name
+	}
+	return fmt.Sprintf("rcode %d", rcode)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+// fastWait shortens the time between queries while waiting.
+func fastWait(t *testing.T) {
+	saved := waitInterval
+	waitInterval = 10 * time.Millisecond
+	t.Cleanup(func() { waitInterval = saved })
+}
+
+func TestWaitAnswers(t *testing.T) {
+	fastWait(t)
+	ns1, ns2 := newTestDNS(t), newTestDNS(t)
+	ns1.set("www.example.com.", "A", 300, "192.0.2.2")
+	ns2.set("www.example.com.", "A", 300, "192.0.2.1")
+
+	// ns2 is updated later
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ns2.set("www.example.com.", "A", 300, "192.0.2.2")
+	}()
+
+	var b strings.Builder
+	err := waitAnswers(&b, []string{ns1.Addr, ns2.Addr}, "www.example.com.", "A", []string{"192.0.2.2"}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ns1.Addr + " www.example.com A: ok\n" +
+		ns2.Addr + " www.example.com A: waiting, answered [192.0.2.1]\n" +
+		ns2.Addr + " www.example.com A: ok\n"
+	if b.String() != want {
+		t.Errorf("progress:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	// a record which does not exist is waited for as nothing
+	b.Reset()
+	if err := waitAnswers(&b, []string{ns1.Addr}, "ftp.example.com.", "A", nil, time.Second); err != nil || b.String() != ns1.Addr+" ftp.example.com A: ok\n" {
+		t.Errorf("waiting for nothing: %v\n%s", err, b.String())
+	}
+
+	b.Reset()
+	err = waitAnswers(&b, []string{ns1.Addr, ns2.Addr}, "www.example.com.", "A", []string{"192.0.2.3"}, 0)
+	if err == nil || err.Error() != "2 of 2 nameservers do not answer www.example.com A with [192.0.2.3] after 0s" {
+		t.Errorf("err = %v", err)
+	}
+
+	ns1.mu.Lock()
+	ns1.rcode = 2
+	ns1.mu.Unlock()
+	b.Reset()
+	if err := waitAnswers(&b, []string{ns1.Addr}, "www.example.com.", "A", []string{"192.0.2.2"}, 0); err == nil || !strings.Contains(b.String(), "error: SERVFAIL") {
+		t.Errorf("SERVFAIL: %v\n%s", err, b.String())
+	}
+
+	if err := waitAnswers(&b, []string{ns1.Addr}, "www.example.com.", "HTTPRED", nil, 0); err == nil {
+		t.Error("waiting for an HTTPRED record succeeded")
+	}
+}
+
+func TestWait(t *testing.T) {
+	fastWait(t)
+	ns := newTestDNS(t)
+	ns.set("www.example.com.", "A", 300, "192.0.2.1", "192.0.2.2")
+
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddDomain(dnsme.Domain{Name: "example.com", NameServers: []string{ns.Addr}})
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.2", TTL: 300, GtdLocation: "DEFAULT"})
+		// records in other locations are not waited for
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.9", TTL: 300, GtdLocation: "EUROPE"})
+
+		// the nameservers of the domain are queried
+		_, stderr, err := run(t, "wait", "-name", "www", "-type", "A", "-timeout", "1s", "example.com")
+		if err != nil || stderr != ns.Addr+" www.example.com A: ok\n" {
+			t.Errorf("wait: %v\n%s", err, stderr)
+		}
+
+		mustRun(t, "wait", "-name", "www", "-type", "A", "-data", "192.0.2.2", "-data", "192.0.2.1", "-nameserver", ns.Addr, "-timeout", "1s", "example.com")
+
+		if _, _, err := run(t, "wait", "-name", "www", "-type", "A", "-data", "192.0.2.1", "-timeout", "0s", "example.com"); err == nil {
+			t.Error("wait for data not served succeeded")
+		}
+
+		// the apex is given by an empty name
+		mustRun(t, "wait", "-name", "", "-type", "MX", "-timeout", "1s", "example.com")
+
+		if _, _, err := run(t, "wait", "-type", "A", "example.com"); err == nil {
+			t.Error("wait without -name succeeded")
+		}
+	})
+}
+
+func TestWaitFlag(t *testing.T) {
+	fastWait(t)
+	ns := newTestDNS(t)
+	s := testAPI(t, dnsme.V1)
+	s.AddDomain(dnsme.Domain{Name: "example.com", NameServers: []string{ns.Addr}})
+
+	ns.set("www.example.com.", "A", 300, "192.0.2.1")
+	_, stderr, err := run(t, "add-record", "-name", "www", "-type", "A", "-data", "192.0.2.1", "-wait", "1s", "example.com")
+	if err != nil || !strings.Contains(stderr, "www.example.com A: ok") {
+		t.Errorf("add-record -wait: %v\n%s", err, stderr)
+	}
+
+	// the change is made, but is not served
+	_, _, err = run(t, "update-record", "-name", "www", "-type", "A", "-data", "192.0.2.2", "-wait", "1ms", "example.com")
+	if err == nil || !strings.Contains(err.Error(), "do not answer www.example.com A with [192.0.2.2]") {
+		t.Errorf("update-record -wait of a change not served: err = %v", err)
+	}
+	if got := recordsOf(s, "example.com"); got != "www A 192.0.2.2" {
+		t.Errorf("records after update-record:\n%s", got)
+	}
+
+	// -nameserver is queried instead of the nameservers of the domain
+	other := newTestDNS(t)
+	mustRun(t, "delete-record", "-name", "www", "-type", "A", "-wait", "1s", "-nameserver", other.Addr, "example.com")
+
+	other.set("_acme-challenge.example.com.", "TXT", 60, "token")
+	_, stderr, err = run(t, "acme", "-wait", "1s", "-nameserver", other.Addr, "present", "example.com", "token")
+	if err != nil || !strings.Contains(stderr, "_acme-challenge.example.com TXT: ok") {
+		t.Errorf("acme -wait: %v\n%s", err, stderr)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// SOA timers used by DNS Made Easy for managed domains.
+const zoneSOATimers = "43200 3600 1209600 180"
+
+// zoneOrigin returns the fully qualified form of the absolute name
+// domain, e.g. the origin of a zone or a name server.
+func zoneOrigin(domain string) string {
+	return strings.TrimSuffix(domain, ".") + "."
+}
+
+// writeZone writes d as an RFC 1035 master file.  DNS Made Easy manages
+// the SOA and apex NS records itself, so these are generated from the
+// domain's name servers.  HTTPRED records, which are not DNS records,
+// MX and SRV records with the wrong number of fields, and records of
+// types the exporter does not support are written as comments; a
+// warning is returned for each of the latter two.
+func writeZone(w io.Writer, d exportDomain, serial time.Time) (warnings []string, err error) {
+
+	origin := zoneOrigin(d.Domain.Name)
+
+	records := make([]dnsme.Record, len(d.Records))
+	copy(records, d.Records)
+	sort.Stable(zoneOrder(records))
+
+	nameServers := d.Domain.VanityNameServers
+	if len(nameServers) == 0 {
+		nameServers = d.Domain.NameServers
+	}
+
+	fmt.Fprintf(w, "; %s exported by dnsme on %s\n", d.Domain.Name, serial.UTC().Format(time.RFC1123))
+	fmt.Fprintf(w, "$ORIGIN %s\n", origin)
+	fmt.Fprintf(w, "$TTL %d\n", zoneTTL(records))
+
+	tw := tabwriter.NewWriter(w, 0, 8, 1, ' ', 0)
+
+	if len(nameServers) > 0 {
+		fmt.Fprintf(tw, "@\t\tIN\tSOA\t%s %s %s %s\t; managed by DNS Made Easy\n",
+			zoneOrigin(nameServers[0]), "dns.dnsmadeeasy.com.", serial.UTC().Format("2006010215"), zoneSOATimers)
+		for _, ns := range nameServers {
+			fmt.Fprintf(tw, "@\t\tIN\tNS\t%s\t; managed by DNS Made Easy\n", zoneOrigin(ns))
+		}
+	}
+
+	for _, r := range records {
+		name := r.Name
+		if name == "" {
+			name = "@"
+		}
+
+		var comments []string
+		if r.GtdLocation != "" && r.GtdLocation != "DEFAULT" {
+			comments = append(comments, "gtd="+r.GtdLocation)
+		}
+
+		data, ok := zoneData(r, origin)
+		switch {
+		case ok:
+		case r.Type == "HTTPRED":
+			name, data = "; "+name, r.Data
+			comments = append(comments, "HTTP redirect, not a DNS record")
+		case r.Type == "MX" || r.Type == "SRV":
+			name, data = "; "+name, r.Data
+			comments = append(comments, "invalid data")
+			warnings = append(warnings, fmt.Sprintf("%s: %s record %q has invalid data and is commented out",
+				d.Domain.Name, r.Type, strings.TrimSuffix(zoneFQDN(r.Name, origin), ".")))
+		default:
+			name, data = "; "+name, r.Data
+			comments = append(comments, "not supported by this exporter")
+			warnings = append(warnings, fmt.Sprintf("%s: %s record %q is not supported by the zone file exporter and is commented out",
+				d.Domain.Name, r.Type, strings.TrimSuffix(zoneFQDN(r.Name, origin), ".")))
+		}
+
+		line := fmt.Sprintf("%s\t%d\tIN\t%s\t%s", name, r.TTL, r.Type, data)
+		if len(comments) > 0 {
+			line += "\t; " + strings.Join(comments, ", ")
+		}
+		fmt.Fprintln(tw, line)
+	}
+
+	err = tw.Flush()
+	return
+}
+
+// zoneData returns the data of r in master file format, reporting
+// false if r cannot be represented in a master file.
+func zoneData(r dnsme.Record, origin string) (data string, ok bool) {
+
+	f := strings.Fields(r.Data)
+
+	switch r.Type {
+	case "A", "AAAA":
+		return r.Data, true
+	case "CNAME", "NS", "PTR":
+		return zoneFQDN(r.Data, origin), true
+	case "MX":
+		if len(f) == 2 {
+			return f[0] + " " + zoneFQDN(f[1], origin), true
+		}
+	case "SRV":
+		if len(f) == 4 {
+			return strings.Join(f[:3], " ") + " " + zoneFQDN(f[3], origin), true
+		}
+	case "TXT", "SPF":
+		return zoneTXT(r.Data), true
+	}
+
+	return
+}
+
+// zoneFQDN qualifies a name found in record data.  DNS Made Easy treats
+// names without a trailing dot as relative to the domain.
+func zoneFQDN(name, origin string) string {
+	switch {
+	case name == "" || name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return name
+	}
+	return name + "." + origin
+}
+
+// zoneTXT quotes TXT data as one or more character strings of at most
+// 255 bytes.  Data which is already in master file format is left
+// alone.
+func zoneTXT(data string) string {
+
+	if zoneQuoted(data) {
+		return data
+	}
+
+	var strs []string
+	b := []byte(data)
+	for len(b) > 255 {
+		strs = append(strs, zoneQuote(b[:255]))
+		b = b[255:]
+	}
+	strs = append(strs, zoneQuote(b))
+
+	return strings.Join(strs, " ")
+}
+
+// zoneQuoted reports whether data is in master file format: one or
+// more quoted character strings separated by spaces.
+func zoneQuoted(data string) bool {
+
+	n := 0
+	for i := 0; i < len(data); {
+		switch data[i] {
+		case ' ', '\t':
+			i++
+			continue
+		case '"':
+		default:
+			return false
+		}
+
+		for i++; i < len(data) && data[i] != '"'; i++ {
+			if data[i] == '\\' {
+				i++
+			}
+		}
+		if i >= len(data) {
+			return false
+		}
+		// the closing quote must end the data or be followed by a space
+		i++
+		if i < len(data) && data[i] != ' ' && data[i] != '\t' {
+			return false
+		}
+		n++
+	}
+	return n > 0
+}
+
+func zoneQuote(b []byte) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&buf, "\\%03d", c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// zoneTTL returns the most common TTL among records, used as the
+// default TTL of the zone.
+func zoneTTL(records []dnsme.Record) (ttl int) {
+
+	ttl = 3600
+	count := make(map[int]int)
+	max := 0
+	for _, r := range records {
+		count[r.TTL]++
+		if n := count[r.TTL]; n > max || n == max && r.TTL < ttl {
+			ttl, max = r.TTL, n
+		}
+	}
+	return
+}
+
+// zoneOrder sorts records by name, with the apex first, then type.
+type zoneOrder []dnsme.Record
+
+func (z zoneOrder) Len() int      { return len(z) }
+func (z zoneOrder) Swap(i, j int) { z[i], z[j] = z[j], z[i] }
+func (z zoneOrder) Less(i, j int) bool {
+	if z[i].Name != z[j].Name {
+		return z[i].Name < z[j].Name
+	}
+	return z[i].Type < z[j].Type
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jswank/dnsme/dnsme"
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+func TestWriteZone(t *testing.T) {
+	d := exportDomain{
+		Domain: dnsme.Domain{Name: "example.com", NameServers: []string{"ns0.dnsmadeeasy.com", "ns1.dnsmadeeasy.com"}},
+		Records: []dnsme.Record{
+			{Name: "www", Type: "CNAME", Data: "example.com.", TTL: 3600},
+			{Name: "", Type: "A", Data: "192.0.2.1", TTL: 3600},
+			{Name: "", Type: "MX", Data: "10 mail", TTL: 3600},
+			{Name: "_sip._tcp", Type: "SRV", Data: "10 20 5060 sip.example.net.", TTL: 300},
+			{Name: "txt", Type: "TXT", Data: `say "hi"`, TTL: 3600},
+			{Name: "eu", Type: "A", Data: "192.0.2.2", TTL: 3600, GtdLocation: "EUROPE"},
+			{Name: "go", Type: "HTTPRED", Data: "https://example.org/", TTL: 3600},
+			{Name: "", Type: "CAA", Data: `0 issue "letsencrypt.org"`, TTL: 3600},
+			{Name: "mx", Type: "MX", Data: "mail.example.com.", TTL: 3600},
+			{Name: "_ldap._tcp", Type: "SRV", Data: "10 389 ldap", TTL: 3600},
+		},
+	}
+
+	var b strings.Builder
+	warnings, err := writeZone(&b, d, time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the alignment of the columns is not checked
+	zone := strings.Join(strings.Fields(b.String()), " ")
+
+	for _, want := range []string{
+		"$ORIGIN example.com.",
+		"$TTL 3600",
+		"@ IN SOA ns0.dnsmadeeasy.com. dns.dnsmadeeasy.com. 2026101808 43200 3600 1209600 180",
+		"@ IN NS ns1.dnsmadeeasy.com.",
+		"@ 3600 IN A 192.0.2.1",
+		"@ 3600 IN MX 10 mail.example.com.",
+		"_sip._tcp 300 IN SRV 10 20 5060 sip.example.net.",
+		`txt 3600 IN TXT "say \"hi\""`,
+		"www 3600 IN CNAME example.com.",
+		"eu 3600 IN A 192.0.2.2 ; gtd=EUROPE",
+		"; go 3600 IN HTTPRED https://example.org/ ; HTTP redirect, not a DNS record",
+		`; @ 3600 IN CAA 0 issue "letsencrypt.org" ; not supported by this exporter`,
+		"; mx 3600 IN MX mail.example.com. ; invalid data",
+		"; _ldap._tcp 3600 IN SRV 10 389 ldap ; invalid data",
+	} {
+		if !strings.Contains(zone, want) {
+			t.Errorf("zone lacks %q:\n%s", want, b.String())
+		}
+	}
+
+	// the apex comes first
+	if i, j := strings.Index(zone, "192.0.2.1"), strings.Index(zone, "_sip"); i > j {
+		t.Errorf("apex records are not first:\n%s", b.String())
+	}
+
+	if len(warnings) != 3 || !strings.Contains(warnings[0], "CAA") || !strings.Contains(warnings[1], "SRV") || !strings.Contains(warnings[2], `MX record "mx.example.com" has invalid data`) {
+		t.Errorf("warnings = %q, want one for each of the CAA, MX and SRV records", warnings)
+	}
+}
+
+func TestZoneTXT(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	for data, want := range map[string]string{
+		"v=spf1 -all":        `"v=spf1 -all"`,
+		`"already" "quoted"`: `"already" "quoted"`,
+		"tab\there":          `"tab\009here"`,
+		`"unterminated`:      `"\"unterminated"`,
+		`"a"b`:               `"\"a\"b"`,
+		`"a\"b"`:             `"a\"b"`,
+		long:                 `"` + long[:255] + `" "` + long[255:] + `"`,
+	} {
+		if got := zoneTXT(data); got != want {
+			t.Errorf("zoneTXT(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
+
+func TestZoneTTL(t *testing.T) {
+	records := []dnsme.Record{{TTL: 300}, {TTL: 60}, {TTL: 300}, {TTL: 60}, {TTL: 3600}}
+	if ttl := zoneTTL(records); ttl != 60 {
+		t.Errorf("zoneTTL = %d, want 60, the lowest of the most common", ttl)
+	}
+	if ttl := zoneTTL(nil); ttl != 3600 {
+		t.Errorf("zoneTTL of no records = %d, want 3600", ttl)
+	}
+}
+
+func TestExportZone(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		s.AddRecord("example.com", dnsme.Record{Name: "www", Type: "A", Data: "192.0.2.1", TTL: 300, GtdLocation: "DEFAULT"})
+		s.AddRecord("example.com", dnsme.Record{Name: "", Type: "CAA", Data: `0 issue "letsencrypt.org"`, TTL: 300, GtdLocation: "DEFAULT"})
+
+		stdout, stderr, err := run(t, "export", "-format", "zone", "example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(strings.Join(strings.Fields(stdout), " "), "www 300 IN A 192.0.2.1") {
+			t.Errorf("export -format zone:\n%s", stdout)
+		}
+		if !strings.Contains(stderr, "warning: example.com: CAA record") {
+			t.Errorf("stderr = %q, want a warning for the CAA record", stderr)
+		}
+
+		dir := t.TempDir()
+		mustRun(t, "export", "-format", "zone", "-dir", dir, "example.com")
+		b, err := os.ReadFile(filepath.Join(dir, "db.example.com"))
+		if err != nil || !strings.Contains(string(b), "192.0.2.1") {
+			t.Errorf("db.example.com = %q, %v", b, err)
+		}
+
+		if _, _, err := run(t, "export", "-dir", dir, "example.com"); err == nil {
+			t.Error("export -dir without -format zone succeeded")
+		}
+	})
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jswank/dnsme/dnsme"
+)
+
+// maxZoneIncludeDepth limits nested $INCLUDE directives.
+const maxZoneIncludeDepth = 10
+
+// zoneToken is a word of a master file line.  Quoted tokens are
+// character strings, which may contain spaces.
+type zoneToken struct {
+	text   string
+	quoted bool
+}
+
+// zoneLine is a logical line of a master file: parenthesised records
+// spanning several physical lines are joined.
+type zoneLine struct {
+	lineno     int
+	blankOwner bool
+	tokens     []zoneToken
+	comment    string
+}
+
+// zoneParser converts master file records into records of a single
+// domain.
+type zoneParser struct {
+	domain   string // FQDN of the domain records are imported into
+	ttl      int    // default TTL
+	hasTTL   bool   // whether ttl was set by $TTL
+	lastName string
+	records  []dnsme.Record
+	warnings []string
+}
+
+// parseZone reads a master file from r and returns the records it holds
+// for domain.  SOA and apex NS records, which DNS Made Easy manages, are
+// skipped; records that cannot be imported are reported as warnings.
+// file is used to resolve $INCLUDE directives and in messages.  Names
+// are compared without regard to case, and the names of the records are
+// returned in lower case.
+func parseZone(r io.Reader, file, domain string) (records []dnsme.Record, warnings []string, err error) {
+
+	p := &zoneParser{
+		// as owner names are lowercased by zoneName
+		domain: zoneOrigin(strings.ToLower(domain)),
+		ttl:    3600,
+	}
+
+	err = p.parse(r, file, p.domain, 0)
+	records, warnings = p.records, p.warnings
+	return
+}
+
+func (p *zoneParser) warn(file string, lineno int, format string, args ...interface{}) {
+	p.warnings = append(p.warnings, fmt.Sprintf("%s:%d: ", file, lineno)+fmt.Sprintf(format, args...))
+}
+
+func (p *zoneParser) parse(r io.Reader, file, origin string, depth int) (err error) {
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	lines, err := zoneLines(b)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", file, err)
+		return
+	}
+
+	for _, l := range lines {
+		if len(l.tokens) == 0 {
+			continue
+		}
+
+		switch l.tokens[0].text {
+		case "$ORIGIN":
+			if len(l.tokens) < 2 {
+				err = fmt.Errorf("%s:%d: $ORIGIN requires a name", file, l.lineno)
+				return
+			}
+			origin = zoneName(l.tokens[1].text, origin)
+			continue
+
+		case "$TTL":
+			if len(l.tokens) < 2 {
+				err = fmt.Errorf("%s:%d: $TTL requires a value", file, l.lineno)
+				return
+			}
+			p.ttl, err = zoneParseTTL(l.tokens[1].text)
+			if err != nil {
+				err = fmt.Errorf("%s:%d: %s", file, l.lineno, err)
+				return
+			}
+			p.hasTTL = true
+			continue
+
+		case "$INCLUDE":
+			if len(l.tokens) < 2 {
+				err = fmt.Errorf("%s:%d: $INCLUDE requires a file name", file, l.lineno)
+				return
+			}
+			if depth >= maxZoneIncludeDepth {
+				err = fmt.Errorf("%s:%d: $INCLUDE nested too deeply", file, l.lineno)
+				return
+			}
+			err = p.include(file, l, origin, depth)
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		if strings.HasPrefix(l.tokens[0].text, "$") {
+			p.warn(file, l.lineno, "unsupported directive %s", l.tokens[0].text)
+			continue
+		}
+
+		err = p.record(file, l, origin)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// include reads the file named by an $INCLUDE directive, relative to the
+// including file.  The origin is restored after the included file.
+func (p *zoneParser) include(file string, l zoneLine, origin string, depth int) (err error) {
+
+	name := l.tokens[1].text
+	if !filepath.IsAbs(name) && file != "-" {
+		name = filepath.Join(filepath.Dir(file), name)
+	}
+	if len(l.tokens) > 2 {
+		origin = zoneName(l.tokens[2].text, origin)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		err = fmt.Errorf("%s:%d: %s", file, l.lineno, err)
+		return
+	}
+	defer f.Close()
+
+	return p.parse(f, name, origin, depth+1)
+}
+
+// record handles a resource record line.
+func (p *zoneParser) record(file string, l zoneLine, origin string) (err error) {
+
+	tokens := l.tokens
+
+	owner := p.lastName
+	if !l.blankOwner {
+		owner = zoneName(tokens[0].text, origin)
+		tokens = tokens[1:]
+	}
+	if owner == "" {
+		err = fmt.Errorf("%s:%d: record has no owner name", file, l.lineno)
+		return
+	}
+	p.lastName = owner
+
+	// the TTL and class are optional, and may appear in either order
+	ttl, hasTTL, class := 0, false, "IN"
+	for i := 0; i < 2 && len(tokens) > 0; i++ {
+		t := strings.ToUpper(tokens[0].text)
+		if t == "IN" || t == "CH" || t == "HS" || t == "CS" {
+			class = t
+		} else if n, e := zoneParseTTL(t); e == nil {
+			ttl, hasTTL = n, true
+		} else {
+			break
+		}
+		tokens = tokens[1:]
+	}
+
+	if len(tokens) == 0 {
+		err = fmt.Errorf("%s:%d: record has no type", file, l.lineno)
+		return
+	}
+	rtype := strings.ToUpper(tokens[0].text)
+	rdata := tokens[1:]
+
+	if hasTTL {
+		if !p.hasTTL {
+			// RFC 1035: without $TTL, the last explicit TTL is used
+			p.ttl = ttl
+		}
+	} else {
+		ttl = p.ttl
+	}
+
+	if class != "IN" {
+		p.warn(file, l.lineno, "skipping %s record for %s in class %s", rtype, owner, class)
+		return
+	}
+
+	var name string
+	switch {
+	case owner == p.domain:
+		name = ""
+	case strings.HasSuffix(owner, "."+p.domain):
+		name = strings.TrimSuffix(owner, "."+p.domain)
+	default:
+		p.warn(file, l.lineno, "skipping %s record for %s: not in %s", rtype, owner, p.domain)
+		return
+	}
+
+	if rtype == "SOA" || rtype == "NS" && name == "" {
+		// managed by DNS Made Easy
+		return
+	}
+
+	data, err := zoneRecordData(rtype, rdata, origin)
+	if err != nil {
+		if err == errZoneUnsupported {
+			p.warn(file, l.lineno, "skipping %s record for %s: unsupported record type", rtype, owner)
+			err = nil
+			return
+		}
+		err = fmt.Errorf("%s:%d: %s", file, l.lineno, err)
+		return
+	}
+
+	gtd := "DEFAULT"
+	for _, f := range strings.FieldsFunc(l.comment, func(r rune) bool { return r == ' ' || r == ',' || r == ';' }) {
+		if strings.HasPrefix(f, "gtd=") {
+			gtd = strings.TrimPrefix(f, "gtd=")
+		}
+	}
+
+	p.records = append(p.records, dnsme.Record{
+		Name:        name,
+		Type:        rtype,
+		Data:        data,
+		TTL:         ttl,
+		GtdLocation: gtd,
+	})
+	return
+}
+
+var errZoneUnsupported = errors.New("unsupported record type")
+
+// zoneRecordData converts master file RDATA into DNS Made Easy record
+// data.  Names are made absolute.
+func zoneRecordData(rtype string, rdata []zoneToken, origin string) (data string, err error) {
+
+	want := map[string]int{"A": 1, "AAAA": 1, "CNAME": 1, "NS": 1, "PTR": 1, "MX": 2, "SRV": 4}
+
+	switch rtype {
+	case "A", "AAAA", "CNAME", "NS", "PTR", "MX", "SRV":
+		if len(rdata) != want[rtype] {
+			err = fmt.Errorf("%s record has %d fields, expected %d", rtype, len(rdata), want[rtype])
+			return
+		}
+	case "TXT":
+		if len(rdata) == 0 {
+			err = fmt.Errorf("TXT record has no data")
+			return
+		}
+	default:
+		err = errZoneUnsupported
+		return
+	}
+
+	var f []string
+	for _, t := range rdata {
+		f = append(f, t.text)
+	}
+
+	switch rtype {
+	case "A", "AAAA":
+		data = f[0]
+	case "CNAME", "NS", "PTR":
+		data = zoneName(f[0], origin)
+	case "MX":
+		if _, err = strconv.ParseUint(f[0], 10, 16); err != nil {
+			err = fmt.Errorf("invalid MX preference %q", f[0])
+			return
+		}
+		data = f[0] + " " + zoneName(f[1], origin)
+	case "SRV":
+		for _, n := range f[:3] {
+			if _, err = strconv.ParseUint(n, 10, 16); err != nil {
+				err = fmt.Errorf("invalid SRV field %q", n)
+				return
+			}
+		}
+		data = strings.Join(f[:3], " ") + " " + zoneName(f[3], origin)
+	case "TXT":
+		// a single string is imported as its text; several strings,
+		// or one whose text would be taken for them on export, are
+		// kept in master file form, as written by export
+		if len(f) == 1 && !zoneQuoted(f[0]) {
+			data = f[0]
+		} else {
+			var strs []string
+			for _, s := range f {
+				strs = append(strs, zoneQuote([]byte(s)))
+			}
+			data = strings.Join(strs, " ")
+		}
+	}
+
+	return
+}
+
+// zoneName makes a master file name absolute.
+func zoneName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name) + "." + origin
+}
+
+// zoneParseTTL parses a TTL, either in seconds or in BIND's unit form,
+// e.g. 1h30m.
+func zoneParseTTL(s string) (ttl int, err error) {
+
+	if n, e := strconv.ParseUint(s, 10, 31); e == nil {
+		ttl = int(n)
+		return
+	}
+
+	units := map[byte]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+
+	n := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i] | 0x20 // lower case
+		switch {
+		case s[i] >= '0' && s[i] <= '9':
+			n = n*10 + int(s[i]-'0')
+		case units[c] > 0 && i > 0 && s[i-1] >= '0' && s[i-1] <= '9':
+			ttl += n * units[c]
+			n = 0
+		default:
+			err = fmt.Errorf("invalid TTL %q", s)
+			return
+		}
+	}
+	if n != 0 || s == "" {
+		err = fmt.Errorf("invalid TTL %q", s)
+	}
+	return
+}
+
+// zoneLines splits a master file into logical lines, handling comments,
+// quoting, escapes and parentheses.
+func zoneLines(b []byte) (lines []zoneLine, err error) {
+
+	var (
+		line    zoneLine
+		tok     bytes.Buffer
+		inTok   bool
+		quoted  bool
+		inQuote bool
+		parens  int
+		lineno  = 1
+	)
+
+	endToken := func() {
+		if inTok || quoted {
+			line.tokens = append(line.tokens, zoneToken{tok.String(), quoted})
+		}
+		tok.Reset()
+		inTok, quoted = false, false
+	}
+	startLine := func(i int) {
+		line = zoneLine{lineno: lineno}
+		line.blankOwner = i < len(b) && (b[i] == ' ' || b[i] == '\t')
+	}
+
+	startLine(0)
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+
+		if c == '\\' && i+1 < len(b) {
+			// \DDD is a decimal byte value, \X is X
+			if i+3 < len(b) && isDigit(b[i+1]) && isDigit(b[i+2]) && isDigit(b[i+3]) {
+				n, _ := strconv.Atoi(string(b[i+1 : i+4]))
+				if n > 255 {
+					err = fmt.Errorf("line %d: invalid escape \\%s", lineno, b[i+1:i+4])
+					return
+				}
+				tok.WriteByte(byte(n))
+				i += 3
+			} else {
+				tok.WriteByte(b[i+1])
+				i++
+			}
+			inTok = true
+			continue
+		}
+
+		if inQuote {
+			switch c {
+			case '"':
+				inQuote = false
+				endToken()
+			case '\n':
+				err = fmt.Errorf("line %d: unterminated string", lineno)
+				return
+			default:
+				tok.WriteByte(c)
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			endToken()
+			inQuote, quoted = true, true
+		case ';':
+			endToken()
+			j := bytes.IndexByte(b[i:], '\n')
+			if j < 0 {
+				j = len(b) - i
+			}
+			line.comment = strings.TrimSpace(line.comment + " " + string(b[i+1:i+j]))
+			i += j - 1
+		case '(':
+			endToken()
+			parens++
+		case ')':
+			endToken()
+			if parens == 0 {
+				err = fmt.Errorf("line %d: unbalanced parentheses", lineno)
+				return
+			}
+			parens--
+		case '\n':
+			endToken()
+			lineno++
+			if parens == 0 {
+				lines = append(lines, line)
+				startLine(i + 1)
+			}
+		case ' ', '\t', '\r':
+			endToken()
+		default:
+			tok.WriteByte(c)
+			inTok = true
+		}
+	}
+
+	if inQuote {
+		err = fmt.Errorf("line %d: unterminated string", lineno)
+		return
+	}
+	if parens > 0 {
+		err = fmt.Errorf("line %d: unbalanced parentheses", lineno)
+		return
+	}
+	endToken()
+	lines = append(lines, line)
+
+	return
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jswank/dnsme/dnsme/dnsmetest"
+)
+
+func TestParseZone(t *testing.T) {
+	file := writeFile(t, "db", `$ORIGIN Example.COM.
+$TTL 300
+@	IN	SOA	ns0.dnsmadeeasy.com. dns.dnsmadeeasy.com. (
+		2026101800 43200 3600 1209600 180 )
+	IN	NS	ns0.dnsmadeeasy.com.
+	IN	MX	10 Mail
+WWW	60	IN	A	192.0.2.1 ; gtd=EUROPE
+txt	IN	TXT	"v=spf1" " -all"
+sub	IN	NS	ns.example.net.
+@	IN	CAA	0 issue "letsencrypt.org"
+www.example.org.	IN	A	192.0.2.2
+$INCLUDE hosts
+`)
+	if err := os.WriteFile(filepath.Join(filepath.Dir(file), "hosts"), []byte("ftp IN CNAME www\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, warnings, err := parseZone(bytes.NewReader(b), file, "EXAMPLE.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, r := range records {
+		got = append(got, fmt.Sprintf("%s %d %s %s %s", r.Name, r.TTL, r.Type, r.Data, r.GtdLocation))
+	}
+	want := []string{
+		" 300 MX 10 mail.example.com. DEFAULT",
+		"www 60 A 192.0.2.1 EUROPE",
+		`txt 300 TXT "v=spf1" " -all" DEFAULT`,
+		"sub 300 NS ns.example.net. DEFAULT",
+		"ftp 300 CNAME www.example.com. DEFAULT",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("records:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "CAA") || !strings.Contains(warnings[1], "not in example.com.") {
+		t.Errorf("warnings = %q, want the CAA record and www.example.org", warnings)
+	}
+}
+
+func TestZoneTXTRoundTrip(t *testing.T) {
+	for _, txt := range []string{
+		`"v=spf1 -all"`,
+		`"\"starts with a quote"`,
+		`"\"a\" \"b\""`,
+		`"a" "b"`,
+		`"back\\slash"`,
+	} {
+		var data []string
+		zone := "@ IN TXT " + txt + "\n"
+		for i := 0; i < 2; i++ {
+			records, _, err := parseZone(strings.NewReader(zone), "db", "example.com")
+			if err != nil || len(records) != 1 {
+				t.Fatalf("parseZone(%q) = %+v, %v", zone, records, err)
+			}
+			data = append(data, records[0].Data)
+			zone = "@ IN TXT " + zoneTXT(records[0].Data) + "\n"
+		}
+		if data[0] != data[1] {
+			t.Errorf("TXT %s imported as %q, and %q after export", txt, data[0], data[1])
+		}
+	}
+}
+
+func TestParseZoneErrors(t *testing.T) {
+	for _, zone := range []string{
+		"@ IN MX mail\n",
+		"@ IN A\n",
+		"@ IN TXT \"unterminated\n",
+		"@ IN A ( 192.0.2.1\n",
+		"$INCLUDE missing\n",
+	} {
+		if _, _, err := parseZone(strings.NewReader(zone), filepath.Join(t.TempDir(), "db"), "example.com"); err == nil {
+			t.Errorf("parseZone(%q) succeeded", zone)
+		}
+	}
+}
+
+func TestImportZone(t *testing.T) {
+	forVersions(t, func(t *testing.T, s *dnsmetest.Server) {
+		file := writeFile(t, "db.example.com", "$ORIGIN EXAMPLE.COM.\nWWW 300 IN A 192.0.2.1\n")
+		mustRun(t, "import", "-format", "zone", "-domain", "Example.Com", "-file", file)
+
+		if got := recordsOf(s, "example.com"); got != "www A 192.0.2.1" {
+			t.Errorf("records after import -format zone -domain Example.Com:\n%s", got)
+		}
+
+		if _, _, err := run(t, "import", "-format", "zone", "-file", file); err == nil {
+			t.Error("import -format zone without -domain succeeded")
+		}
+	})
+}